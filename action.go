@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// ActionCategory groups actions for filtering and reporting.
+type ActionCategory string
+
+const (
+	// CategoryAccess covers reading or extracting data (READ, EXPORT, DOWNLOAD).
+	CategoryAccess ActionCategory = "access"
+	// CategoryChange covers modifications of data (CREATE, UPDATE, DELETE).
+	CategoryChange ActionCategory = "change"
+	// CategoryAuth covers authentication events (LOGIN, LOGOUT).
+	CategoryAuth ActionCategory = "auth"
+	// CategoryAdmin covers administrative decisions (APPROVE, GRANT, REVOKE).
+	CategoryAdmin ActionCategory = "admin"
+)
+
+// actionRegistry holds the known actions and their categories. The four
+// built-in actions are always registered.
+var actionRegistry = struct {
+	sync.RWMutex
+	actions map[Action]ActionCategory
+}{
+	actions: map[Action]ActionCategory{
+		ActionCreate: CategoryChange,
+		ActionUpdate: CategoryChange,
+		ActionDelete: CategoryChange,
+		ActionRead:   CategoryAccess,
+	},
+}
+
+// RegisterAction registers a custom action under category, making it valid
+// for IsValid, New, AuditFilters and the HTTP middleware. Registering an
+// action again with the same category is a no-op; changing the category of
+// an existing action is an error.
+//
+// Register actions during program initialization:
+//
+//	func init() {
+//		audit.MustRegisterAction("LOGIN", audit.CategoryAuth)
+//		audit.MustRegisterAction("EXPORT", audit.CategoryAccess)
+//	}
+func RegisterAction(a Action, category ActionCategory) error {
+	if a == "" {
+		return errors.New("action is required")
+	}
+	if category == "" {
+		return errors.New("action category is required")
+	}
+
+	actionRegistry.Lock()
+	defer actionRegistry.Unlock()
+
+	if existing, ok := actionRegistry.actions[a]; ok {
+		if existing != category {
+			return fmt.Errorf("action %s already registered in category %s", a, existing)
+		}
+		return nil
+	}
+	actionRegistry.actions[a] = category
+	return nil
+}
+
+// MustRegisterAction is like RegisterAction but panics on error.
+func MustRegisterAction(a Action, category ActionCategory) {
+	if err := RegisterAction(a, category); err != nil {
+		panic(err)
+	}
+}
+
+// Category returns the category a is registered under, or "" if a is not
+// a known action.
+func (a Action) Category() ActionCategory {
+	actionRegistry.RLock()
+	defer actionRegistry.RUnlock()
+	return actionRegistry.actions[a]
+}
+
+// RegisteredActions returns all known actions, sorted.
+func RegisteredActions() []Action {
+	actionRegistry.RLock()
+	defer actionRegistry.RUnlock()
+
+	actions := make([]Action, 0, len(actionRegistry.actions))
+	for a := range actionRegistry.actions {
+		actions = append(actions, a)
+	}
+	slices.Sort(actions)
+	return actions
+}
+
+// ActionsInCategory returns the actions registered under category, sorted.
+func ActionsInCategory(category ActionCategory) []Action {
+	actionRegistry.RLock()
+	defer actionRegistry.RUnlock()
+
+	var actions []Action
+	for a, c := range actionRegistry.actions {
+		if c == category {
+			actions = append(actions, a)
+		}
+	}
+	slices.Sort(actions)
+	return actions
+}
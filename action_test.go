@@ -0,0 +1,82 @@
+package audit_test
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// actionRuns makes the actions registered by the tests unique, since the
+// registry is global to the process (e.g. with go test -count=2).
+var actionRuns atomic.Int64
+
+func TestRegisterAction(t *testing.T) {
+	login := audit.Action(fmt.Sprintf("TEST_LOGIN_%d", actionRuns.Add(1)))
+	if login.IsValid() {
+		t.Fatal("expected unregistered action to be invalid")
+	}
+
+	if err := audit.RegisterAction(login, audit.CategoryAuth); err != nil {
+		t.Fatalf("RegisterAction returned error: %v", err)
+	}
+	if !login.IsValid() {
+		t.Error("expected registered action to be valid")
+	}
+	if login.Category() != audit.CategoryAuth {
+		t.Errorf("Category = %q, want auth", login.Category())
+	}
+
+	// Same category again is a no-op; a different one is rejected.
+	if err := audit.RegisterAction(login, audit.CategoryAuth); err != nil {
+		t.Errorf("re-registering with the same category returned error: %v", err)
+	}
+	if err := audit.RegisterAction(login, audit.CategoryAdmin); err == nil {
+		t.Error("expected error when changing the category of a registered action")
+	}
+	if err := audit.RegisterAction(audit.ActionRead, audit.CategoryAdmin); err == nil {
+		t.Error("expected error when re-categorizing a built-in action")
+	}
+
+	if _, err := audit.New(login, "sessions", audit.WithActor("u1", "")); err != nil {
+		t.Errorf("expected New to accept a registered action, got %v", err)
+	}
+}
+
+func TestRegisterAction_Validation(t *testing.T) {
+	if err := audit.RegisterAction("", audit.CategoryAuth); err == nil {
+		t.Error("expected error for empty action")
+	}
+	if err := audit.RegisterAction("TEST_NOCAT", ""); err == nil {
+		t.Error("expected error for empty category")
+	}
+}
+
+func TestActionsInCategory(t *testing.T) {
+	audit.MustRegisterAction("TEST_EXPORT", audit.CategoryAccess)
+
+	got := audit.ActionsInCategory(audit.CategoryAccess)
+	want := map[audit.Action]bool{audit.ActionRead: true, "TEST_EXPORT": true}
+	for _, a := range got {
+		delete(want, a)
+	}
+	if len(want) != 0 {
+		t.Errorf("ActionsInCategory(access) = %v, missing %v", got, want)
+	}
+	if audit.ActionCreate.Category() != audit.CategoryChange {
+		t.Errorf("expected built-in CREATE in change category")
+	}
+}
+
+func TestAuditFilters_Validate(t *testing.T) {
+	if err := (audit.AuditFilters{Action: audit.ActionCreate}).Validate(); err != nil {
+		t.Errorf("unexpected error for built-in action: %v", err)
+	}
+	if err := (audit.AuditFilters{}).Validate(); err != nil {
+		t.Errorf("unexpected error for empty filters: %v", err)
+	}
+	if err := (audit.AuditFilters{Action: "NOPE"}).Validate(); err == nil {
+		t.Error("expected error for unknown action")
+	}
+}
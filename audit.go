@@ -5,6 +5,7 @@ package audit
 import (
 	"context"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,9 +21,21 @@ var (
 )
 
 // Info holds all audit context for a request.
+//
+// UserID and Username identify the real actor: the authenticated principal
+// that performed the request. SubjectID and SubjectName identify the
+// effective subject when the actor works on someone else's behalf (support
+// impersonation, a service account calling for a user); they are empty
+// otherwise.
 type Info struct {
+	TenantID      string
 	UserID        string
 	Username      string
+	ActorType     ActorType
+	SubjectID     string
+	SubjectName   string
+	AuthMethod    string
+	Roles         []string
 	CorrelationID string
 	Resource      string
 	ResourceID    string
@@ -35,13 +48,48 @@ func WithInfo(ctx context.Context, info Info) context.Context {
 	return context.WithValue(ctx, infoKey, info)
 }
 
+// WithMutableInfo attaches audit info that can later be changed with
+// UpdateInfo, e.g. by a handler recording the ID of the resource it
+// created. The changes are visible through InfoFrom on every context
+// derived from the returned one, including to the caller of
+// WithMutableInfo once the handler returns.
+func WithMutableInfo(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, infoKey, &infoCell{info: info})
+}
+
+// UpdateInfo applies fn to the Info attached by WithMutableInfo and reports
+// whether there was one. It returns false, without calling fn, if the
+// innermost Info of ctx was attached by WithInfo.
+func UpdateInfo(ctx context.Context, fn func(*Info)) bool {
+	cell, ok := ctx.Value(infoKey).(*infoCell)
+	if !ok {
+		return false
+	}
+	cell.mu.Lock()
+	defer cell.mu.Unlock()
+	fn(&cell.info)
+	return true
+}
+
 // InfoFrom extracts audit info from context. Returns nil if absent.
+// The result is a copy; use UpdateInfo to change mutable info.
 func InfoFrom(ctx context.Context) *Info {
-	i, ok := ctx.Value(infoKey).(Info)
-	if !ok {
-		return nil
+	switch v := ctx.Value(infoKey).(type) {
+	case Info:
+		return &v
+	case *infoCell:
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		i := v.info
+		return &i
 	}
-	return &i
+	return nil
+}
+
+// infoCell holds the Info attached by WithMutableInfo.
+type infoCell struct {
+	mu   sync.Mutex
+	info Info
 }
 
 // WithSkipAudit marks the context to skip audit triggers (e.g. bulk import).
@@ -67,10 +115,66 @@ const (
 	ActionRead   Action = "READ"
 )
 
-// IsValid reports whether a is a known audit action.
+// IsValid reports whether a is a known audit action: one of the built-ins
+// or an action added with RegisterAction.
 func (a Action) IsValid() bool {
-	switch a {
-	case ActionCreate, ActionUpdate, ActionDelete, ActionRead:
+	return a.Category() != ""
+}
+
+// ---------- Actor ----------
+
+// ActorType classifies the real actor of an entry.
+type ActorType string
+
+const (
+	ActorHuman   ActorType = "human"
+	ActorService ActorType = "service"
+	ActorSystem  ActorType = "system"
+)
+
+// IsValid reports whether t is a known actor type.
+func (t ActorType) IsValid() bool {
+	switch t {
+	case ActorHuman, ActorService, ActorSystem:
+		return true
+	}
+	return false
+}
+
+// ---------- Outcome and severity ----------
+
+// Outcome records whether the audited action succeeded.
+type Outcome string
+
+const (
+	OutcomeUnknown Outcome = "unknown"
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+)
+
+// IsValid reports whether o is a known outcome.
+func (o Outcome) IsValid() bool {
+	switch o {
+	case OutcomeUnknown, OutcomeSuccess, OutcomeFailure:
+		return true
+	}
+	return false
+}
+
+// Severity ranks entries for alerting and review.
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityError    Severity = "error"
+	SeverityCritical Severity = "critical"
+)
+
+// IsValid reports whether s is a known severity.
+func (s Severity) IsValid() bool {
+	switch s {
+	case SeverityInfo, SeverityWarning, SeverityError, SeverityCritical:
 		return true
 	}
 	return false
@@ -79,73 +183,313 @@ func (a Action) IsValid() bool {
 // ---------- AuditLog entity ----------
 
 // AuditLog represents an immutable audit log entry.
+//
+// The JSON tags define the serialized form used when entries leave the
+// process, e.g. as audit_outbox payloads.
 type AuditLog struct {
-	ID            uuid.UUID
-	UserID        string
-	Username      string
-	CorrelationID string
-	Action        Action
-	Resource      string
-	ResourceID    string
-	IP            string
-	UserAgent     string
-	Details       map[string]any
+	ID            uuid.UUID      `json:"id"`
+	TenantID      string         `json:"tenant_id,omitempty"`
+	UserID        string         `json:"user_id"`
+	Username      string         `json:"username"`
+	CorrelationID string         `json:"correlation_id"`
+	Action        Action         `json:"action"`
+	Resource      string         `json:"resource"`
+	ResourceID    string         `json:"resource_id"`
+	IP            string         `json:"ip"`
+	UserAgent     string         `json:"user_agent"`
+	Details       map[string]any `json:"details"`
 
 	// ChangedFields stores field-level deltas when available.
-	ChangedFields map[string]any
+	ChangedFields map[string]any `json:"changed_fields"`
+
+	// The actor model: UserID and Username are the real actor, SubjectID
+	// and SubjectName the effective subject of an on-behalf-of action
+	// (see Info).
+	ActorType   ActorType `json:"actor_type,omitempty"`
+	SubjectID   string    `json:"subject_id,omitempty"`
+	SubjectName string    `json:"subject_name,omitempty"`
+	AuthMethod  string    `json:"auth_method,omitempty"`
+	Roles       []string  `json:"roles,omitempty"`
+
+	// Outcome and Severity default to unknown and info. Reason optionally
+	// explains a failure (e.g. "Forbidden").
+	Outcome  Outcome  `json:"outcome"`
+	Severity Severity `json:"severity"`
+	Reason   string   `json:"reason,omitempty"`
 
-	CreatedAt time.Time
+	// CreatedAt is when the audited action occurred. IngestedAt is when
+	// the repository stored the entry; it is set by the database and zero
+	// on entries that were not read back from a repository.
+	CreatedAt  time.Time `json:"created_at"`
+	IngestedAt time.Time `json:"ingested_at,omitzero"`
+
+	// ChainSeq, PrevHash and Hash link the entry into a tamper-evident hash
+	// chain when the repository maintains one (see ComputeHash). They are
+	// zero otherwise.
+	ChainSeq int64  `json:"chain_seq,omitempty"`
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+
+	// Signature and SignatureKeyID are set by Sign (e.g. through a
+	// SigningRepository) and checked by a Verifier.
+	Signature      []byte `json:"signature,omitempty"`
+	SignatureKeyID string `json:"signature_key_id,omitempty"`
 }
 
-// NewAuditLog creates a new audit log entry with basic validation.
-// Accepts an optional nowFn to allow injecting a clock for testing.
-func NewAuditLog(
-	userID, username string,
-	correlationID string,
-	action Action,
-	resource, resourceID string,
-	ip, userAgent string,
-	details map[string]any,
-	nowFn ...func() time.Time,
-) (*AuditLog, error) {
-	if userID == "" {
+// ---------- Construction ----------
+
+// builder accumulates the state applied by Options before New validates it.
+type builder struct {
+	entry AuditLog
+	now   func() time.Time
+	err   error
+}
+
+// Option configures an entry built by New.
+type Option func(*builder)
+
+// WithActor sets the identity of the user who performed the action.
+func WithActor(userID, username string) Option {
+	return func(b *builder) {
+		b.entry.UserID = userID
+		b.entry.Username = username
+	}
+}
+
+// WithActorType sets whether the actor is a human, a service or the
+// system itself.
+func WithActorType(t ActorType) Option {
+	return func(b *builder) {
+		b.entry.ActorType = t
+	}
+}
+
+// WithSubject sets the effective subject the actor worked on behalf of,
+// e.g. the customer impersonated by a support agent.
+func WithSubject(subjectID, subjectName string) Option {
+	return func(b *builder) {
+		b.entry.SubjectID = subjectID
+		b.entry.SubjectName = subjectName
+	}
+}
+
+// WithAuth sets how the actor authenticated (e.g. "oidc", "api_key",
+// "mtls") and the roles it held.
+func WithAuth(method string, roles ...string) Option {
+	return func(b *builder) {
+		b.entry.AuthMethod = method
+		b.entry.Roles = roles
+	}
+}
+
+// WithTenant sets the tenant the entry belongs to.
+func WithTenant(tenantID string) Option {
+	return func(b *builder) {
+		b.entry.TenantID = tenantID
+	}
+}
+
+// WithResourceID sets the identifier of the affected resource.
+func WithResourceID(resourceID string) Option {
+	return func(b *builder) {
+		b.entry.ResourceID = resourceID
+	}
+}
+
+// WithCorrelationID sets the request correlation ID.
+func WithCorrelationID(correlationID string) Option {
+	return func(b *builder) {
+		b.entry.CorrelationID = correlationID
+	}
+}
+
+// WithClient sets the client IP address and user agent.
+func WithClient(ip, userAgent string) Option {
+	return func(b *builder) {
+		b.entry.IP = ip
+		b.entry.UserAgent = userAgent
+	}
+}
+
+// WithDetails sets the free-form details. A "changed_fields" map inside
+// details is also used as ChangedFields unless WithChangedFields is given.
+func WithDetails(details map[string]any) Option {
+	return func(b *builder) {
+		b.entry.Details = details
+	}
+}
+
+// WithChangedFields sets the field-level deltas of the entry.
+func WithChangedFields(changed map[string]any) Option {
+	return func(b *builder) {
+		b.entry.ChangedFields = changed
+	}
+}
+
+// WithOutcome sets whether the action succeeded and, optionally, why it
+// failed.
+func WithOutcome(outcome Outcome, reason string) Option {
+	return func(b *builder) {
+		b.entry.Outcome = outcome
+		b.entry.Reason = reason
+	}
+}
+
+// WithSeverity sets the severity of the entry.
+func WithSeverity(severity Severity) Option {
+	return func(b *builder) {
+		b.entry.Severity = severity
+	}
+}
+
+// WithClock overrides the clock used for CreatedAt, e.g. in tests.
+// A nil clock is ignored.
+func WithClock(now func() time.Time) Option {
+	return func(b *builder) {
+		if now != nil {
+			b.now = now
+		}
+	}
+}
+
+// WithOccurredAt sets CreatedAt to t, the time the audited action occurred,
+// e.g. the start of a request whose entry is built later. A zero t is
+// ignored.
+func WithOccurredAt(t time.Time) Option {
+	return func(b *builder) {
+		if !t.IsZero() {
+			b.now = func() time.Time { return t }
+		}
+	}
+}
+
+// FromContext populates the entry from the Info attached to ctx (see
+// WithInfo). Only non-empty Info fields are applied, and Info.Resource is
+// used only when New was called with an empty resource. Options after
+// FromContext override the values it sets.
+func FromContext(ctx context.Context) Option {
+	return func(b *builder) {
+		info := InfoFrom(ctx)
+		if info == nil {
+			return
+		}
+		setIfNotEmpty(&b.entry.TenantID, info.TenantID)
+		setIfNotEmpty(&b.entry.UserID, info.UserID)
+		setIfNotEmpty(&b.entry.Username, info.Username)
+		if info.ActorType != "" {
+			b.entry.ActorType = info.ActorType
+		}
+		setIfNotEmpty(&b.entry.SubjectID, info.SubjectID)
+		setIfNotEmpty(&b.entry.SubjectName, info.SubjectName)
+		setIfNotEmpty(&b.entry.AuthMethod, info.AuthMethod)
+		if len(info.Roles) > 0 {
+			b.entry.Roles = info.Roles
+		}
+		setIfNotEmpty(&b.entry.CorrelationID, info.CorrelationID)
+		setIfNotEmpty(&b.entry.ResourceID, info.ResourceID)
+		setIfNotEmpty(&b.entry.IP, info.IP)
+		setIfNotEmpty(&b.entry.UserAgent, info.UserAgent)
+		if b.entry.Resource == "" {
+			b.entry.Resource = info.Resource
+		}
+	}
+}
+
+func setIfNotEmpty(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+// New creates a new audit log entry for action on resource, configured by
+// opts, and validates it: a user ID, a valid action and a resource are
+// required.
+//
+//	entry, err := audit.New(audit.ActionUpdate, "orders",
+//		audit.FromContext(ctx),
+//		audit.WithResourceID(orderID),
+//		audit.WithDetails(map[string]any{"status": "paid"}),
+//	)
+func New(action Action, resource string, opts ...Option) (*AuditLog, error) {
+	b := builder{
+		entry: AuditLog{Action: action, Resource: resource},
+		now:   time.Now,
+	}
+	for _, opt := range opts {
+		opt(&b)
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	e := b.entry
+	if e.UserID == "" {
 		return nil, errors.New("user_id is required")
 	}
-	if !action.IsValid() {
+	if !e.Action.IsValid() {
 		return nil, errors.New("invalid action")
 	}
-	if resource == "" {
+	if e.Resource == "" {
 		return nil, errors.New("resource is required")
 	}
+	if e.ActorType != "" && !e.ActorType.IsValid() {
+		return nil, errors.New("invalid actor type")
+	}
 
-	now := time.Now
-	if len(nowFn) > 0 && nowFn[0] != nil {
-		now = nowFn[0]
+	if e.Outcome == "" {
+		e.Outcome = OutcomeUnknown
+	}
+	if !e.Outcome.IsValid() {
+		return nil, errors.New("invalid outcome")
+	}
+	if e.Severity == "" {
+		e.Severity = SeverityInfo
+	}
+	if !e.Severity.IsValid() {
+		return nil, errors.New("invalid severity")
 	}
 
-	if details == nil {
-		details = map[string]any{}
+	if e.Details == nil {
+		e.Details = map[string]any{}
 	}
 
-	changedFields := map[string]any{}
-	if raw, ok := details["changed_fields"]; ok {
-		if m, ok := raw.(map[string]any); ok {
-			changedFields = m
+	if e.ChangedFields == nil {
+		e.ChangedFields = map[string]any{}
+		if raw, ok := e.Details["changed_fields"]; ok {
+			if m, ok := raw.(map[string]any); ok {
+				e.ChangedFields = m
+			}
 		}
 	}
 
-	return &AuditLog{
-		ID:            uuid.New(),
-		UserID:        userID,
-		Username:      username,
-		CorrelationID: correlationID,
-		Action:        action,
-		Resource:      resource,
-		ResourceID:    resourceID,
-		IP:            ip,
-		UserAgent:     userAgent,
-		Details:       details,
-		ChangedFields: changedFields,
-		CreatedAt:     now(),
-	}, nil
+	e.ID = uuid.New()
+	e.CreatedAt = b.now()
+
+	return &e, nil
+}
+
+// NewAuditLog creates a new audit log entry with basic validation.
+// Accepts an optional nowFn to allow injecting a clock for testing.
+//
+// It is a positional wrapper around New; prefer New in new code.
+func NewAuditLog(
+	userID, username string,
+	correlationID string,
+	action Action,
+	resource, resourceID string,
+	ip, userAgent string,
+	details map[string]any,
+	nowFn ...func() time.Time,
+) (*AuditLog, error) {
+	opts := []Option{
+		WithActor(userID, username),
+		WithCorrelationID(correlationID),
+		WithResourceID(resourceID),
+		WithClient(ip, userAgent),
+		WithDetails(details),
+	}
+	if len(nowFn) > 0 {
+		opts = append(opts, WithClock(nowFn[0]))
+	}
+	return New(action, resource, opts...)
 }
@@ -2,6 +2,8 @@ package audit_test
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
@@ -75,6 +77,29 @@ func TestNewAuditLog_CustomClock(t *testing.T) {
 	}
 }
 
+func TestNew_WithOccurredAt(t *testing.T) {
+	occurred := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	entry, err := audit.New(audit.ActionRead, "orders",
+		audit.WithActor("user-1", "john"),
+		audit.WithClock(func() time.Time { return occurred.Add(time.Minute) }),
+		audit.WithOccurredAt(occurred),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !entry.CreatedAt.Equal(occurred) {
+		t.Errorf("expected created_at=%v, got %v", occurred, entry.CreatedAt)
+	}
+	if !entry.IngestedAt.IsZero() {
+		t.Errorf("expected ingested_at unset before storage, got %v", entry.IngestedAt)
+	}
+
+	data, _ := json.Marshal(entry)
+	if strings.Contains(string(data), "ingested_at") {
+		t.Errorf("expected zero ingested_at omitted from JSON, got %s", data)
+	}
+}
+
 func TestAction_IsValid(t *testing.T) {
 	valid := []audit.Action{audit.ActionCreate, audit.ActionRead, audit.ActionUpdate, audit.ActionDelete}
 	for _, a := range valid {
@@ -118,3 +143,180 @@ func TestContextPropagation(t *testing.T) {
 		t.Error("expected ShouldSkip=true after WithSkipAudit")
 	}
 }
+
+func TestMutableInfo(t *testing.T) {
+	ctx := audit.WithMutableInfo(context.Background(), audit.Info{UserID: "u1", Resource: "orders"})
+
+	// A handler further down the chain sees and updates the same Info.
+	handlerCtx := audit.WithSkipAudit(ctx)
+	if !audit.UpdateInfo(handlerCtx, func(i *audit.Info) { i.ResourceID = "ord-1" }) {
+		t.Fatal("expected UpdateInfo to find the mutable info")
+	}
+
+	got := audit.InfoFrom(ctx)
+	if got == nil || got.UserID != "u1" || got.ResourceID != "ord-1" {
+		t.Fatalf("expected the update to be visible to the outer context, got %+v", got)
+	}
+
+	// InfoFrom returns a copy.
+	got.ResourceID = "changed"
+	if audit.InfoFrom(ctx).ResourceID != "ord-1" {
+		t.Error("expected InfoFrom to return a copy")
+	}
+
+	// Info attached with WithInfo shadows the mutable info and is read-only.
+	inner := audit.WithInfo(ctx, audit.Info{UserID: "u2"})
+	if audit.UpdateInfo(inner, func(i *audit.Info) { i.ResourceID = "x" }) {
+		t.Error("expected UpdateInfo to fail on immutable info")
+	}
+	if audit.UpdateInfo(context.Background(), func(*audit.Info) {}) {
+		t.Error("expected UpdateInfo to fail without info")
+	}
+}
+
+func TestNew_WithOptions(t *testing.T) {
+	fixed := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry, err := audit.New(audit.ActionUpdate, "orders",
+		audit.WithActor("user-1", "john"),
+		audit.WithResourceID("ord-1"),
+		audit.WithCorrelationID("corr-1"),
+		audit.WithClient("10.0.0.1", "TestAgent/1.0"),
+		audit.WithDetails(map[string]any{"status": "paid"}),
+		audit.WithClock(func() time.Time { return fixed }),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Resource != "orders" || entry.ResourceID != "ord-1" {
+		t.Errorf("resource = %q/%q, want orders/ord-1", entry.Resource, entry.ResourceID)
+	}
+	if entry.UserID != "user-1" || entry.Username != "john" {
+		t.Errorf("actor = %q/%q, want user-1/john", entry.UserID, entry.Username)
+	}
+	if entry.IP != "10.0.0.1" || entry.UserAgent != "TestAgent/1.0" || entry.CorrelationID != "corr-1" {
+		t.Errorf("unexpected client/correlation fields: %+v", entry)
+	}
+	if entry.Details["status"] != "paid" {
+		t.Errorf("details = %v", entry.Details)
+	}
+	if !entry.CreatedAt.Equal(fixed) {
+		t.Errorf("expected created_at=%v, got %v", fixed, entry.CreatedAt)
+	}
+}
+
+func TestNew_Validation(t *testing.T) {
+	if _, err := audit.New(audit.ActionRead, "orders"); err == nil {
+		t.Error("expected error for missing user_id")
+	}
+	if _, err := audit.New(audit.Action("NOPE"), "orders", audit.WithActor("u1", "")); err == nil {
+		t.Error("expected error for invalid action")
+	}
+	if _, err := audit.New(audit.ActionRead, "", audit.WithActor("u1", "")); err == nil {
+		t.Error("expected error for missing resource")
+	}
+}
+
+func TestNew_FromContext(t *testing.T) {
+	ctx := audit.WithInfo(context.Background(), audit.Info{
+		TenantID:      "acme",
+		UserID:        "u1",
+		Username:      "alice",
+		CorrelationID: "corr-1",
+		Resource:      "payments",
+		ResourceID:    "pay-1",
+		IP:            "10.0.0.1",
+		UserAgent:     "TestAgent/1.0",
+	})
+
+	entry, err := audit.New(audit.ActionRead, "", audit.FromContext(ctx))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.UserID != "u1" || entry.Username != "alice" || entry.CorrelationID != "corr-1" {
+		t.Errorf("actor fields not populated from context: %+v", entry)
+	}
+	if entry.TenantID != "acme" {
+		t.Errorf("tenant = %q, want acme", entry.TenantID)
+	}
+	if entry.Resource != "payments" || entry.ResourceID != "pay-1" {
+		t.Errorf("resource = %q/%q, want payments/pay-1", entry.Resource, entry.ResourceID)
+	}
+
+	// Explicit resource and later options win over the context.
+	entry, err = audit.New(audit.ActionRead, "orders", audit.FromContext(ctx), audit.WithResourceID("ord-9"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Resource != "orders" || entry.ResourceID != "ord-9" {
+		t.Errorf("resource = %q/%q, want orders/ord-9", entry.Resource, entry.ResourceID)
+	}
+}
+
+func TestNew_ChangedFieldsFromDetails(t *testing.T) {
+	changed := map[string]any{"status": map[string]any{"old": "new", "new": "paid"}}
+	entry, err := audit.New(audit.ActionUpdate, "orders",
+		audit.WithActor("u1", ""),
+		audit.WithDetails(map[string]any{"changed_fields": changed}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := entry.ChangedFields["status"]; !ok {
+		t.Errorf("expected changed_fields lifted from details, got %v", entry.ChangedFields)
+	}
+}
+
+func TestNew_OutcomeAndSeverity(t *testing.T) {
+	entry, err := audit.New(audit.ActionDelete, "orders", audit.WithActor("u1", ""))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Outcome != audit.OutcomeUnknown || entry.Severity != audit.SeverityInfo {
+		t.Errorf("defaults = %s/%s, want unknown/info", entry.Outcome, entry.Severity)
+	}
+
+	entry, err = audit.New(audit.ActionDelete, "orders",
+		audit.WithActor("u1", ""),
+		audit.WithOutcome(audit.OutcomeFailure, "insufficient permissions"),
+		audit.WithSeverity(audit.SeverityCritical),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Outcome != audit.OutcomeFailure || entry.Severity != audit.SeverityCritical || entry.Reason != "insufficient permissions" {
+		t.Errorf("got %s/%s/%q", entry.Outcome, entry.Severity, entry.Reason)
+	}
+
+	if _, err := audit.New(audit.ActionRead, "orders", audit.WithActor("u1", ""), audit.WithOutcome("maybe", "")); err == nil {
+		t.Error("expected error for invalid outcome")
+	}
+	if _, err := audit.New(audit.ActionRead, "orders", audit.WithActor("u1", ""), audit.WithSeverity("loud")); err == nil {
+		t.Error("expected error for invalid severity")
+	}
+}
+
+func TestNew_ActorModel(t *testing.T) {
+	ctx := audit.WithInfo(context.Background(), audit.Info{
+		UserID:      "svc-billing",
+		ActorType:   audit.ActorService,
+		SubjectID:   "u1",
+		SubjectName: "alice",
+		AuthMethod:  "mtls",
+		Roles:       []string{"billing"},
+	})
+
+	entry, err := audit.New(audit.ActionUpdate, "invoices", audit.FromContext(ctx))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.UserID != "svc-billing" || entry.SubjectID != "u1" || entry.SubjectName != "alice" {
+		t.Errorf("actor/subject = %q/%q/%q", entry.UserID, entry.SubjectID, entry.SubjectName)
+	}
+	if entry.ActorType != audit.ActorService || entry.AuthMethod != "mtls" || len(entry.Roles) != 1 {
+		t.Errorf("actor model = %s/%q/%v", entry.ActorType, entry.AuthMethod, entry.Roles)
+	}
+
+	if _, err := audit.New(audit.ActionRead, "invoices", audit.WithActor("u1", ""), audit.WithActorType("robot")); err == nil {
+		t.Error("expected error for invalid actor type")
+	}
+}
@@ -0,0 +1,135 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// canonicalEntry is the stable serialization hashed into the chain. Field
+// order is fixed, maps are emitted with sorted keys by encoding/json, and
+// times are normalized to UTC microseconds (the precision PostgreSQL
+// stores), so an entry read back from the database hashes to the same value
+// it was written with. tenant_id, the actor model fields, outcome, severity
+// and reason are omitted when empty so entries written before they existed
+// keep their hashes. The outcome and severity read back for such entries
+// are the column defaults (OutcomeUnknown, SeverityInfo), which are
+// therefore omitted as well.
+type canonicalEntry struct {
+	ID            string         `json:"id"`
+	ChainSeq      int64          `json:"chain_seq"`
+	PrevHash      string         `json:"prev_hash"`
+	TenantID      string         `json:"tenant_id,omitempty"`
+	UserID        string         `json:"user_id"`
+	Username      string         `json:"username"`
+	CorrelationID string         `json:"correlation_id"`
+	ActorType     string         `json:"actor_type,omitempty"`
+	SubjectID     string         `json:"subject_id,omitempty"`
+	SubjectName   string         `json:"subject_name,omitempty"`
+	AuthMethod    string         `json:"auth_method,omitempty"`
+	Roles         []string       `json:"roles,omitempty"`
+	Action        string         `json:"action"`
+	Resource      string         `json:"resource"`
+	ResourceID    string         `json:"resource_id"`
+	IP            string         `json:"ip"`
+	UserAgent     string         `json:"user_agent"`
+	Details       map[string]any `json:"details"`
+	ChangedFields map[string]any `json:"changed_fields"`
+	Outcome       string         `json:"outcome,omitempty"`
+	Severity      string         `json:"severity,omitempty"`
+	Reason        string         `json:"reason,omitempty"`
+	CreatedAt     string         `json:"created_at"`
+	Signature     []byte         `json:"signature"`
+	KeyID         string         `json:"signature_key_id"`
+}
+
+// CanonicalBytes returns the canonical serialization of the entry used for
+// hashing. It covers every field except Hash itself.
+//
+// Details and ChangedFields are hashed as they read back from JSON, so
+// struct values, integers beyond float64 precision and json.Number values
+// hash the same before and after a round-trip through the database.
+func (l *AuditLog) CanonicalBytes() ([]byte, error) {
+	details, err := normalizeJSONMap(l.Details)
+	if err != nil {
+		return nil, fmt.Errorf("normalizing details: %w", err)
+	}
+	changed, err := normalizeJSONMap(l.ChangedFields)
+	if err != nil {
+		return nil, fmt.Errorf("normalizing changed fields: %w", err)
+	}
+
+	c := canonicalEntry{
+		ID:            l.ID.String(),
+		ChainSeq:      l.ChainSeq,
+		PrevHash:      l.PrevHash,
+		TenantID:      l.TenantID,
+		UserID:        l.UserID,
+		Username:      l.Username,
+		CorrelationID: l.CorrelationID,
+		ActorType:     string(l.ActorType),
+		SubjectID:     l.SubjectID,
+		SubjectName:   l.SubjectName,
+		AuthMethod:    l.AuthMethod,
+		Roles:         l.Roles,
+		Action:        string(l.Action),
+		Resource:      l.Resource,
+		ResourceID:    l.ResourceID,
+		IP:            l.IP,
+		UserAgent:     l.UserAgent,
+		Details:       details,
+		ChangedFields: changed,
+		Outcome:       omitDefault(string(l.Outcome), string(OutcomeUnknown)),
+		Severity:      omitDefault(string(l.Severity), string(SeverityInfo)),
+		Reason:        l.Reason,
+		CreatedAt:     l.CreatedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+		Signature:     l.Signature,
+		KeyID:         l.SignatureKeyID,
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("serializing canonical entry: %w", err)
+	}
+	return b, nil
+}
+
+// ComputeHash returns the hex-encoded SHA-256 of the entry's canonical
+// serialization. Because PrevHash is part of that serialization, each hash
+// commits to the entire chain before it.
+func (l *AuditLog) ComputeHash() (string, error) {
+	b, err := l.CanonicalBytes()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// omitDefault returns v, or "" if v is the column default def.
+func omitDefault(v, def string) string {
+	if v == def {
+		return ""
+	}
+	return v
+}
+
+// normalizeJSONMap round-trips m through JSON into a map[string]any, the
+// form in which it is read back from a JSONB column. A nil map becomes an
+// empty one.
+func normalizeJSONMap(m map[string]any) (map[string]any, error) {
+	if len(m) == 0 {
+		return map[string]any{}, nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
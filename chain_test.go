@@ -0,0 +1,151 @@
+package audit_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+func newChainEntry(t *testing.T) *audit.AuditLog {
+	t.Helper()
+	entry, err := audit.NewAuditLog(
+		"user-1", "alice", "corr-1", audit.ActionUpdate, "orders", "ord-1", "10.0.0.1", "TestAgent/1.0",
+		map[string]any{"status_code": 200, "nested": map[string]any{"b": 1, "a": "x"}},
+		func() time.Time { return time.Date(2025, 1, 1, 0, 0, 0, 123456789, time.UTC) },
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entry.ChainSeq = 1
+	return entry
+}
+
+func TestComputeHash_Deterministic(t *testing.T) {
+	entry := newChainEntry(t)
+
+	h1, err := entry.ComputeHash()
+	if err != nil {
+		t.Fatalf("ComputeHash returned error: %v", err)
+	}
+	h2, _ := entry.ComputeHash()
+	if h1 != h2 || len(h1) != 64 {
+		t.Fatalf("expected stable 64-char hex hash, got %q and %q", h1, h2)
+	}
+
+	// Setting Hash must not change the computed hash.
+	entry.Hash = h1
+	if h3, _ := entry.ComputeHash(); h3 != h1 {
+		t.Error("expected Hash to be excluded from the canonical form")
+	}
+}
+
+func TestComputeHash_DetectsChanges(t *testing.T) {
+	base := newChainEntry(t)
+	want, _ := base.ComputeHash()
+
+	mutations := map[string]func(e *audit.AuditLog){
+		"user":      func(e *audit.AuditLog) { e.UserID = "user-2" },
+		"tenant":    func(e *audit.AuditLog) { e.TenantID = "acme" },
+		"subject":   func(e *audit.AuditLog) { e.SubjectID = "cust-9" },
+		"prev_hash": func(e *audit.AuditLog) { e.PrevHash = "abc" },
+		"seq":       func(e *audit.AuditLog) { e.ChainSeq = 2 },
+		"details":   func(e *audit.AuditLog) { e.Details["status_code"] = 500 },
+		"time":      func(e *audit.AuditLog) { e.CreatedAt = e.CreatedAt.Add(time.Second) },
+	}
+	for name, mutate := range mutations {
+		t.Run(name, func(t *testing.T) {
+			e := newChainEntry(t)
+			mutate(e)
+			if got, _ := e.ComputeHash(); got == want {
+				t.Errorf("expected hash to change after mutating %s", name)
+			}
+		})
+	}
+}
+
+func TestComputeHash_StableAcrossStorageRoundTrip(t *testing.T) {
+	entry := newChainEntry(t)
+	want, _ := entry.ComputeHash()
+
+	// Simulate what PostgreSQL does to an entry: JSONB re-decoding turns
+	// numbers into float64, timestamps lose sub-microsecond precision and
+	// come back in another location.
+	raw, _ := json.Marshal(entry.Details)
+	var details map[string]any
+	if err := json.Unmarshal(raw, &details); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	stored := *entry
+	stored.Details = details
+	stored.ChangedFields = nil
+	stored.CreatedAt = entry.CreatedAt.Truncate(time.Microsecond).In(time.FixedZone("X", 3600))
+
+	if got, _ := stored.ComputeHash(); got != want {
+		t.Errorf("hash changed after storage round-trip: %s != %s", got, want)
+	}
+}
+
+func TestComputeHash_StableAcrossOutcomeMigration(t *testing.T) {
+	// An entry chained before outcome, severity and reason existed.
+	legacy := newChainEntry(t)
+	legacy.Outcome, legacy.Severity, legacy.Reason = "", "", ""
+	b, err := legacy.CanonicalBytes()
+	if err != nil {
+		t.Fatalf("CanonicalBytes returned error: %v", err)
+	}
+	for _, key := range []string{`"outcome"`, `"severity"`, `"reason"`} {
+		if strings.Contains(string(b), key) {
+			t.Errorf("canonical form of a legacy entry contains %s: %s", key, b)
+		}
+	}
+	want, _ := legacy.ComputeHash()
+
+	// Migration 000005 reads it back with the column defaults.
+	migrated := *legacy
+	migrated.Outcome, migrated.Severity = audit.OutcomeUnknown, audit.SeverityInfo
+	if got, _ := migrated.ComputeHash(); got != want {
+		t.Errorf("hash changed after migration: %s != %s", got, want)
+	}
+
+	// Other values are covered by the hash.
+	failed := *legacy
+	failed.Outcome, failed.Severity, failed.Reason = audit.OutcomeFailure, audit.SeverityWarning, "denied"
+	if got, _ := failed.ComputeHash(); got == want {
+		t.Error("expected outcome, severity and reason to be hashed")
+	}
+}
+
+func TestComputeHash_NormalizesJSONValues(t *testing.T) {
+	type payment struct {
+		Zeta  string `json:"zeta"`
+		Alpha int    `json:"alpha"`
+	}
+	entry := newChainEntry(t)
+	entry.Details = map[string]any{
+		"payment": payment{Zeta: "z", Alpha: 1},
+		"big":     int64(1234567890123456789),
+		"number":  json.Number("12345678901234567890.50"),
+	}
+	entry.ChangedFields = map[string]any{"amount": map[string]any{"old": json.Number("1.0"), "new": uint64(1 << 60)}}
+	want, err := entry.ComputeHash()
+	if err != nil {
+		t.Fatalf("ComputeHash returned error: %v", err)
+	}
+
+	// Decode the maps the way scanAuditLog reads them from JSONB.
+	stored := *entry
+	for _, m := range []*map[string]any{&stored.Details, &stored.ChangedFields} {
+		raw, _ := json.Marshal(*m)
+		*m = nil
+		if err := json.Unmarshal(raw, m); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+	}
+
+	if got, _ := stored.ComputeHash(); got != want {
+		t.Errorf("hash changed after JSON round-trip: %s != %s", got, want)
+	}
+}
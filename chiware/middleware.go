@@ -1,239 +1,253 @@
-// Package chiware provides a chi-compatible audit logging middleware
-// with a fixed-size worker pool for asynchronous persistence.
+// Package chiware adapts the httpaudit middleware to chi routers.
+//
+// It resolves resources from chi's matched route patterns and falls back to
+// chi's RequestID middleware for the correlation ID. The middleware itself,
+// its worker pool and its options live in httpaudit; this package
+// re-exports them so existing chi services keep a single import.
 package chiware
 
 import (
-	"context"
 	"log/slog"
-	"net"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 
 	audit "github.com/kafeiih/go-audit"
+	"github.com/kafeiih/go-audit/httpaudit"
 )
 
+// Types of the underlying httpaudit middleware.
+type (
+	AuditMiddleware  = httpaudit.AuditMiddleware
+	Option           = httpaudit.Option
+	UserInfo         = httpaudit.UserInfo
+	UserExtractor    = httpaudit.UserExtractor
+	ActionMapper     = httpaudit.ActionMapper
+	OverflowPolicy   = httpaudit.OverflowPolicy
+	SpillBuffer      = httpaudit.SpillBuffer
+	FileSpill        = httpaudit.FileSpill
+	Spool            = httpaudit.Spool
+	SpoolConfig      = httpaudit.SpoolConfig
+	SpoolRecord      = httpaudit.SpoolRecord
+	SyncPolicy       = httpaudit.SyncPolicy
+	RetryPolicy      = httpaudit.RetryPolicy
+	DeadLetterSink   = httpaudit.DeadLetterSink
+	SlogDeadLetter   = httpaudit.SlogDeadLetter
+	WriterDeadLetter = httpaudit.WriterDeadLetter
+	FileDeadLetter   = httpaudit.FileDeadLetter
+	Stats            = httpaudit.Stats
+	ResourceRules    = httpaudit.ResourceRules
+	ParentRef        = httpaudit.ParentRef
+	TrustedProxies   = httpaudit.TrustedProxies
+	RoutePolicy      = httpaudit.RoutePolicy
+)
+
+// Overflow policies, see httpaudit.OverflowPolicy.
 const (
-	defaultWorkers   = 4
-	defaultQueueSize = 256
+	OverflowDropNewest = httpaudit.OverflowDropNewest
+	OverflowDropOldest = httpaudit.OverflowDropOldest
+	OverflowBlock      = httpaudit.OverflowBlock
+	OverflowSync       = httpaudit.OverflowSync
+	OverflowSpill      = httpaudit.OverflowSpill
 )
 
-// UserInfo carries the authenticated user identity extracted by the host application.
-type UserInfo struct {
-	UserID   string
-	Username string
+// AnonymousUserID is httpaudit.AnonymousUserID.
+const AnonymousUserID = httpaudit.AnonymousUserID
+
+// Spool sync policies, see httpaudit.SyncPolicy.
+const (
+	SyncEveryWrite = httpaudit.SyncEveryWrite
+	SyncPeriodic   = httpaudit.SyncPeriodic
+	SyncNever      = httpaudit.SyncNever
+)
+
+// NewAuditMiddleware is httpaudit.NewAuditMiddleware with a chi
+// RouteResolver and ExtractCorrelationID. Options may override both.
+func NewAuditMiddleware(repo audit.AuditRepository, logger *slog.Logger, extractor UserExtractor, opts ...Option) *AuditMiddleware {
+	opts = append([]Option{
+		httpaudit.WithRouteResolver(RouteResolver{}),
+		httpaudit.WithCorrelationID(ExtractCorrelationID),
+	}, opts...)
+	return httpaudit.NewAuditMiddleware(repo, logger, extractor, opts...)
 }
 
-// UserExtractor is a function that retrieves the current user from the
-// request context.  Each host application injects its own implementation
-// (e.g. from Zitadel, Keycloak, etc.).
-type UserExtractor func(context.Context) *UserInfo
-
-// auditJob holds the captured data needed to write a single audit entry.
-type auditJob struct {
-	userID        string
-	username      string
-	correlationID string
-	action        audit.Action
-	resource      string
-	resourceID    string
-	ip            string
-	userAgent     string
-	details       map[string]any
+// WithActionMapper is httpaudit.WithActionMapper.
+func WithActionMapper(fn ActionMapper) Option { return httpaudit.WithActionMapper(fn) }
+
+// WithWorkers is httpaudit.WithWorkers.
+func WithWorkers(n int) Option { return httpaudit.WithWorkers(n) }
+
+// WithQueueSize is httpaudit.WithQueueSize.
+func WithQueueSize(n int) Option { return httpaudit.WithQueueSize(n) }
+
+// WithWriteTimeout is httpaudit.WithWriteTimeout.
+func WithWriteTimeout(d time.Duration) Option { return httpaudit.WithWriteTimeout(d) }
+
+// WithClock is httpaudit.WithClock.
+func WithClock(now func() time.Time) Option { return httpaudit.WithClock(now) }
+
+// WithLoggerAttrs is httpaudit.WithLoggerAttrs.
+func WithLoggerAttrs(args ...any) Option { return httpaudit.WithLoggerAttrs(args...) }
+
+// WithSkip is httpaudit.WithSkip.
+func WithSkip(fn func(*http.Request) bool) Option { return httpaudit.WithSkip(fn) }
+
+// WithRequestInfo is httpaudit.WithRequestInfo. The resource is resolved
+// with chi's routing tree before the router has routed the request.
+func WithRequestInfo() Option { return httpaudit.WithRequestInfo() }
+
+// WithResourceRules is httpaudit.WithResourceRules.
+func WithResourceRules(rules ResourceRules) Option { return httpaudit.WithResourceRules(rules) }
+
+// WithTrustedProxies is httpaudit.WithTrustedProxies.
+func WithTrustedProxies(p TrustedProxies) Option { return httpaudit.WithTrustedProxies(p) }
+
+// ParseTrustedProxies is httpaudit.ParseTrustedProxies.
+func ParseTrustedProxies(cidrs ...string) (TrustedProxies, error) {
+	return httpaudit.ParseTrustedProxies(cidrs...)
 }
 
-// AuditMiddleware records an audit log entry for every authenticated request.
-// It uses a fixed-size worker pool with a buffered channel to provide
-// backpressure instead of spawning unbounded goroutines.
-type AuditMiddleware struct {
-	repo      audit.AuditRepository
-	logger    *slog.Logger
-	extractor UserExtractor
-	jobs      chan auditJob
-	wg        sync.WaitGroup
+// WithOverflowPolicy is httpaudit.WithOverflowPolicy.
+func WithOverflowPolicy(p OverflowPolicy) Option { return httpaudit.WithOverflowPolicy(p) }
+
+// WithBlockTimeout is httpaudit.WithBlockTimeout.
+func WithBlockTimeout(d time.Duration) Option { return httpaudit.WithBlockTimeout(d) }
+
+// WithSpill is httpaudit.WithSpill.
+func WithSpill(buf SpillBuffer, interval time.Duration) Option {
+	return httpaudit.WithSpill(buf, interval)
 }
 
-// NewAuditMiddleware creates an AuditMiddleware backed by repo.
-// The extractor function is called on each request to obtain the current user;
-// if it returns nil the request is not audited.
-func NewAuditMiddleware(repo audit.AuditRepository, logger *slog.Logger, extractor UserExtractor) *AuditMiddleware {
-	m := &AuditMiddleware{
-		repo:      repo,
-		logger:    logger,
-		extractor: extractor,
-		jobs:      make(chan auditJob, defaultQueueSize),
-	}
+// WithSpool is httpaudit.WithSpool.
+func WithSpool(sp *Spool) Option { return httpaudit.WithSpool(sp) }
 
-	m.wg.Add(defaultWorkers)
-	for range defaultWorkers {
-		go m.worker()
-	}
+// WithRetry is httpaudit.WithRetry.
+func WithRetry(p RetryPolicy) Option { return httpaudit.WithRetry(p) }
+
+// WithDeadLetter is httpaudit.WithDeadLetter.
+func WithDeadLetter(sink DeadLetterSink) Option { return httpaudit.WithDeadLetter(sink) }
 
-	return m
+// WithBatch is httpaudit.WithBatch.
+func WithBatch(size int, interval time.Duration) Option { return httpaudit.WithBatch(size, interval) }
+
+// WithMetrics is httpaudit.WithMetrics.
+func WithMetrics(metrics audit.Metrics) Option { return httpaudit.WithMetrics(metrics) }
+
+// RouteOverflowPolicy is httpaudit.RouteOverflowPolicy, e.g.
+//
+//	r.With(chiware.RouteOverflowPolicy(chiware.OverflowSync)).Delete("/accounts/{id}", h)
+func RouteOverflowPolicy(p OverflowPolicy) func(http.Handler) http.Handler {
+	return httpaudit.RouteOverflowPolicy(p)
 }
 
-// worker reads jobs from the channel until it is closed.
-func (m *AuditMiddleware) worker() {
-	defer m.wg.Done()
-
-	for job := range m.jobs {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-
-		entry, err := audit.NewAuditLog(
-			job.userID, job.username, job.correlationID,
-			job.action,
-			job.resource, job.resourceID,
-			job.ip, job.userAgent,
-			job.details,
-		)
-		if err != nil {
-			m.logger.Error("failed to create audit log entry", "error", err)
-			cancel()
-			continue
-		}
-		if err := m.repo.Create(ctx, entry); err != nil {
-			m.logger.Error("failed to persist audit log entry",
-				"error", err,
-				"user_id", job.userID,
-				"resource", job.resource,
-				"action", job.action,
-			)
-		}
-		cancel()
-	}
+// Policy is httpaudit.Policy, e.g.
+//
+//	r.With(chiware.Policy(chiware.RoutePolicy{Action: "CANCEL"})).Post("/orders/{id}/cancel", h)
+func Policy(p RoutePolicy) func(http.Handler) http.Handler {
+	return httpaudit.Policy(p)
+}
+
+// NewFileSpill is httpaudit.NewFileSpill.
+func NewFileSpill(path string) *FileSpill { return httpaudit.NewFileSpill(path) }
+
+// OpenSpool is httpaudit.OpenSpool.
+func OpenSpool(cfg SpoolConfig) (*Spool, error) { return httpaudit.OpenSpool(cfg) }
+
+// NewFileDeadLetter is httpaudit.NewFileDeadLetter.
+func NewFileDeadLetter(path string) *FileDeadLetter { return httpaudit.NewFileDeadLetter(path) }
+
+// IsRetryable is httpaudit.IsRetryable.
+func IsRetryable(err error) bool { return httpaudit.IsRetryable(err) }
+
+// MethodActionMapper is httpaudit.MethodActionMapper.
+func MethodActionMapper(overrides map[string]audit.Action) ActionMapper {
+	return httpaudit.MethodActionMapper(overrides)
 }
 
-// Shutdown closes the job channel and waits for all workers to finish.
-// Call this after http.Server.Shutdown to avoid losing in-flight entries.
-func (m *AuditMiddleware) Shutdown() {
-	close(m.jobs)
-	m.wg.Wait()
+// MethodToAction is httpaudit.MethodToAction.
+func MethodToAction(method string) audit.Action { return httpaudit.MethodToAction(method) }
+
+// StatusOutcome is httpaudit.StatusOutcome.
+func StatusOutcome(status int) (audit.Outcome, audit.Severity, string) {
+	return httpaudit.StatusOutcome(status)
 }
 
-// Handler returns the chi-compatible middleware function.
-func (m *AuditMiddleware) Handler() func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ww := chiMiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
-
-			next.ServeHTTP(ww, r)
-
-			user := m.extractor(r.Context())
-			if user == nil {
-				return
-			}
-
-			resource, resourceID := ExtractResource(r)
-
-			// Skip auditing the audit endpoint itself.
-			if resource == "audit" {
-				return
-			}
-
-			status := ww.Status()
-			if status == 0 {
-				status = http.StatusOK
-			}
-
-			job := auditJob{
-				userID:        user.UserID,
-				username:      user.Username,
-				correlationID: ExtractCorrelationID(r),
-				action:        MethodToAction(r.Method),
-				resource:      resource,
-				resourceID:    resourceID,
-				ip:            ExtractIP(r.RemoteAddr),
-				userAgent:     r.UserAgent(),
-				details: map[string]any{
-					"status_code": status,
-					"method":      r.Method,
-				},
-			}
-
-			select {
-			case m.jobs <- job:
-			default:
-				m.logger.Warn("audit log queue full, discarding entry",
-					"user_id", job.userID,
-					"resource", job.resource,
-					"action", job.action,
-				)
-			}
-		})
+// ExtractIP is httpaudit.ExtractIP.
+func ExtractIP(remoteAddr string) string { return httpaudit.ExtractIP(remoteAddr) }
+
+// RouteResolver resolves routes from the chi routing context of a request.
+// Once chi has routed the request, the matched pattern and URL params are
+// read from the context; before that, including inside a Route or Mount
+// group whose pattern so far ends in "/*", the route is looked up in the
+// router's tree. Requests outside a chi router have no route.
+type RouteResolver struct{}
+
+// Route implements httpaudit.RouteResolver.
+func (RouteResolver) Route(r *http.Request) (httpaudit.Route, bool) {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return httpaudit.Route{}, false
+	}
+	if pattern := rctx.RoutePattern(); pattern != "" && !strings.HasSuffix(pattern, "/*") {
+		return chiRoute(pattern, rctx.URLParams), true
+	}
+	if rctx.Routes == nil {
+		return httpaudit.Route{}, false
+	}
+
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+
+	probe := chi.NewRouteContext()
+	pattern := rctx.Routes.Find(probe, r.Method, path)
+	if pattern == "" {
+		return httpaudit.Route{}, false
 	}
+	return chiRoute(pattern, probe.URLParams), true
 }
 
-// MethodToAction maps HTTP methods to audit Actions.
-func MethodToAction(method string) audit.Action {
-	switch method {
-	case http.MethodPost:
-		return audit.ActionCreate
-	case http.MethodPut, http.MethodPatch:
-		return audit.ActionUpdate
-	case http.MethodDelete:
-		return audit.ActionDelete
-	default:
-		return audit.ActionRead
+func chiRoute(pattern string, params chi.RouteParams) httpaudit.Route {
+	route := httpaudit.Route{Pattern: pattern}
+	for i, key := range params.Keys {
+		route.Params = append(route.Params, httpaudit.RouteParam{Name: key, Value: params.Values[i]})
 	}
+	return route
 }
 
 // ExtractResource derives the resource name and resource ID from the request.
 // It uses chi's matched route pattern (e.g. /v1/tesoreria/pagos/{id})
-// so the value is stable regardless of the actual ID in the URL.
+// so the value is stable regardless of the actual ID in the URL. It applies
+// the default ResourceRules; for others, pass the route found by
+// RouteResolver to ResourceRules.Resource.
 func ExtractResource(r *http.Request) (resource, resourceID string) {
 	rctx := chi.RouteContext(r.Context())
 	if rctx == nil {
 		return strings.TrimPrefix(r.URL.Path, "/v1/"), ""
 	}
+	return httpaudit.ResourceFromRoute(chiRoute(rctx.RoutePattern(), rctx.URLParams))
+}
 
-	// Extract last URL param value as resource_id (convention: /{id}).
-	params := rctx.URLParams
-	if len(params.Values) > 0 {
-		resourceID = params.Values[len(params.Values)-1]
-	}
-
-	// Build resource from the route pattern, dropping param segments.
-	// /v1/tesoreria/pagos/{id} → tesoreria/pagos
-	pattern := strings.TrimPrefix(rctx.RoutePattern(), "/v1/")
-	parts := strings.Split(pattern, "/")
-	clean := parts[:0]
-	for _, p := range parts {
-		if !strings.HasPrefix(p, "{") && p != "" && p != "*" {
-			clean = append(clean, p)
-		}
+// ResolveResource is like ExtractResource, but resolves the route of r
+// before chi has routed it, as seen by a middleware mounted with Use. It
+// falls back to ExtractResource outside a chi router.
+func ResolveResource(r *http.Request) (resource, resourceID string) {
+	route, ok := RouteResolver{}.Route(r)
+	if !ok {
+		return ExtractResource(r)
 	}
-	resource = strings.Join(clean, "/")
-
-	return resource, resourceID
+	return httpaudit.ResourceFromRoute(route)
 }
 
 // ExtractCorrelationID returns request correlation id from common headers,
 // falling back to chi's RequestID middleware context value.
 func ExtractCorrelationID(r *http.Request) string {
-	if v := r.Header.Get("X-Correlation-ID"); v != "" {
+	if v := httpaudit.ExtractCorrelationID(r); v != "" {
 		return v
 	}
-	if v := r.Header.Get("X-Request-ID"); v != "" {
-		return v
-	}
-	if v := r.Header.Get("X-Request-Id"); v != "" {
-		return v
-	}
-	if v := chiMiddleware.GetReqID(r.Context()); v != "" {
-		return v
-	}
-	return ""
-}
-
-// ExtractIP strips the port from a host:port address.
-func ExtractIP(remoteAddr string) string {
-	host, _, err := net.SplitHostPort(remoteAddr)
-	if err != nil {
-		return remoteAddr
-	}
-	return host
+	return chiMiddleware.GetReqID(r.Context())
 }
@@ -7,9 +7,9 @@ import (
 	"net/http/httptest"
 	"sync"
 	"testing"
-	"time"
 
 	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
 
 	audit "github.com/kafeiih/go-audit"
@@ -45,57 +45,7 @@ func (m *mockRepo) getEntries() []*audit.AuditLog {
 	return cp
 }
 
-// ---------- MethodToAction ----------
-
-func TestMethodToAction(t *testing.T) {
-	tests := []struct {
-		method string
-		want   audit.Action
-	}{
-		{http.MethodPost, audit.ActionCreate},
-		{http.MethodPut, audit.ActionUpdate},
-		{http.MethodPatch, audit.ActionUpdate},
-		{http.MethodDelete, audit.ActionDelete},
-		{http.MethodGet, audit.ActionRead},
-		{http.MethodHead, audit.ActionRead},
-		{http.MethodOptions, audit.ActionRead},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.method, func(t *testing.T) {
-			got := MethodToAction(tt.method)
-			if got != tt.want {
-				t.Errorf("MethodToAction(%s) = %s, want %s", tt.method, got, tt.want)
-			}
-		})
-	}
-}
-
-// ---------- ExtractIP ----------
-
-func TestExtractIP(t *testing.T) {
-	tests := []struct {
-		name  string
-		input string
-		want  string
-	}{
-		{"host:port", "192.168.1.1:8080", "192.168.1.1"},
-		{"ipv6 with port", "[::1]:8080", "::1"},
-		{"bare IP no port", "192.168.1.1", "192.168.1.1"},
-		{"empty string", "", ""},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := ExtractIP(tt.input)
-			if got != tt.want {
-				t.Errorf("ExtractIP(%q) = %q, want %q", tt.input, got, tt.want)
-			}
-		})
-	}
-}
-
-// ---------- ExtractResource ----------
+// ---------- Route resolution ----------
 
 func TestExtractResource(t *testing.T) {
 	tests := []struct {
@@ -163,6 +113,66 @@ func TestExtractResource_NoRouteContext(t *testing.T) {
 	}
 }
 
+func TestResolveResource(t *testing.T) {
+	var resource, resourceID string
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			resource, resourceID = ResolveResource(req)
+			next.ServeHTTP(w, req)
+		})
+	})
+	r.Route("/v1/tesoreria", func(r chi.Router) {
+		r.Get("/pagos/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/tesoreria/pagos/pay-1", nil))
+
+	if resource != "tesoreria/pagos" || resourceID != "pay-1" {
+		t.Errorf("ResolveResource = %q, %q, want tesoreria/pagos, pay-1", resource, resourceID)
+	}
+}
+
+func TestExtractCorrelationID(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "x-correlation-id", headers: map[string]string{"X-Correlation-ID": "corr-1"}, want: "corr-1"},
+		{name: "x-request-id", headers: map[string]string{"X-Request-ID": "req-1"}, want: "req-1"},
+		{name: "x-request-id-chi", headers: map[string]string{"X-Request-Id": "req-chi-1"}, want: "req-chi-1"},
+		{name: "none", headers: map[string]string{}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/orders", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			if got := ExtractCorrelationID(req); got != tt.want {
+				t.Errorf("ExtractCorrelationID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractCorrelationID_ChiRequestID(t *testing.T) {
+	var got string
+	r := chi.NewRouter()
+	r.Use(chiMiddleware.RequestID)
+	r.Get("/v1/orders", func(w http.ResponseWriter, r *http.Request) {
+		got = ExtractCorrelationID(r)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/orders", nil))
+
+	if got == "" {
+		t.Error("expected the request ID set by chi's RequestID middleware")
+	}
+}
+
 // ---------- Middleware Handler ----------
 
 func TestHandler_AuditsAuthenticatedRequest(t *testing.T) {
@@ -219,178 +229,131 @@ func TestHandler_AuditsAuthenticatedRequest(t *testing.T) {
 	}
 }
 
-func TestHandler_SkipsUnauthenticatedRequest(t *testing.T) {
+func TestHandler_RequestInfoBeforeHandler(t *testing.T) {
 	repo := &mockRepo{}
-	logger := slog.Default()
-
-	mw := NewAuditMiddleware(repo, logger, func(_ context.Context) *UserInfo {
-		return nil // unauthenticated
-	})
+	mw := NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1", TenantID: "t1"} },
+		WithRequestInfo(),
+	)
 
+	var seen *audit.Info
 	r := chi.NewRouter()
 	r.Use(mw.Handler())
-	r.Get("/v1/orders", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
+	r.Route("/v1/orders", func(r chi.Router) {
+		r.Put("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			seen = audit.InfoFrom(r.Context())
+		})
 	})
 
-	req := httptest.NewRequest(http.MethodGet, "/v1/orders", nil)
-	rec := httptest.NewRecorder()
-	r.ServeHTTP(rec, req)
-
+	req := httptest.NewRequest(http.MethodPut, "/v1/orders/ord-1", nil)
+	req.Header.Set("X-Correlation-ID", "corr-1")
+	req.RemoteAddr = "10.0.0.1:1234"
+	r.ServeHTTP(httptest.NewRecorder(), req)
 	mw.Shutdown()
 
-	if len(repo.getEntries()) != 0 {
-		t.Error("expected no audit entries for unauthenticated request")
+	if seen == nil {
+		t.Fatal("expected audit.Info in the handler context")
 	}
-}
-
-func TestHandler_SkipsAuditResource(t *testing.T) {
-	repo := &mockRepo{}
-	logger := slog.Default()
-
-	mw := NewAuditMiddleware(repo, logger, func(_ context.Context) *UserInfo {
-		return &UserInfo{UserID: "u1", Username: "alice"}
-	})
-
-	r := chi.NewRouter()
-	r.Use(mw.Handler())
-	r.Get("/v1/audit", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	})
-
-	req := httptest.NewRequest(http.MethodGet, "/v1/audit", nil)
-	rec := httptest.NewRecorder()
-	r.ServeHTTP(rec, req)
-
-	mw.Shutdown()
-
-	if len(repo.getEntries()) != 0 {
-		t.Error("expected no audit entries for audit resource")
+	want := audit.Info{
+		TenantID: "t1", UserID: "u1", CorrelationID: "corr-1",
+		Resource: "orders", ResourceID: "ord-1", IP: "10.0.0.1",
+	}
+	if seen.TenantID != want.TenantID || seen.UserID != want.UserID || seen.CorrelationID != want.CorrelationID ||
+		seen.Resource != want.Resource || seen.ResourceID != want.ResourceID || seen.IP != want.IP {
+		t.Errorf("handler saw %+v, want %+v", *seen, want)
+	}
+	if n := len(repo.getEntries()); n != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", n)
 	}
 }
 
-func TestShutdown_DrainsQueue(t *testing.T) {
+func TestHandler_RequestInfoInsideRouteGroup(t *testing.T) {
 	repo := &mockRepo{}
-	logger := slog.Default()
-
-	mw := NewAuditMiddleware(repo, logger, func(_ context.Context) *UserInfo {
-		return &UserInfo{UserID: "u1", Username: "alice"}
-	})
+	mw := NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+		WithRequestInfo(),
+	)
 
+	var seen *audit.Info
 	r := chi.NewRouter()
-	r.Use(mw.Handler())
-	r.Get("/v1/items/{id}", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
+	r.Route("/v1", func(r chi.Router) {
+		r.Use(mw.Handler())
+		r.Get("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+			seen = audit.InfoFrom(r.Context())
+		})
 	})
 
-	// Fire multiple requests.
-	for i := range 10 {
-		req := httptest.NewRequest(http.MethodGet, "/v1/items/item-"+string(rune('0'+i)), nil)
-		rec := httptest.NewRecorder()
-		r.ServeHTTP(rec, req)
-	}
-
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/orders/42", nil))
 	mw.Shutdown()
 
+	if seen == nil || seen.Resource != "orders" || seen.ResourceID != "42" {
+		t.Errorf("handler saw %+v, want orders/42", seen)
+	}
 	entries := repo.getEntries()
-	if len(entries) != 10 {
-		t.Errorf("expected 10 audit entries after shutdown, got %d", len(entries))
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(entries))
+	}
+	if e := entries[0]; e.Resource != "orders" || e.ResourceID != "42" {
+		t.Errorf("resource = %q, %q, want orders, 42", e.Resource, e.ResourceID)
 	}
 }
 
-func TestHandler_RecordsStatusCode(t *testing.T) {
+func TestHandler_ResourceRulesWithMountedRoutes(t *testing.T) {
 	repo := &mockRepo{}
-	logger := slog.Default()
-
-	mw := NewAuditMiddleware(repo, logger, func(_ context.Context) *UserInfo {
-		return &UserInfo{UserID: "u1", Username: "alice"}
-	})
-
+	mw := NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+		WithResourceRules(ResourceRules{
+			Prefixes: []string{"/api/v2"},
+			IDParam:  func(name string) bool { return name == "memberID" },
+			Parents:  true,
+		}),
+	)
+
+	members := chi.NewRouter()
+	members.Get("/members/{memberID}", func(w http.ResponseWriter, r *http.Request) {})
 	r := chi.NewRouter()
 	r.Use(mw.Handler())
-	r.Delete("/v1/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusNoContent)
-	})
-
-	req := httptest.NewRequest(http.MethodDelete, "/v1/orders/ord-99", nil)
-	rec := httptest.NewRecorder()
-	r.ServeHTTP(rec, req)
+	r.Mount("/api/v2/orgs/{orgID}", members)
 
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v2/orgs/o-1/members/m-1", nil))
 	mw.Shutdown()
 
 	entries := repo.getEntries()
 	if len(entries) != 1 {
-		t.Fatalf("expected 1 entry, got %d", len(entries))
+		t.Fatalf("expected 1 audit entry, got %d", len(entries))
 	}
-
-	status, ok := entries[0].Details["status_code"]
-	if !ok {
-		t.Fatal("expected status_code in details")
+	e := entries[0]
+	if e.Resource != "orgs/members" || e.ResourceID != "m-1" {
+		t.Errorf("resource = %q, %q, want orgs/members, m-1", e.Resource, e.ResourceID)
 	}
-	if status != 204 {
-		t.Errorf("status_code = %v, want 204", status)
+	parents, _ := e.Details["parents"].([]any)
+	if len(parents) != 1 || parents[0].(map[string]any)["id"] != "o-1" {
+		t.Errorf("parents = %v, want only the orgID reference", e.Details["parents"])
 	}
 }
 
-func TestHandler_QueueFullDiscardsEntry(t *testing.T) {
-	repo := &mockRepo{}
-	logger := slog.Default()
+func TestHandler_RoutePolicy(t *testing.T) {
+	audit.MustRegisterAction("CANCEL", audit.CategoryChange)
 
-	// Create middleware and immediately close workers so the queue fills up.
-	mw := &AuditMiddleware{
-		repo:   repo,
-		logger: logger,
-		extractor: func(_ context.Context) *UserInfo {
-			return &UserInfo{UserID: "u1", Username: "alice"}
-		},
-		jobs: make(chan auditJob), // unbuffered — always full
-	}
+	repo := &mockRepo{}
+	mw := NewAuditMiddleware(repo, slog.Default(), func(_ context.Context) *UserInfo { return nil })
 
 	r := chi.NewRouter()
 	r.Use(mw.Handler())
-	r.Get("/v1/orders", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	})
+	r.With(Policy(RoutePolicy{Action: "CANCEL", AllowAnonymous: true, Sync: true})).
+		Post("/v1/orders/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/v1/orders/{id}", func(w http.ResponseWriter, r *http.Request) {})
 
-	// This should not block; the entry is discarded.
-	done := make(chan struct{})
-	go func() {
-		req := httptest.NewRequest(http.MethodGet, "/v1/orders", nil)
-		rec := httptest.NewRecorder()
-		r.ServeHTTP(rec, req)
-		close(done)
-	}()
-
-	select {
-	case <-done:
-		// OK — request completed without blocking.
-	case <-time.After(2 * time.Second):
-		t.Fatal("handler blocked on full queue")
-	}
-}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/orders/o-1/cancel", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/orders/o-1", nil))
 
-func TestExtractCorrelationID(t *testing.T) {
-	tests := []struct {
-		name    string
-		headers map[string]string
-		want    string
-	}{
-		{name: "x-correlation-id", headers: map[string]string{"X-Correlation-ID": "corr-1"}, want: "corr-1"},
-		{name: "x-request-id", headers: map[string]string{"X-Request-ID": "req-1"}, want: "req-1"},
-		{name: "x-request-id-chi", headers: map[string]string{"X-Request-Id": "req-chi-1"}, want: "req-chi-1"},
-		{name: "none", headers: map[string]string{}, want: ""},
+	// Written synchronously: no Shutdown needed.
+	entries := repo.getEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected only the annotated route to be audited, got %d entries", len(entries))
 	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			req := httptest.NewRequest(http.MethodGet, "/v1/orders", nil)
-			for k, v := range tt.headers {
-				req.Header.Set(k, v)
-			}
-
-			if got := ExtractCorrelationID(req); got != tt.want {
-				t.Errorf("ExtractCorrelationID() = %q, want %q", got, tt.want)
-			}
-		})
+	if e := entries[0]; e.Action != "CANCEL" || e.UserID != AnonymousUserID || e.ResourceID != "o-1" {
+		t.Errorf("entry = %s by %s on %s, want CANCEL by %s on o-1", e.Action, e.UserID, e.ResourceID, AnonymousUserID)
 	}
+	mw.Shutdown()
 }
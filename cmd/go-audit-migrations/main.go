@@ -11,14 +11,29 @@ import (
 func main() {
 	outDir := flag.String("out", "./migrations", "destination directory for migration files")
 	format := flag.String("format", "split", "migration output format: split|goose")
+	set := flag.String("set", "core", "migration set to copy: core|security")
 	flag.Parse()
 
+	var (
+		copySplit func(string) error
+		copyGoose func(string) error
+		list      func() ([]string, error)
+	)
+	switch *set {
+	case "core":
+		copySplit, copyGoose, list = pgxaudit.CopyMigrations, pgxaudit.CopyGooseMigrations, pgxaudit.MigrationFiles
+	case "security":
+		copySplit, copyGoose, list = pgxaudit.CopySecurityMigrations, pgxaudit.CopyGooseSecurityMigrations, pgxaudit.SecurityMigrationFiles
+	default:
+		log.Fatalf("invalid set %q, expected core or security", *set)
+	}
+
 	var err error
 	switch *format {
 	case "split":
-		err = pgxaudit.CopyMigrations(*outDir)
+		err = copySplit(*outDir)
 	case "goose":
-		err = pgxaudit.CopyGooseMigrations(*outDir)
+		err = copyGoose(*outDir)
 	default:
 		log.Fatalf("invalid format %q, expected split or goose", *format)
 	}
@@ -27,10 +42,10 @@ func main() {
 		log.Fatalf("copying migrations: %v", err)
 	}
 
-	files, err := pgxaudit.MigrationFiles()
+	files, err := list()
 	if err != nil {
 		log.Fatalf("listing migrations: %v", err)
 	}
 
-	fmt.Printf("copied %d embedded migration files to %s using %s format\n", len(files), *outDir, *format)
+	fmt.Printf("copied %d embedded %s migration files to %s using %s format\n", len(files), *set, *outDir, *format)
 }
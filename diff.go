@@ -0,0 +1,243 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DiffOptions configures Diff.
+type DiffOptions struct {
+	// Ignore lists field paths left out of the diff, e.g. "updated_at" or
+	// "address.zip". Ignoring a path ignores everything below it.
+	Ignore []string
+
+	// Mask lists field paths whose values are replaced by MaskValue. The
+	// field is still reported as changed, without revealing its values.
+	Mask []string
+
+	// MaskValue replaces masked values. Defaults to "***".
+	MaskValue string
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// Diff compares before and after field by field and returns the delta in
+// the ChangedFields format: {"path": {"old": x, "new": y}}. Either value may
+// be nil (e.g. on create or delete), in which case every field of the other
+// is reported.
+//
+// Structs and maps are walked recursively and nested fields are reported
+// with dot-separated paths ("address.city"). Field names follow json tags
+// (fields tagged "-" and unexported fields are skipped, embedded structs are
+// flattened). Slices and arrays are compared as a whole, and time.Time
+// values are compared with Equal.
+func Diff(before, after any, opts DiffOptions) (map[string]any, error) {
+	bv, av := derefValue(reflect.ValueOf(before)), derefValue(reflect.ValueOf(after))
+	for _, v := range []reflect.Value{bv, av} {
+		if v.IsValid() && !isContainer(v) {
+			return nil, fmt.Errorf("diff requires structs or maps, got %s", v.Type())
+		}
+	}
+	if !bv.IsValid() && !av.IsValid() {
+		return nil, errors.New("diff requires at least one non-nil value")
+	}
+
+	d := differ{opts: opts, out: map[string]any{}}
+	if d.opts.MaskValue == "" {
+		d.opts.MaskValue = "***"
+	}
+	d.walk("", bv, av)
+	return d.out, nil
+}
+
+// WithDiff sets ChangedFields to Diff(before, after, opts). A Diff error is
+// returned by New.
+func WithDiff(before, after any, opts DiffOptions) Option {
+	return func(b *builder) {
+		changed, err := Diff(before, after, opts)
+		if err != nil {
+			b.err = fmt.Errorf("computing changed fields: %w", err)
+			return
+		}
+		b.entry.ChangedFields = changed
+	}
+}
+
+type differ struct {
+	opts DiffOptions
+	out  map[string]any
+}
+
+// walk compares a and b at path. An invalid reflect.Value means the field
+// is absent on that side.
+func (d *differ) walk(path string, a, b reflect.Value) {
+	if path != "" && matchesPath(path, d.opts.Ignore) {
+		return
+	}
+	a, b = derefValue(a), derefValue(b)
+	if !a.IsValid() && !b.IsValid() {
+		return
+	}
+
+	if (!a.IsValid() || isContainer(a)) && (!b.IsValid() || isContainer(b)) {
+		af, bf := fieldsOf(a), fieldsOf(b)
+		for _, name := range unionKeys(af, bf) {
+			d.walk(joinPath(path, name), af.values[name], bf.values[name])
+		}
+		return
+	}
+
+	if equalValues(a, b) {
+		return
+	}
+
+	oldV, newV := interfaceOf(a), interfaceOf(b)
+	if matchesPath(path, d.opts.Mask) {
+		if oldV != nil {
+			oldV = d.opts.MaskValue
+		}
+		if newV != nil {
+			newV = d.opts.MaskValue
+		}
+	}
+	d.out[path] = map[string]any{"old": oldV, "new": newV}
+}
+
+// fields holds the named children of a struct or map in declaration (or
+// sorted key) order.
+type fields struct {
+	names  []string
+	values map[string]reflect.Value
+}
+
+func (f *fields) add(name string, v reflect.Value) {
+	if _, ok := f.values[name]; !ok {
+		f.names = append(f.names, name)
+	}
+	f.values[name] = v
+}
+
+func fieldsOf(v reflect.Value) fields {
+	f := fields{values: map[string]reflect.Value{}}
+	if !v.IsValid() {
+		return f
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			f.add(fmt.Sprint(k.Interface()), v.MapIndex(k))
+		}
+		// Map iteration order is random; keep the output deterministic.
+		slices.Sort(f.names)
+	case reflect.Struct:
+		addStructFields(&f, v)
+	}
+	return f
+}
+
+func addStructFields(f *fields, v reflect.Value) {
+	t := v.Type()
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		name, skip := jsonFieldName(sf)
+		if skip {
+			continue
+		}
+
+		if sf.Anonymous && name == "" {
+			ev := derefValue(v.Field(i))
+			if ev.IsValid() && ev.Kind() == reflect.Struct && ev.Type() != timeType {
+				addStructFields(f, ev)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		f.add(name, v.Field(i))
+	}
+}
+
+// jsonFieldName returns the json tag name of sf and whether the field is
+// excluded with "-".
+func jsonFieldName(sf reflect.StructField) (string, bool) {
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, false
+}
+
+func unionKeys(a, b fields) []string {
+	names := append([]string{}, a.names...)
+	for _, n := range b.names {
+		if _, ok := a.values[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// isContainer reports whether v is walked field by field.
+func isContainer(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Struct:
+		return v.Type() != timeType
+	case reflect.Map:
+		return true
+	}
+	return false
+}
+
+func derefValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func equalValues(a, b reflect.Value) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return false
+	}
+	if a.Type() == timeType && b.Type() == timeType {
+		return a.Interface().(time.Time).Equal(b.Interface().(time.Time))
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+func interfaceOf(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+func joinPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// matchesPath reports whether path equals one of patterns or lies below it.
+func matchesPath(path string, patterns []string) bool {
+	for _, p := range patterns {
+		if path == p || strings.HasPrefix(path, p+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package audit_test
+
+import (
+	"testing"
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+type diffAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip"`
+}
+
+type diffBase struct {
+	ID string `json:"id"`
+}
+
+type diffOrder struct {
+	diffBase
+	Status    string       `json:"status"`
+	Amount    float64      `json:"amount"`
+	Tags      []string     `json:"tags"`
+	Address   diffAddress  `json:"address"`
+	Billing   *diffAddress `json:"billing,omitempty"`
+	Card      string       `json:"card_number"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	Secret    string       `json:"-"`
+	internal  string
+}
+
+func change(t *testing.T, changed map[string]any, path string) (old, new any) {
+	t.Helper()
+	raw, ok := changed[path]
+	if !ok {
+		t.Fatalf("expected %q in diff, got %v", path, changed)
+	}
+	m := raw.(map[string]any)
+	return m["old"], m["new"]
+}
+
+func TestDiff_Structs(t *testing.T) {
+	ts := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := diffOrder{
+		diffBase:  diffBase{ID: "ord-1"},
+		Status:    "new",
+		Amount:    10,
+		Tags:      []string{"a"},
+		Address:   diffAddress{City: "Lima", Zip: "15001"},
+		Card:      "4111111111111111",
+		UpdatedAt: ts,
+		Secret:    "x",
+		internal:  "x",
+	}
+	after := before
+	after.Status = "paid"
+	after.Tags = []string{"a", "b"}
+	after.Address.City = "Cusco"
+	after.Billing = &diffAddress{City: "Arequipa"}
+	after.Card = "5500000000000004"
+	after.UpdatedAt = ts.In(time.FixedZone("X", 3600)) // same instant
+	after.Secret = "y"
+	after.internal = "y"
+
+	changed, err := audit.Diff(&before, after, audit.DiffOptions{Mask: []string{"card_number"}})
+	if err != nil {
+		t.Fatalf("Diff returned error: %v", err)
+	}
+
+	if o, n := change(t, changed, "status"); o != "new" || n != "paid" {
+		t.Errorf("status = %v -> %v", o, n)
+	}
+	if _, n := change(t, changed, "tags"); len(n.([]string)) != 2 {
+		t.Errorf("expected whole slice reported, got %v", n)
+	}
+	if o, n := change(t, changed, "address.city"); o != "Lima" || n != "Cusco" {
+		t.Errorf("address.city = %v -> %v", o, n)
+	}
+	if o, n := change(t, changed, "billing.city"); o != nil || n != "Arequipa" {
+		t.Errorf("billing.city = %v -> %v", o, n)
+	}
+	if o, n := change(t, changed, "card_number"); o != "***" || n != "***" {
+		t.Errorf("expected masked card_number, got %v -> %v", o, n)
+	}
+
+	for _, path := range []string{"id", "amount", "address.zip", "updated_at", "Secret", "internal"} {
+		if _, ok := changed[path]; ok {
+			t.Errorf("did not expect %q in diff", path)
+		}
+	}
+}
+
+func TestDiff_MapsAndIgnore(t *testing.T) {
+	before := map[string]any{"name": "a", "meta": map[string]any{"v": 1, "etag": "x"}}
+	after := map[string]any{"name": "b", "meta": map[string]any{"v": 2, "etag": "y"}, "new": true}
+
+	changed, err := audit.Diff(before, after, audit.DiffOptions{Ignore: []string{"meta.etag", "name"}})
+	if err != nil {
+		t.Fatalf("Diff returned error: %v", err)
+	}
+	if len(changed) != 2 {
+		t.Fatalf("expected 2 changes, got %v", changed)
+	}
+	if o, n := change(t, changed, "meta.v"); o != 1 || n != 2 {
+		t.Errorf("meta.v = %v -> %v", o, n)
+	}
+	if o, n := change(t, changed, "new"); o != nil || n != true {
+		t.Errorf("new = %v -> %v", o, n)
+	}
+}
+
+func TestDiff_CreateAndDelete(t *testing.T) {
+	order := diffAddress{City: "Lima", Zip: "15001"}
+
+	created, err := audit.Diff(nil, order, audit.DiffOptions{})
+	if err != nil {
+		t.Fatalf("Diff returned error: %v", err)
+	}
+	if o, n := change(t, created, "city"); o != nil || n != "Lima" {
+		t.Errorf("create city = %v -> %v", o, n)
+	}
+
+	deleted, _ := audit.Diff(&order, (*diffAddress)(nil), audit.DiffOptions{})
+	if o, n := change(t, deleted, "zip"); o != "15001" || n != nil {
+		t.Errorf("delete zip = %v -> %v", o, n)
+	}
+}
+
+func TestDiff_InvalidInput(t *testing.T) {
+	if _, err := audit.Diff(1, 2, audit.DiffOptions{}); err == nil {
+		t.Error("expected error for non-struct values")
+	}
+	if _, err := audit.Diff(nil, nil, audit.DiffOptions{}); err == nil {
+		t.Error("expected error for two nil values")
+	}
+}
+
+func TestNew_WithDiff(t *testing.T) {
+	before := diffAddress{City: "Lima"}
+	after := diffAddress{City: "Cusco"}
+
+	entry, err := audit.New(audit.ActionUpdate, "addresses",
+		audit.WithActor("u1", ""),
+		audit.WithDiff(before, after, audit.DiffOptions{}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := entry.ChangedFields["city"]; !ok {
+		t.Errorf("expected city in ChangedFields, got %v", entry.ChangedFields)
+	}
+
+	if _, err := audit.New(audit.ActionUpdate, "addresses",
+		audit.WithActor("u1", ""),
+		audit.WithDiff(1, 2, audit.DiffOptions{}),
+	); err == nil {
+		t.Error("expected Diff error to be returned by New")
+	}
+}
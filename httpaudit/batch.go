@@ -0,0 +1,110 @@
+package httpaudit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// WithBatch makes every worker collect up to size entries and write them
+// with one CreateBatch call, flushing a partial batch interval after its
+// first entry was taken from the queue. It only takes effect if the
+// repository implements audit.BatchRepository and size is greater than 1;
+// otherwise a warning is logged. The audit package's redacting and signing
+// repositories implement it, batching if the repository they wrap does.
+//
+// Entries that fail in a batch are retried individually according to the
+// retry policy (see WithRetry).
+func WithBatch(size int, interval time.Duration) Option {
+	return func(m *AuditMiddleware) {
+		if size > 1 && interval > 0 {
+			m.batchSize = size
+			m.batchInterval = interval
+		}
+	}
+}
+
+// batchWorker reads jobs from the channel in batches until it is closed.
+func (m *AuditMiddleware) batchWorker(repo audit.BatchRepository) {
+	defer m.wg.Done()
+
+	batch := make([]auditJob, 0, m.batchSize)
+	timer := time.NewTimer(m.batchInterval)
+	timer.Stop()
+
+	flush := func() {
+		timer.Stop()
+		m.writeBatch(context.Background(), repo, batch)
+		clear(batch)
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case job, ok := <-m.jobs:
+			if !ok {
+				if len(batch) > 0 {
+					flush()
+				}
+				return
+			}
+			m.metrics.Set(audit.MetricQueueDepth, int64(len(m.jobs)))
+			batch = append(batch, job)
+			if len(batch) == 1 {
+				timer.Reset(m.batchInterval)
+			}
+			if len(batch) >= m.batchSize {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+// writeBatch builds the entries of jobs and persists them with one
+// CreateBatch call. Entries of a failed batch, or the failed entries of a
+// partially persisted one, go through persist individually.
+func (m *AuditMiddleware) writeBatch(ctx context.Context, repo audit.BatchRepository, jobs []auditJob) {
+	built := make([]auditJob, 0, len(jobs))
+	entries := make([]*audit.AuditLog, 0, len(jobs))
+	for _, job := range jobs {
+		entry, err := job.entry()
+		if err != nil {
+			m.logger.Error("failed to create audit log entry", "error", err)
+			continue
+		}
+		built = append(built, job)
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	batchCtx, cancel := context.WithTimeout(ctx, m.writeTimeout)
+	start := time.Now()
+	err := repo.CreateBatch(batchCtx, entries)
+	m.observeWrite("create_batch", start, err)
+	cancel()
+
+	var batchErr *audit.BatchError
+	if err != nil && !errors.As(err, &batchErr) {
+		m.logger.Warn("audit log batch write failed, writing entries individually",
+			"error", err,
+			"entries", len(entries),
+		)
+	}
+
+	for i, job := range built {
+		if err != nil && (batchErr == nil || batchErr.Failed(i)) {
+			if m.persist(ctx, entries[i]) != nil {
+				continue
+			}
+		} else {
+			m.metrics.Add(audit.MetricPersisted, 1)
+		}
+		m.ack(job)
+	}
+}
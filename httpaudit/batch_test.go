@@ -0,0 +1,174 @@
+package httpaudit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// batchRepo records the batches passed to CreateBatch. Entries whose
+// resource ID is in fail are reported as failed in the batch.
+type batchRepo struct {
+	mockRepo
+	mu      sync.Mutex
+	batches [][]*audit.AuditLog
+	fail    map[string]bool
+	err     error
+}
+
+func (b *batchRepo) CreateBatch(_ context.Context, entries []*audit.AuditLog) error {
+	b.mu.Lock()
+	b.batches = append(b.batches, entries)
+	b.mu.Unlock()
+
+	if b.err != nil {
+		return b.err
+	}
+	var be audit.BatchError
+	for i, e := range entries {
+		if b.fail[e.ResourceID] {
+			be.Failures = append(be.Failures, audit.BatchEntryError{Index: i, Err: errors.New("rejected")})
+			continue
+		}
+		b.mockRepo.Create(context.Background(), e)
+	}
+	if len(be.Failures) > 0 {
+		return &be
+	}
+	return nil
+}
+
+func (b *batchRepo) batchSizes() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var sizes []int
+	for _, batch := range b.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+func serveOrders(mw *AuditMiddleware, ids ...string) {
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.HandleFunc("GET /v1/orders/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	for _, id := range ids {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/orders/"+id, nil))
+	}
+}
+
+func newBatchMiddleware(repo audit.AuditRepository, size int, interval time.Duration, opts ...Option) *AuditMiddleware {
+	return NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+		append([]Option{WithWorkers(1), WithBatch(size, interval)}, opts...)...,
+	)
+}
+
+func TestBatch_FlushesBySize(t *testing.T) {
+	repo := &batchRepo{}
+	mw := newBatchMiddleware(repo, 2, time.Hour)
+
+	serveOrders(mw, "1", "2", "3", "4")
+	mw.Shutdown()
+
+	if sizes := repo.batchSizes(); len(sizes) != 2 || sizes[0] != 2 || sizes[1] != 2 {
+		t.Errorf("batch sizes = %v, want [2 2]", sizes)
+	}
+	if n := len(repo.getEntries()); n != 4 {
+		t.Errorf("persisted %d entries, want 4", n)
+	}
+}
+
+func TestBatch_FlushesByInterval(t *testing.T) {
+	repo := &batchRepo{}
+	mw := newBatchMiddleware(repo, 100, 10*time.Millisecond)
+	defer mw.Shutdown()
+
+	serveOrders(mw, "1")
+
+	deadline := time.Now().Add(time.Second)
+	for len(repo.getEntries()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the partial batch to be flushed after the interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBatch_RetriesFailedEntriesIndividually(t *testing.T) {
+	repo := &batchRepo{fail: map[string]bool{"2": true}}
+	mw := newBatchMiddleware(repo, 3, time.Hour)
+
+	serveOrders(mw, "1", "2", "3")
+	mw.Shutdown()
+
+	// Entries 1 and 3 go in the batch, entry 2 through Create.
+	got := map[string]int{}
+	for _, e := range repo.getEntries() {
+		got[e.ResourceID]++
+	}
+	if len(got) != 3 || got["1"] != 1 || got["2"] != 1 || got["3"] != 1 {
+		t.Errorf("persisted %v, want each entry exactly once", got)
+	}
+}
+
+func TestBatch_WholeBatchFailureFallsBack(t *testing.T) {
+	repo := &batchRepo{err: errors.New("connection reset")}
+	mw := newBatchMiddleware(repo, 2, time.Hour)
+
+	serveOrders(mw, "1", "2")
+	mw.Shutdown()
+
+	if n := len(repo.getEntries()); n != 2 {
+		t.Errorf("persisted %d entries individually, want 2", n)
+	}
+}
+
+func TestBatch_IgnoredWithoutBatchRepository(t *testing.T) {
+	var logs bytes.Buffer
+	repo := &mockRepo{}
+	mw := NewAuditMiddleware(repo, slog.New(slog.NewTextHandler(&logs, nil)),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+		WithWorkers(1), WithBatch(10, time.Hour),
+	)
+
+	serveOrders(mw, "1")
+	mw.Shutdown()
+
+	if n := len(repo.getEntries()); n != 1 {
+		t.Errorf("persisted %d entries, want 1 through Create", n)
+	}
+	if !strings.Contains(logs.String(), "does not implement audit.BatchRepository") {
+		t.Errorf("expected a warning about the ignored batch option, got %q", logs.String())
+	}
+}
+
+func TestBatch_ThroughWrappingRepositories(t *testing.T) {
+	repo := &batchRepo{}
+	wrapped := audit.NewRedactingRepository(
+		audit.NewSigningRepository(repo, audit.NewHMACSigner("k1", []byte("secret"))),
+		audit.DefaultRedactionPolicy(),
+	)
+	mw := newBatchMiddleware(wrapped, 3, time.Hour)
+
+	serveOrders(mw, "1", "2", "3")
+	mw.Shutdown()
+
+	if sizes := repo.batchSizes(); len(sizes) != 1 || sizes[0] != 3 {
+		t.Errorf("batch sizes = %v, want [3]", sizes)
+	}
+	for _, e := range repo.getEntries() {
+		if e.SignatureKeyID != "k1" {
+			t.Errorf("entry %s persisted unsigned", e.ResourceID)
+		}
+	}
+}
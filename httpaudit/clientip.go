@@ -0,0 +1,181 @@
+package httpaudit
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies configures how the client IP is resolved behind reverse
+// proxies and load balancers. The zero value trusts no proxy: the client IP
+// is the peer address and forwarding headers are ignored.
+type TrustedProxies struct {
+	// Prefixes are the networks of the proxies whose forwarding headers
+	// are trusted.
+	Prefixes []netip.Prefix
+
+	// Header is the forwarding header the trusted proxies set: "Forwarded"
+	// (RFC 7239), "X-Real-IP", or a comma-separated list of hops such as
+	// "X-Forwarded-For" (default). Only this header is read; the others
+	// may come from the client and are ignored.
+	Header string
+
+	// RecordChain records the forwarding chain, from the original client
+	// to the peer, in the "forwarded_chain" detail. It is only recorded
+	// for requests whose headers are trusted.
+	RecordChain bool
+}
+
+// ParseTrustedProxies returns TrustedProxies for the given CIDRs, e.g.
+// "10.0.0.0/8". Single addresses are accepted as well.
+func ParseTrustedProxies(cidrs ...string) (TrustedProxies, error) {
+	var p TrustedProxies
+	for _, s := range cidrs {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return TrustedProxies{}, fmt.Errorf("parsing trusted proxy %q: %w", s, err)
+			}
+			addr = addr.Unmap()
+			p.Prefixes = append(p.Prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return TrustedProxies{}, fmt.Errorf("parsing trusted proxy %q: %w", s, err)
+		}
+		p.Prefixes = append(p.Prefixes, prefix.Masked())
+	}
+	return p, nil
+}
+
+// WithTrustedProxies sets the proxies whose forwarding headers are used
+// to resolve the client IP.
+func WithTrustedProxies(p TrustedProxies) Option {
+	return func(m *AuditMiddleware) {
+		m.proxies = p
+	}
+}
+
+// ClientIP returns the client IP of r and the forwarding chain it was
+// resolved from.
+//
+// The forwarding header is only read if the peer is a trusted proxy. The
+// chain is the list of hops in the header followed by the peer. It is
+// walked right to left while the hops are trusted proxies; the first
+// untrusted hop is the client. If every hop is trusted, the client is the
+// leftmost one. A hop that is not an IP address (e.g. "unknown" or an
+// obfuscated identifier) ends the walk at the trusted proxy that reported
+// it.
+//
+// A nil chain means the header was not used.
+func (p TrustedProxies) ClientIP(r *http.Request) (ip string, chain []string) {
+	peer := ExtractIP(r.RemoteAddr)
+	peerAddr, err := netip.ParseAddr(peer)
+	if err != nil || !p.trusted(peerAddr) {
+		return peer, nil
+	}
+
+	hops := forwardedHops(r.Header, p.Header)
+	if len(hops) == 0 {
+		return peer, nil
+	}
+	chain = append(hops, peer)
+
+	client := peerAddr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseHop(hops[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !p.trusted(addr) {
+			break
+		}
+	}
+	return client.String(), chain
+}
+
+func (p TrustedProxies) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p.Prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedHops returns the hops listed in the forwarding header name,
+// from the original client to the proxy nearest to the peer.
+func forwardedHops(h http.Header, name string) []string {
+	if name == "" {
+		name = "X-Forwarded-For"
+	}
+	values := h.Values(name)
+	if len(values) == 0 {
+		return nil
+	}
+
+	var hops []string
+	switch http.CanonicalHeaderKey(name) {
+	case "Forwarded":
+		for _, elem := range splitQuoted(strings.Join(values, ","), ',') {
+			for _, pair := range splitQuoted(elem, ';') {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+	case "X-Real-Ip":
+		if v := strings.TrimSpace(values[len(values)-1]); v != "" {
+			hops = append(hops, v)
+		}
+	default:
+		for _, v := range strings.Split(strings.Join(values, ","), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				hops = append(hops, v)
+			}
+		}
+	}
+	return hops
+}
+
+// parseHop parses a forwarding hop: an IP address, optionally with a port,
+// and IPv6 addresses optionally in brackets.
+func parseHop(hop string) (netip.Addr, bool) {
+	hop = strings.TrimSpace(hop)
+	if addr, err := netip.ParseAddr(hop); err == nil {
+		return addr.Unmap(), true
+	}
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	if inner, ok := strings.CutPrefix(hop, "["); ok {
+		if addr, err := netip.ParseAddr(strings.TrimSuffix(inner, "]")); err == nil {
+			return addr.Unmap(), true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// splitQuoted splits s at sep outside of double-quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,179 @@
+package httpaudit
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	p, err := ParseTrustedProxies("10.0.0.0/8", " 192.168.1.10 ", "2001:db8::/32")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies returned error: %v", err)
+	}
+	if len(p.Prefixes) != 3 || p.Prefixes[1].String() != "192.168.1.10/32" {
+		t.Errorf("Prefixes = %v", p.Prefixes)
+	}
+
+	if _, err := ParseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("expected an error for an invalid CIDR")
+	}
+	if _, err := ParseTrustedProxies("proxy.internal"); err == nil {
+		t.Error("expected an error for a host name")
+	}
+}
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8", "2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withHeader := func(name string) TrustedProxies {
+		p := proxies
+		p.Header = name
+		return p
+	}
+
+	tests := []struct {
+		name      string
+		proxies   TrustedProxies
+		remote    string
+		headers   map[string]string
+		want      string
+		wantChain []string
+	}{
+		{
+			name:    "no trusted proxies ignores headers",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "203.0.113.7"},
+			want:    "10.0.0.1",
+		},
+		{
+			name:    "untrusted peer ignores spoofed headers",
+			proxies: proxies,
+			remote:  "198.51.100.9:1234",
+			headers: map[string]string{"X-Forwarded-For": "203.0.113.7", "X-Real-IP": "203.0.113.8"},
+			want:    "198.51.100.9",
+		},
+		{
+			name:      "x-forwarded-for through trusted hops",
+			proxies:   proxies,
+			remote:    "10.0.0.1:1234",
+			headers:   map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.7, 10.1.2.3"},
+			want:      "203.0.113.7",
+			wantChain: []string{"198.51.100.1", "203.0.113.7", "10.1.2.3", "10.0.0.1"},
+		},
+		{
+			name:      "all hops trusted",
+			proxies:   proxies,
+			remote:    "10.0.0.1:1234",
+			headers:   map[string]string{"X-Forwarded-For": "10.9.9.9, 10.1.2.3"},
+			want:      "10.9.9.9",
+			wantChain: []string{"10.9.9.9", "10.1.2.3", "10.0.0.1"},
+		},
+		{
+			name:      "x-real-ip",
+			proxies:   withHeader("X-Real-IP"),
+			remote:    "10.0.0.1:1234",
+			headers:   map[string]string{"X-Real-IP": "203.0.113.7"},
+			want:      "203.0.113.7",
+			wantChain: []string{"203.0.113.7", "10.0.0.1"},
+		},
+		{
+			name:    "forwarded",
+			proxies: withHeader("Forwarded"),
+			remote:  "[2001:db8::1]:443",
+			headers: map[string]string{
+				"Forwarded":       `for="[2001:db8:cafe::17]:4711";proto=https, For=203.0.113.7:8080;by=10.0.0.2, for=10.1.2.3`,
+				"X-Forwarded-For": "198.51.100.1",
+			},
+			want:      "203.0.113.7",
+			wantChain: []string{"[2001:db8:cafe::17]:4711", "203.0.113.7:8080", "10.1.2.3", "2001:db8::1"},
+		},
+		{
+			name:      "obfuscated hop stops at the reporting proxy",
+			proxies:   withHeader("forwarded"),
+			remote:    "10.0.0.1:1234",
+			headers:   map[string]string{"Forwarded": `for=203.0.113.7, for=unknown, for=10.1.2.3`},
+			want:      "10.1.2.3",
+			wantChain: []string{"203.0.113.7", "unknown", "10.1.2.3", "10.0.0.1"},
+		},
+		{
+			name:      "client-injected forwarded is ignored",
+			proxies:   proxies,
+			remote:    "10.0.0.1:1234",
+			headers:   map[string]string{"Forwarded": "for=6.6.6.6", "X-Forwarded-For": "203.0.113.7"},
+			want:      "203.0.113.7",
+			wantChain: []string{"203.0.113.7", "10.0.0.1"},
+		},
+		{
+			name:    "client-injected x-forwarded-for is ignored",
+			proxies: withHeader("X-Real-IP"),
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "6.6.6.6"},
+			want:    "10.0.0.1",
+		},
+		{
+			name:      "ipv4-mapped peer",
+			proxies:   proxies,
+			remote:    "[::ffff:10.0.0.1]:1234",
+			headers:   map[string]string{"X-Forwarded-For": "203.0.113.7"},
+			want:      "203.0.113.7",
+			wantChain: []string{"203.0.113.7", "::ffff:10.0.0.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/orders", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			ip, chain := tt.proxies.ClientIP(req)
+			if ip != tt.want {
+				t.Errorf("ClientIP = %q, want %q", ip, tt.want)
+			}
+			if !slices.Equal(chain, tt.wantChain) {
+				t.Errorf("chain = %q, want %q", chain, tt.wantChain)
+			}
+		})
+	}
+}
+
+func TestHandler_RecordsForwardedClient(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxies.RecordChain = true
+
+	repo := &mockRepo{}
+	mw := NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+		WithTrustedProxies(proxies),
+	)
+
+	h := mw.Handler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/v1/orders", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	mw.Shutdown()
+
+	entries := repo.getEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(entries))
+	}
+	if entries[0].IP != "203.0.113.7" {
+		t.Errorf("IP = %q, want the forwarded client", entries[0].IP)
+	}
+	chain, _ := entries[0].Details["forwarded_chain"].([]string)
+	if !slices.Equal(chain, []string{"203.0.113.7", "10.0.0.1"}) {
+		t.Errorf("forwarded_chain = %v", entries[0].Details["forwarded_chain"])
+	}
+}
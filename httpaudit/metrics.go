@@ -0,0 +1,37 @@
+package httpaudit
+
+import (
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// WithMetrics reports the pipeline measurements to metrics: entries
+// enqueued, dropped, spilled, persisted, retried, dead-lettered and failed,
+// write latency and queue depth (see the audit.Metric* names). Use
+// audit.NewExpvarMetrics or an adapter to another metrics system.
+func WithMetrics(metrics audit.Metrics) Option {
+	return func(m *AuditMiddleware) {
+		if metrics != nil {
+			m.metrics = metrics
+		}
+	}
+}
+
+// enqueued records that an entry entered the queue.
+func (m *AuditMiddleware) enqueued() {
+	m.metrics.Add(audit.MetricEnqueued, 1)
+	m.metrics.Set(audit.MetricQueueDepth, int64(len(m.jobs)))
+}
+
+// observeWrite records the latency and result of a repository write.
+func (m *AuditMiddleware) observeWrite(op string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.metrics.Observe(audit.MetricWriteDuration, time.Since(start),
+		audit.Label{Key: "op", Value: op},
+		audit.Label{Key: "result", Value: result},
+	)
+}
@@ -0,0 +1,124 @@
+package httpaudit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// recordingMetrics sums counters and counts histogram samples per metric
+// name, ignoring labels except for the result of write durations.
+type recordingMetrics struct {
+	mu       sync.Mutex
+	counters map[string]int64
+	gauges   map[string]int64
+	samples  map[string]int
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{
+		counters: map[string]int64{},
+		gauges:   map[string]int64{},
+		samples:  map[string]int{},
+	}
+}
+
+func (r *recordingMetrics) Add(name string, delta int64, _ ...audit.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters[name] += delta
+}
+
+func (r *recordingMetrics) Set(name string, value int64, _ ...audit.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges[name] = value
+}
+
+func (r *recordingMetrics) Observe(name string, _ time.Duration, labels ...audit.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range labels {
+		if l.Key == "result" {
+			name += "/" + l.Value
+		}
+	}
+	r.samples[name]++
+}
+
+func (r *recordingMetrics) counter(name string) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counters[name]
+}
+
+func (r *recordingMetrics) sampleCount(name string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.samples[name]
+}
+
+func TestMetrics_EnqueueAndPersist(t *testing.T) {
+	metrics := newRecordingMetrics()
+	repo := &flakyRepo{failures: 1, err: errors.New("connection reset")}
+	mw := NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+		WithMetrics(metrics),
+		WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}),
+	)
+
+	serveOrders(mw, "1", "2")
+	mw.Shutdown()
+
+	if got := metrics.counter(audit.MetricEnqueued); got != 2 {
+		t.Errorf("enqueued = %d, want 2", got)
+	}
+	if got := metrics.counter(audit.MetricPersisted); got != 2 {
+		t.Errorf("persisted = %d, want 2", got)
+	}
+	if got := metrics.counter(audit.MetricRetried); got != 1 {
+		t.Errorf("retried = %d, want 1", got)
+	}
+	if ok, failed := metrics.sampleCount(audit.MetricWriteDuration+"/ok"), metrics.sampleCount(audit.MetricWriteDuration+"/error"); ok != 2 || failed != 1 {
+		t.Errorf("write samples ok=%d error=%d, want 2 and 1", ok, failed)
+	}
+}
+
+func TestMetrics_Drop(t *testing.T) {
+	metrics := newRecordingMetrics()
+	mw := newStalledMiddleware(&mockRepo{}, 1, OverflowDropNewest)
+	mw.metrics = metrics
+
+	serveOrder(mw, "first")
+	serveOrder(mw, "second")
+
+	if got := metrics.counter(audit.MetricDropped); got != 1 {
+		t.Errorf("dropped = %d, want 1", got)
+	}
+	if got := metrics.gauges[audit.MetricQueueDepth]; got != 1 {
+		t.Errorf("queue depth = %d, want 1", got)
+	}
+}
+
+func TestMetrics_FailedAndDeadLettered(t *testing.T) {
+	metrics := newRecordingMetrics()
+	repo := &flakyRepo{failures: 10, err: &sqlStateError{"23505"}}
+	mw := newRetryMiddleware(repo, WithMetrics(metrics))
+	defer mw.Shutdown()
+
+	mw.persist(context.Background(), spillEntry(t, "ord-1"))
+	if got := metrics.counter(audit.MetricFailed); got != 1 {
+		t.Errorf("failed = %d, want 1", got)
+	}
+
+	mw.deadLetter = &recordingSink{}
+	mw.persist(context.Background(), spillEntry(t, "ord-2"))
+	if got := metrics.counter(audit.MetricDeadLettered); got != 1 {
+		t.Errorf("dead-lettered = %d, want 1", got)
+	}
+}
@@ -0,0 +1,682 @@
+// Package httpaudit provides a net/http audit logging middleware with a
+// fixed-size worker pool for asynchronous persistence. It works with any
+// router: a RouteResolver derives the audited resource from the matched
+// route. The default resolver reads Go 1.22+ http.ServeMux patterns; the
+// chiware package provides one for chi.
+package httpaudit
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+const (
+	defaultWorkers      = 4
+	defaultQueueSize    = 256
+	defaultWriteTimeout = 5 * time.Second
+)
+
+// UserInfo carries the authenticated user identity extracted by the host application.
+// TenantID is optional and scopes the entry in multi-tenant deployments.
+//
+// UserID and Username are the real actor. When the actor works on behalf of
+// someone else (support impersonation, a service account acting for a
+// user), SubjectID and SubjectName identify that effective subject.
+type UserInfo struct {
+	TenantID    string
+	UserID      string
+	Username    string
+	ActorType   audit.ActorType
+	SubjectID   string
+	SubjectName string
+	AuthMethod  string
+	Roles       []string
+}
+
+// UserExtractor is a function that retrieves the current user from the
+// request context.  Each host application injects its own implementation
+// (e.g. from Zitadel, Keycloak, etc.).
+type UserExtractor func(context.Context) *UserInfo
+
+// ActionMapper derives the audit action recorded for a request.
+type ActionMapper func(*http.Request) audit.Action
+
+// Option configures an AuditMiddleware.
+type Option func(*AuditMiddleware)
+
+// WithActionMapper replaces the default HTTP method mapping (MethodToAction)
+// with fn. Actions returned by fn must be built-in or registered with
+// audit.RegisterAction; requests mapped to an unknown action are not
+// audited and an error is logged.
+func WithActionMapper(fn ActionMapper) Option {
+	return func(m *AuditMiddleware) {
+		m.actionMapper = fn
+	}
+}
+
+// WithWorkers sets the number of goroutines persisting entries. Values
+// below 1 are ignored.
+func WithWorkers(n int) Option {
+	return func(m *AuditMiddleware) {
+		if n > 0 {
+			m.workers = n
+		}
+	}
+}
+
+// WithQueueSize sets the capacity of the queue between request handlers
+// and workers. Zero makes the queue unbuffered, so an entry is only
+// accepted while a worker is idle; negative values are ignored.
+func WithQueueSize(n int) Option {
+	return func(m *AuditMiddleware) {
+		if n >= 0 {
+			m.queueSize = n
+		}
+	}
+}
+
+// WithWriteTimeout bounds each repository write. Values of zero or less
+// are ignored.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(m *AuditMiddleware) {
+		if d > 0 {
+			m.writeTimeout = d
+		}
+	}
+}
+
+// WithClock overrides the clock used to time requests, e.g. in tests.
+// Entries are timestamped when the request starts, not when a worker
+// persists them. A nil clock is ignored.
+func WithClock(now func() time.Time) Option {
+	return func(m *AuditMiddleware) {
+		if now != nil {
+			m.now = now
+		}
+	}
+}
+
+// WithLoggerAttrs adds attributes (slog key-value pairs or slog.Attr
+// values) to every log record emitted by the middleware, e.g.
+// "service", "billing".
+func WithLoggerAttrs(args ...any) Option {
+	return func(m *AuditMiddleware) {
+		m.logger = m.logger.With(args...)
+	}
+}
+
+// WithSkip sets a predicate evaluated after the handler has run; requests
+// for which it returns true are not audited (e.g. health checks).
+func WithSkip(fn func(*http.Request) bool) Option {
+	return func(m *AuditMiddleware) {
+		m.skip = fn
+	}
+}
+
+// WithRequestInfo makes Handler resolve the user, correlation ID, client
+// and route-derived resource before calling the next handler, and attach
+// them to the request context with audit.WithMutableInfo. Downstream code
+// sees them through audit.InfoFrom, e.g. for the session variables set by
+// pgxaudit.AuditPool, and can change them with audit.UpdateInfo:
+//
+//	audit.UpdateInfo(r.Context(), func(i *audit.Info) { i.ResourceID = order.ID })
+//
+// The entry is built from the Info as it is when the handler returns; if
+// its resource is still empty, it is resolved from the routed request. A
+// request is audited if the extractor returned a user or the Info has a
+// UserID, so an authentication middleware further down the chain can set
+// the user with audit.UpdateInfo.
+func WithRequestInfo() Option {
+	return func(m *AuditMiddleware) {
+		m.earlyInfo = true
+	}
+}
+
+// WithCorrelationID replaces ExtractCorrelationID as the function reading
+// the correlation ID of a request, e.g. to use a request ID set by a router
+// middleware. A nil function is ignored.
+func WithCorrelationID(fn func(*http.Request) string) Option {
+	return func(m *AuditMiddleware) {
+		if fn != nil {
+			m.correlation = fn
+		}
+	}
+}
+
+// MethodActionMapper returns an ActionMapper that uses overrides for the
+// listed HTTP methods and MethodToAction for all others, e.g.
+// {"GET": "ACCESS"} after registering the ACCESS action.
+func MethodActionMapper(overrides map[string]audit.Action) ActionMapper {
+	return func(r *http.Request) audit.Action {
+		if a, ok := overrides[r.Method]; ok {
+			return a
+		}
+		return MethodToAction(r.Method)
+	}
+}
+
+// auditJob holds the captured data needed to write a single audit entry.
+type auditJob struct {
+	tenantID      string
+	userID        string
+	username      string
+	actorType     audit.ActorType
+	subjectID     string
+	subjectName   string
+	authMethod    string
+	roles         []string
+	correlationID string
+	action        audit.Action
+	resource      string
+	resourceID    string
+	ip            string
+	userAgent     string
+	outcome       audit.Outcome
+	severity      audit.Severity
+	reason        string
+	details       map[string]any
+	createdAt     time.Time // request start
+
+	// built is the entry already built for the spool, and record its
+	// spool record, acked once the entry is persisted.
+	built  *audit.AuditLog
+	record *SpoolRecord
+}
+
+// AuditMiddleware records an audit log entry for every authenticated request.
+// It uses a fixed-size worker pool with a buffered channel to provide
+// backpressure instead of spawning unbounded goroutines.
+type AuditMiddleware struct {
+	repo         audit.AuditRepository
+	logger       *slog.Logger
+	extractor    UserExtractor
+	actionMapper ActionMapper
+	skip         func(*http.Request) bool
+	earlyInfo    bool
+	resolver     RouteResolver
+	resources    ResourceRules
+	proxies      TrustedProxies
+	correlation  func(*http.Request) string
+	workers      int
+	queueSize    int
+	writeTimeout time.Duration
+	now          func() time.Time
+	jobs         chan auditJob
+	wg           sync.WaitGroup
+
+	overflow      OverflowPolicy
+	blockTimeout  time.Duration
+	spill         SpillBuffer
+	spillInterval time.Duration
+	stopDrain     chan struct{}
+	drainWG       sync.WaitGroup
+
+	spool    *Spool
+	replayWG sync.WaitGroup
+
+	retry      RetryPolicy
+	deadLetter DeadLetterSink
+	stats      stats
+
+	batchSize     int
+	batchInterval time.Duration
+
+	metrics audit.Metrics
+}
+
+// NewAuditMiddleware creates an AuditMiddleware backed by repo.
+// The extractor function is called on each request to obtain the current user;
+// if it returns nil the request is not audited.
+//
+// Without options it runs 4 workers behind a 256-entry queue, bounds each
+// write to 5 seconds and discards new entries while the queue is full.
+func NewAuditMiddleware(repo audit.AuditRepository, logger *slog.Logger, extractor UserExtractor, opts ...Option) *AuditMiddleware {
+	m := &AuditMiddleware{
+		repo:         repo,
+		logger:       logger,
+		extractor:    extractor,
+		workers:      defaultWorkers,
+		queueSize:    defaultQueueSize,
+		writeTimeout: defaultWriteTimeout,
+		now:          time.Now,
+		metrics:      audit.NopMetrics{},
+		resolver:     ServeMuxResolver{},
+		correlation:  ExtractCorrelationID,
+
+		blockTimeout:  defaultBlockTimeout,
+		spillInterval: defaultSpillInterval,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.jobs = make(chan auditJob, m.queueSize)
+
+	batchRepo, batching := m.repo.(audit.BatchRepository)
+	if !batching && m.batchSize > 1 {
+		m.logger.Warn("audit repository does not implement audit.BatchRepository, writing entries one at a time",
+			"batch_size", m.batchSize,
+		)
+	}
+	batching = batching && m.batchSize > 1
+
+	m.wg.Add(m.workers)
+	for range m.workers {
+		if batching {
+			go m.batchWorker(batchRepo)
+		} else {
+			go m.worker()
+		}
+	}
+
+	if m.spill != nil {
+		m.stopDrain = make(chan struct{})
+		m.drainWG.Add(1)
+		go m.drainSpill()
+	}
+
+	if m.spool != nil {
+		m.replayWG.Add(1)
+		go m.replaySpool()
+	}
+
+	return m
+}
+
+// worker reads jobs from the channel until it is closed.
+func (m *AuditMiddleware) worker() {
+	defer m.wg.Done()
+
+	for job := range m.jobs {
+		m.metrics.Set(audit.MetricQueueDepth, int64(len(m.jobs)))
+		m.write(context.Background(), job)
+	}
+}
+
+// write builds the entry for job and persists it.
+func (m *AuditMiddleware) write(ctx context.Context, job auditJob) {
+	entry, err := job.entry()
+	if err != nil {
+		m.logger.Error("failed to create audit log entry", "error", err)
+		return
+	}
+	if err := m.persist(ctx, entry); err == nil {
+		m.ack(job)
+	}
+}
+
+// persist writes entry to the repository, retrying transient failures
+// according to the retry policy, and hands it to the dead-letter sink if it
+// cannot be written. It returns nil once the entry is persisted or
+// dead-lettered.
+func (m *AuditMiddleware) persist(ctx context.Context, entry *audit.AuditLog) error {
+	attempts := max(m.retry.MaxAttempts, 1)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = m.create(ctx, entry); err == nil {
+			m.metrics.Add(audit.MetricPersisted, 1)
+			return nil
+		}
+		if attempt >= attempts || !m.retry.Retryable(err) {
+			break
+		}
+		m.logger.Warn("audit log write failed, retrying",
+			"error", err,
+			"attempt", attempt,
+			"entry_id", entry.ID,
+		)
+		m.stats.retried.Add(1)
+		m.metrics.Add(audit.MetricRetried, 1)
+		if !sleep(ctx, m.retry.delay(attempt)) {
+			break
+		}
+	}
+
+	m.logger.Error("failed to persist audit log entry",
+		"error", err,
+		"user_id", entry.UserID,
+		"resource", entry.Resource,
+		"action", entry.Action,
+	)
+
+	if m.deadLetter != nil {
+		dlCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), m.writeTimeout)
+		dlErr := m.deadLetter.DeadLetter(dlCtx, entry, err)
+		cancel()
+		if dlErr == nil {
+			m.stats.deadLettered.Add(1)
+			m.metrics.Add(audit.MetricDeadLettered, 1)
+			return nil
+		}
+		m.logger.Error("failed to dead-letter audit log entry",
+			"error", dlErr,
+			"entry_id", entry.ID,
+		)
+	}
+
+	m.stats.failed.Add(1)
+	m.metrics.Add(audit.MetricFailed, 1)
+	return err
+}
+
+// create makes a single repository write within the write timeout.
+func (m *AuditMiddleware) create(ctx context.Context, entry *audit.AuditLog) error {
+	ctx, cancel := context.WithTimeout(ctx, m.writeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := m.repo.Create(ctx, entry)
+	m.observeWrite("create", start, err)
+	return err
+}
+
+// entry builds the audit log entry described by j.
+func (j auditJob) entry() (*audit.AuditLog, error) {
+	if j.built != nil {
+		return j.built, nil
+	}
+	return audit.New(j.action, j.resource,
+		audit.WithTenant(j.tenantID),
+		audit.WithActor(j.userID, j.username),
+		audit.WithActorType(j.actorType),
+		audit.WithSubject(j.subjectID, j.subjectName),
+		audit.WithAuth(j.authMethod, j.roles...),
+		audit.WithCorrelationID(j.correlationID),
+		audit.WithResourceID(j.resourceID),
+		audit.WithClient(j.ip, j.userAgent),
+		audit.WithOutcome(j.outcome, j.reason),
+		audit.WithSeverity(j.severity),
+		audit.WithDetails(j.details),
+		audit.WithOccurredAt(j.createdAt),
+	)
+}
+
+// Shutdown closes the job channel and waits for all workers to finish.
+// Call this after http.Server.Shutdown to avoid losing in-flight entries.
+//
+// Shutdown first waits for the replay of a Spool passed to WithSpool to be
+// queued. The spool is not closed; close it after Shutdown.
+func (m *AuditMiddleware) Shutdown() {
+	m.replayWG.Wait()
+
+	close(m.jobs)
+	m.wg.Wait()
+
+	if m.spill != nil {
+		close(m.stopDrain)
+		m.drainWG.Wait()
+		m.drainSpillOnce()
+	}
+}
+
+// Handler returns the middleware function, compatible with any router
+// accepting func(http.Handler) http.Handler middlewares.
+func (m *AuditMiddleware) Handler() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := m.now()
+			ww := newResponseWriter(w)
+			state := &requestState{}
+			ctx := context.WithValue(r.Context(), stateKey{}, state)
+
+			var user *UserInfo
+			if m.earlyInfo {
+				user = m.extractor(ctx)
+				resource, resourceID, _ := m.resolveResource(r)
+				ctx = audit.WithMutableInfo(ctx, m.requestInfo(r, user, resource, resourceID))
+			}
+
+			r = r.WithContext(ctx)
+			body := countBody(r)
+
+			next.ServeHTTP(ww, r)
+			end := m.now()
+
+			policy := state.policy
+			if policy.Skip || m.skip != nil && m.skip(r) {
+				return
+			}
+
+			var info audit.Info
+			if m.earlyInfo {
+				info = *audit.InfoFrom(r.Context())
+			} else {
+				user = m.extractor(r.Context())
+			}
+			anonymous := user == nil && info.UserID == ""
+			if anonymous && !policy.AllowAnonymous {
+				return
+			}
+			// The route is resolved again once routed, for the parents
+			// and, without the early Info, the resource.
+			resource, resourceID, parents := m.resolveResource(r)
+			switch {
+			case !m.earlyInfo:
+				if policy.Resource != "" {
+					resource = policy.Resource
+				}
+				info = m.requestInfo(r, user, resource, resourceID)
+			case info.Resource == "":
+				// The route could not be resolved before routing.
+				info.Resource = resource
+				if info.ResourceID == "" {
+					info.ResourceID = resourceID
+				}
+			}
+			if anonymous {
+				info.UserID = AnonymousUserID
+			}
+
+			// Skip auditing the audit endpoint itself.
+			if info.Resource == "audit" {
+				return
+			}
+
+			action := policy.Action
+			if action == "" {
+				action = m.mapAction(r)
+			}
+			if !action.IsValid() {
+				m.logger.Error("unregistered audit action, skipping entry",
+					"action", action,
+					"resource", info.Resource,
+				)
+				return
+			}
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			outcome, severity, reason := StatusOutcome(status)
+
+			job := auditJob{
+				tenantID:      info.TenantID,
+				userID:        info.UserID,
+				username:      info.Username,
+				actorType:     info.ActorType,
+				subjectID:     info.SubjectID,
+				subjectName:   info.SubjectName,
+				authMethod:    info.AuthMethod,
+				roles:         info.Roles,
+				correlationID: info.CorrelationID,
+				action:        action,
+				resource:      info.Resource,
+				resourceID:    info.ResourceID,
+				ip:            info.IP,
+				userAgent:     info.UserAgent,
+				outcome:       outcome,
+				severity:      severity,
+				reason:        reason,
+				details:       requestDetails(r, status, body.n, ww.BytesWritten(), start, end),
+				createdAt:     start,
+			}
+			if len(parents) > 0 {
+				job.details["parents"] = parentsDetail(parents)
+			}
+			if state.body != nil {
+				state.body.addTo(job.details)
+			}
+			if m.proxies.RecordChain {
+				if _, chain := m.proxies.ClientIP(r); chain != nil {
+					job.details["forwarded_chain"] = chain
+				}
+			}
+			if m.spool != nil {
+				m.spoolJob(&job)
+			}
+
+			if policy.Sync {
+				m.write(context.WithoutCancel(r.Context()), job)
+				return
+			}
+			m.enqueue(r, job)
+		})
+	}
+}
+
+// requestInfo returns the audit.Info of a request made by user, which may
+// be nil, on the given resource.
+func (m *AuditMiddleware) requestInfo(r *http.Request, user *UserInfo, resource, resourceID string) audit.Info {
+	ip, _ := m.proxies.ClientIP(r)
+	info := audit.Info{
+		CorrelationID: m.correlation(r),
+		Resource:      resource,
+		ResourceID:    resourceID,
+		IP:            ip,
+		UserAgent:     r.UserAgent(),
+	}
+	if user != nil {
+		info.TenantID = user.TenantID
+		info.UserID = user.UserID
+		info.Username = user.Username
+		info.ActorType = user.ActorType
+		info.SubjectID = user.SubjectID
+		info.SubjectName = user.SubjectName
+		info.AuthMethod = user.AuthMethod
+		info.Roles = user.Roles
+	}
+	return info
+}
+
+// mapAction returns the action for r, falling back to MethodToAction when
+// no mapper is configured.
+func (m *AuditMiddleware) mapAction(r *http.Request) audit.Action {
+	if m.actionMapper == nil {
+		return MethodToAction(r.Method)
+	}
+	return m.actionMapper(r)
+}
+
+// MethodToAction maps HTTP methods to audit Actions.
+func MethodToAction(method string) audit.Action {
+	switch method {
+	case http.MethodPost:
+		return audit.ActionCreate
+	case http.MethodPut, http.MethodPatch:
+		return audit.ActionUpdate
+	case http.MethodDelete:
+		return audit.ActionDelete
+	default:
+		return audit.ActionRead
+	}
+}
+
+// StatusOutcome derives the audit outcome, severity and failure reason from
+// an HTTP status code: 1xx-3xx succeed, 4xx fail with warning severity and
+// 5xx fail with error severity. The reason is the status text for failures.
+func StatusOutcome(status int) (audit.Outcome, audit.Severity, string) {
+	switch {
+	case status >= 500:
+		return audit.OutcomeFailure, audit.SeverityError, http.StatusText(status)
+	case status >= 400:
+		return audit.OutcomeFailure, audit.SeverityWarning, http.StatusText(status)
+	default:
+		return audit.OutcomeSuccess, audit.SeverityInfo, ""
+	}
+}
+
+// ExtractCorrelationID returns the request correlation ID from the
+// X-Correlation-ID or X-Request-ID header.
+func ExtractCorrelationID(r *http.Request) string {
+	if v := r.Header.Get("X-Correlation-ID"); v != "" {
+		return v
+	}
+	if v := r.Header.Get("X-Request-ID"); v != "" {
+		return v
+	}
+	if v := r.Header.Get("X-Request-Id"); v != "" {
+		return v
+	}
+	return ""
+}
+
+// ExtractIP strips the port from a host:port address. Behind proxies, see
+// TrustedProxies.
+func ExtractIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// requestDetails returns the details recorded for a request: its status,
+// method, duration in milliseconds, completion time, request and response
+// body sizes, and query parameters if any.
+func requestDetails(r *http.Request, status int, requestBytes int64, responseBytes int, start, end time.Time) map[string]any {
+	details := map[string]any{
+		"status_code":    status,
+		"method":         r.Method,
+		"duration_ms":    float64(end.Sub(start).Microseconds()) / 1000,
+		"completed_at":   end.UTC().Format(time.RFC3339Nano),
+		"request_bytes":  requestBytes,
+		"response_bytes": responseBytes,
+	}
+	if query := r.URL.Query(); len(query) > 0 {
+		params := make(map[string]any, len(query))
+		for key, values := range query {
+			if len(values) == 1 {
+				params[key] = values[0]
+				continue
+			}
+			list := make([]any, len(values))
+			for i, v := range values {
+				list[i] = v
+			}
+			params[key] = list
+		}
+		details["query"] = params
+	}
+	return details
+}
+
+// countingBody counts the bytes of the request body read by the handler.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// countBody replaces the body of r with a countingBody. Requests without a
+// body get a counter that stays at zero.
+func countBody(r *http.Request) *countingBody {
+	if r.Body == nil || r.Body == http.NoBody {
+		return &countingBody{}
+	}
+	body := &countingBody{ReadCloser: r.Body}
+	r.Body = body
+	return body
+}
@@ -0,0 +1,677 @@
+package httpaudit
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// ---------- Mock repository ----------
+
+type mockRepo struct {
+	mu      sync.Mutex
+	entries []*audit.AuditLog
+}
+
+func (m *mockRepo) Create(_ context.Context, entry *audit.AuditLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *mockRepo) GetByID(_ context.Context, _ uuid.UUID) (*audit.AuditLog, error) {
+	return nil, nil
+}
+
+func (m *mockRepo) List(_ context.Context, _ audit.AuditFilters) ([]audit.AuditLog, int, error) {
+	return nil, 0, nil
+}
+
+func (m *mockRepo) getEntries() []*audit.AuditLog {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp := make([]*audit.AuditLog, len(m.entries))
+	copy(cp, m.entries)
+	return cp
+}
+
+// ---------- MethodToAction ----------
+
+func TestMethodToAction(t *testing.T) {
+	tests := []struct {
+		method string
+		want   audit.Action
+	}{
+		{http.MethodPost, audit.ActionCreate},
+		{http.MethodPut, audit.ActionUpdate},
+		{http.MethodPatch, audit.ActionUpdate},
+		{http.MethodDelete, audit.ActionDelete},
+		{http.MethodGet, audit.ActionRead},
+		{http.MethodHead, audit.ActionRead},
+		{http.MethodOptions, audit.ActionRead},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			got := MethodToAction(tt.method)
+			if got != tt.want {
+				t.Errorf("MethodToAction(%s) = %s, want %s", tt.method, got, tt.want)
+			}
+		})
+	}
+}
+
+// ---------- ExtractIP ----------
+
+func TestExtractIP(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"host:port", "192.168.1.1:8080", "192.168.1.1"},
+		{"ipv6 with port", "[::1]:8080", "::1"},
+		{"bare IP no port", "192.168.1.1", "192.168.1.1"},
+		{"empty string", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExtractIP(tt.input)
+			if got != tt.want {
+				t.Errorf("ExtractIP(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// ---------- Middleware Handler ----------
+
+func TestHandler_AuditsAuthenticatedRequest(t *testing.T) {
+	repo := &mockRepo{}
+	logger := slog.Default()
+
+	mw := NewAuditMiddleware(repo, logger, func(_ context.Context) *UserInfo {
+		return &UserInfo{UserID: "u1", Username: "alice"}
+	})
+
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.HandleFunc("POST /v1/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/orders/ord-1", nil)
+	req.Header.Set("User-Agent", "TestAgent/1.0")
+	req.Header.Set("X-Correlation-ID", "corr-123")
+	req.RemoteAddr = "10.0.0.1:12345"
+	rec := httptest.NewRecorder()
+
+	r.ServeHTTP(rec, req)
+
+	// Shutdown flushes the worker queue.
+	mw.Shutdown()
+
+	entries := repo.getEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(entries))
+	}
+
+	e := entries[0]
+	if e.UserID != "u1" {
+		t.Errorf("UserID = %q, want %q", e.UserID, "u1")
+	}
+	if e.Action != audit.ActionCreate {
+		t.Errorf("Action = %s, want CREATE", e.Action)
+	}
+	if e.Resource != "orders" {
+		t.Errorf("Resource = %q, want %q", e.Resource, "orders")
+	}
+	if e.ResourceID != "ord-1" {
+		t.Errorf("ResourceID = %q, want %q", e.ResourceID, "ord-1")
+	}
+	if e.IP != "10.0.0.1" {
+		t.Errorf("IP = %q, want %q", e.IP, "10.0.0.1")
+	}
+	if e.UserAgent != "TestAgent/1.0" {
+		t.Errorf("UserAgent = %q, want %q", e.UserAgent, "TestAgent/1.0")
+	}
+	if e.CorrelationID != "corr-123" {
+		t.Errorf("CorrelationID = %q, want %q", e.CorrelationID, "corr-123")
+	}
+}
+
+func TestHandler_RecordsRequestTimingAndSizes(t *testing.T) {
+	repo := &mockRepo{}
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := []time.Time{start, start.Add(250 * time.Millisecond)}
+	var calls int
+
+	mw := NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+		WithClock(func() time.Time {
+			now := clock[min(calls, len(clock)-1)]
+			calls++
+			return now
+		}),
+	)
+
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.HandleFunc("POST /v1/orders", func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("created"))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/orders?format=csv&tag=a&tag=b", strings.NewReader(`{"total":10}`))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	mw.Shutdown()
+
+	entries := repo.getEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if !e.CreatedAt.Equal(start) {
+		t.Errorf("CreatedAt = %v, want the request start %v", e.CreatedAt, start)
+	}
+	d := e.Details
+	if d["duration_ms"] != 250.0 {
+		t.Errorf("duration_ms = %v, want 250", d["duration_ms"])
+	}
+	if d["completed_at"] != "2025-01-01T12:00:00.25Z" {
+		t.Errorf("completed_at = %v", d["completed_at"])
+	}
+	if d["request_bytes"] != int64(12) || d["response_bytes"] != 7 {
+		t.Errorf("request_bytes = %v, response_bytes = %v, want 12 and 7", d["request_bytes"], d["response_bytes"])
+	}
+	query, _ := d["query"].(map[string]any)
+	if query["format"] != "csv" || len(query["tag"].([]any)) != 2 {
+		t.Errorf("query = %v", d["query"])
+	}
+}
+
+func TestHandler_RequestInfoUpdatedByHandler(t *testing.T) {
+	repo := &mockRepo{}
+	mw := NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return nil },
+		WithRequestInfo(),
+	)
+
+	// Authentication runs inside the audit middleware and reports the
+	// user through the Info; the handler records the created resource.
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			audit.UpdateInfo(r.Context(), func(i *audit.Info) {
+				i.UserID = "u2"
+				i.Username = "bob"
+			})
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.Handle("POST /v1/orders", auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		audit.UpdateInfo(r.Context(), func(i *audit.Info) { i.ResourceID = "ord-9" })
+		w.WriteHeader(http.StatusCreated)
+	})))
+	mux.HandleFunc("GET /v1/public", func(w http.ResponseWriter, r *http.Request) {})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/orders", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/public", nil))
+	mw.Shutdown()
+
+	entries := repo.getEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected only the authenticated request audited, got %d entries", len(entries))
+	}
+	e := entries[0]
+	if e.UserID != "u2" || e.Username != "bob" || e.Resource != "orders" || e.ResourceID != "ord-9" {
+		t.Errorf("entry = user %q/%q resource %q/%q, want the updated Info", e.UserID, e.Username, e.Resource, e.ResourceID)
+	}
+}
+
+// lateResolver resolves a route only once the request is routed, like a
+// router that matched a route group but not the route yet.
+type lateResolver struct{}
+
+func (lateResolver) Route(r *http.Request) (Route, bool) {
+	if r.Pattern == "" {
+		return Route{Pattern: "/v1/*"}, true
+	}
+	return ServeMuxResolver{}.Route(r)
+}
+
+func TestHandler_RequestInfoResolvedAfterRouting(t *testing.T) {
+	repo := &mockRepo{}
+	mw := NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+		WithRequestInfo(),
+		WithRouteResolver(lateResolver{}),
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/orders/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	mw.Handler()(mux).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/orders/42", nil))
+	mw.Shutdown()
+
+	entries := repo.getEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(entries))
+	}
+	if e := entries[0]; e.Resource != "orders" || e.ResourceID != "42" {
+		t.Errorf("resource = %q, %q, want orders, 42", e.Resource, e.ResourceID)
+	}
+}
+
+func TestHandler_NoRequestInfoByDefault(t *testing.T) {
+	mw := NewAuditMiddleware(&mockRepo{}, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+	)
+	defer mw.Shutdown()
+
+	var seen *audit.Info
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.HandleFunc("GET /v1/orders", func(w http.ResponseWriter, r *http.Request) {
+		seen = audit.InfoFrom(r.Context())
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/orders", nil))
+
+	if seen != nil {
+		t.Errorf("expected no audit.Info without WithRequestInfo, got %+v", *seen)
+	}
+}
+
+func TestHandler_SkipsUnauthenticatedRequest(t *testing.T) {
+	repo := &mockRepo{}
+	logger := slog.Default()
+
+	mw := NewAuditMiddleware(repo, logger, func(_ context.Context) *UserInfo {
+		return nil // unauthenticated
+	})
+
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.HandleFunc("GET /v1/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/orders", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	mw.Shutdown()
+
+	if len(repo.getEntries()) != 0 {
+		t.Error("expected no audit entries for unauthenticated request")
+	}
+}
+
+func TestHandler_SkipsAuditResource(t *testing.T) {
+	repo := &mockRepo{}
+	logger := slog.Default()
+
+	mw := NewAuditMiddleware(repo, logger, func(_ context.Context) *UserInfo {
+		return &UserInfo{UserID: "u1", Username: "alice"}
+	})
+
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.HandleFunc("GET /v1/audit", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/audit", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	mw.Shutdown()
+
+	if len(repo.getEntries()) != 0 {
+		t.Error("expected no audit entries for audit resource")
+	}
+}
+
+func TestShutdown_DrainsQueue(t *testing.T) {
+	repo := &mockRepo{}
+	logger := slog.Default()
+
+	mw := NewAuditMiddleware(repo, logger, func(_ context.Context) *UserInfo {
+		return &UserInfo{UserID: "u1", Username: "alice"}
+	})
+
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.HandleFunc("GET /v1/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Fire multiple requests.
+	for i := range 10 {
+		req := httptest.NewRequest(http.MethodGet, "/v1/items/item-"+string(rune('0'+i)), nil)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+	}
+
+	mw.Shutdown()
+
+	entries := repo.getEntries()
+	if len(entries) != 10 {
+		t.Errorf("expected 10 audit entries after shutdown, got %d", len(entries))
+	}
+}
+
+func TestHandler_RecordsStatusCode(t *testing.T) {
+	repo := &mockRepo{}
+	logger := slog.Default()
+
+	mw := NewAuditMiddleware(repo, logger, func(_ context.Context) *UserInfo {
+		return &UserInfo{UserID: "u1", Username: "alice"}
+	})
+
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.HandleFunc("DELETE /v1/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodDelete, "/v1/orders/ord-99", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	mw.Shutdown()
+
+	entries := repo.getEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+
+	status, ok := entries[0].Details["status_code"]
+	if !ok {
+		t.Fatal("expected status_code in details")
+	}
+	if status != 204 {
+		t.Errorf("status_code = %v, want 204", status)
+	}
+}
+
+func TestHandler_QueueFullDiscardsEntry(t *testing.T) {
+	repo := &mockRepo{}
+	logger := slog.Default()
+
+	// Create middleware and immediately close workers so the queue fills up.
+	mw := &AuditMiddleware{
+		repo:   repo,
+		logger: logger,
+		extractor: func(_ context.Context) *UserInfo {
+			return &UserInfo{UserID: "u1", Username: "alice"}
+		},
+		now:         time.Now,
+		metrics:     audit.NopMetrics{},
+		resolver:    ServeMuxResolver{},
+		correlation: ExtractCorrelationID,
+		jobs:        make(chan auditJob), // unbuffered — always full
+	}
+
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.HandleFunc("GET /v1/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// This should not block; the entry is discarded.
+	done := make(chan struct{})
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, "/v1/orders", nil)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		// OK — request completed without blocking.
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler blocked on full queue")
+	}
+}
+
+func TestExtractCorrelationID(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "x-correlation-id", headers: map[string]string{"X-Correlation-ID": "corr-1"}, want: "corr-1"},
+		{name: "x-request-id", headers: map[string]string{"X-Request-ID": "req-1"}, want: "req-1"},
+		{name: "x-request-id-chi", headers: map[string]string{"X-Request-Id": "req-chi-1"}, want: "req-chi-1"},
+		{name: "none", headers: map[string]string{}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/orders", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			if got := ExtractCorrelationID(req); got != tt.want {
+				t.Errorf("ExtractCorrelationID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_CustomActionMapper(t *testing.T) {
+	audit.MustRegisterAction("EXPORT", audit.CategoryAccess)
+
+	repo := &mockRepo{}
+	mw := NewAuditMiddleware(repo, slog.Default(), func(_ context.Context) *UserInfo {
+		return &UserInfo{UserID: "u1", Username: "alice"}
+	}, WithActionMapper(func(r *http.Request) audit.Action {
+		if r.URL.Query().Get("format") == "csv" {
+			return "EXPORT"
+		}
+		return MethodToAction(r.Method)
+	}))
+
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.HandleFunc("GET /v1/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, url := range []string{"/v1/orders?format=csv", "/v1/orders"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, url, nil))
+	}
+	mw.Shutdown()
+
+	entries := repo.getEntries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	actions := map[audit.Action]bool{entries[0].Action: true, entries[1].Action: true}
+	if !actions["EXPORT"] || !actions[audit.ActionRead] {
+		t.Errorf("expected EXPORT and READ actions, got %v", actions)
+	}
+}
+
+func TestHandler_UnregisteredActionSkipped(t *testing.T) {
+	repo := &mockRepo{}
+	mw := NewAuditMiddleware(repo, slog.Default(), func(_ context.Context) *UserInfo {
+		return &UserInfo{UserID: "u1", Username: "alice"}
+	}, WithActionMapper(MethodActionMapper(map[string]audit.Action{http.MethodGet: "NOT_REGISTERED"})))
+
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.HandleFunc("GET /v1/orders", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("POST /v1/orders", func(w http.ResponseWriter, r *http.Request) {})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/orders", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/orders", nil))
+	mw.Shutdown()
+
+	entries := repo.getEntries()
+	if len(entries) != 1 || entries[0].Action != audit.ActionCreate {
+		t.Fatalf("expected only the POST to be audited, got %d entries", len(entries))
+	}
+}
+
+func TestStatusOutcome(t *testing.T) {
+	tests := []struct {
+		status       int
+		wantOutcome  audit.Outcome
+		wantSeverity audit.Severity
+		wantReason   string
+	}{
+		{http.StatusOK, audit.OutcomeSuccess, audit.SeverityInfo, ""},
+		{http.StatusFound, audit.OutcomeSuccess, audit.SeverityInfo, ""},
+		{http.StatusForbidden, audit.OutcomeFailure, audit.SeverityWarning, "Forbidden"},
+		{http.StatusServiceUnavailable, audit.OutcomeFailure, audit.SeverityError, "Service Unavailable"},
+	}
+
+	for _, tt := range tests {
+		outcome, severity, reason := StatusOutcome(tt.status)
+		if outcome != tt.wantOutcome || severity != tt.wantSeverity || reason != tt.wantReason {
+			t.Errorf("StatusOutcome(%d) = %s/%s/%q, want %s/%s/%q",
+				tt.status, outcome, severity, reason, tt.wantOutcome, tt.wantSeverity, tt.wantReason)
+		}
+	}
+}
+
+func TestHandler_RecordsOutcome(t *testing.T) {
+	repo := &mockRepo{}
+	mw := NewAuditMiddleware(repo, slog.Default(), func(_ context.Context) *UserInfo {
+		return &UserInfo{TenantID: "acme", UserID: "u1", Username: "alice"}
+	})
+
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.HandleFunc("DELETE /v1/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/v1/orders/ord-1", nil))
+	mw.Shutdown()
+
+	entries := repo.getEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Outcome != audit.OutcomeFailure || e.Severity != audit.SeverityWarning || e.Reason != "Forbidden" {
+		t.Errorf("outcome = %s/%s/%q, want failure/warning/Forbidden", e.Outcome, e.Severity, e.Reason)
+	}
+	if e.TenantID != "acme" {
+		t.Errorf("tenant = %q, want acme", e.TenantID)
+	}
+}
+
+func TestHandler_RecordsOnBehalfOfActor(t *testing.T) {
+	repo := &mockRepo{}
+	mw := NewAuditMiddleware(repo, slog.Default(), func(_ context.Context) *UserInfo {
+		return &UserInfo{
+			UserID:      "agent-7",
+			Username:    "support",
+			ActorType:   audit.ActorHuman,
+			SubjectID:   "cust-9",
+			SubjectName: "carol",
+			AuthMethod:  "oidc",
+			Roles:       []string{"support"},
+		}
+	})
+
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.HandleFunc("PUT /v1/accounts/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/v1/accounts/cust-9", nil))
+	mw.Shutdown()
+
+	entries := repo.getEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.UserID != "agent-7" || e.SubjectID != "cust-9" || e.SubjectName != "carol" {
+		t.Errorf("actor/subject = %q/%q/%q, want agent-7/cust-9/carol", e.UserID, e.SubjectID, e.SubjectName)
+	}
+	if e.ActorType != audit.ActorHuman || e.AuthMethod != "oidc" || len(e.Roles) != 1 || e.Roles[0] != "support" {
+		t.Errorf("actor model = %s/%q/%v", e.ActorType, e.AuthMethod, e.Roles)
+	}
+}
+
+// deadlineRepo records the deadline of the context passed to Create.
+type deadlineRepo struct {
+	mockRepo
+	deadline time.Time
+}
+
+func (d *deadlineRepo) Create(ctx context.Context, entry *audit.AuditLog) error {
+	d.deadline, _ = ctx.Deadline()
+	return d.mockRepo.Create(ctx, entry)
+}
+
+func TestNewAuditMiddleware_Options(t *testing.T) {
+	repo := &deadlineRepo{}
+	now := time.Date(2025, 3, 1, 9, 30, 0, 0, time.UTC)
+
+	mw := NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+		WithWorkers(1),
+		WithQueueSize(8),
+		WithWriteTimeout(time.Hour),
+		WithClock(func() time.Time { return now }),
+		WithSkip(func(r *http.Request) bool { return r.URL.Path == "/healthz" }),
+	)
+	if mw.workers != 1 || cap(mw.jobs) != 8 {
+		t.Errorf("workers/queue = %d/%d, want 1/8", mw.workers, cap(mw.jobs))
+	}
+
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("GET /v1/orders", func(w http.ResponseWriter, r *http.Request) {})
+
+	start := time.Now()
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/orders", nil))
+	mw.Shutdown()
+
+	entries := repo.getEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected only the non-skipped request to be audited, got %d", len(entries))
+	}
+	if !entries[0].CreatedAt.Equal(now) {
+		t.Errorf("CreatedAt = %v, want %v", entries[0].CreatedAt, now)
+	}
+	if repo.deadline.Before(start.Add(59 * time.Minute)) {
+		t.Errorf("write deadline = %v, want about an hour after %v", repo.deadline, start)
+	}
+}
+
+func TestNewAuditMiddleware_Defaults(t *testing.T) {
+	mw := NewAuditMiddleware(&mockRepo{}, slog.Default(), func(_ context.Context) *UserInfo { return nil },
+		WithWorkers(0),
+		WithQueueSize(-1),
+		WithWriteTimeout(0),
+	)
+	defer mw.Shutdown()
+
+	if mw.workers != defaultWorkers || cap(mw.jobs) != defaultQueueSize || mw.writeTimeout != defaultWriteTimeout {
+		t.Errorf("got workers=%d queue=%d timeout=%v, want defaults", mw.workers, cap(mw.jobs), mw.writeTimeout)
+	}
+}
@@ -0,0 +1,195 @@
+package httpaudit
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+const defaultBlockTimeout = 100 * time.Millisecond
+
+// OverflowPolicy decides what happens to an entry when the queue between
+// request handlers and workers is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropNewest discards the new entry with a warning (default).
+	OverflowDropNewest OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest queued entry to make room.
+	// With an unbuffered queue (WithQueueSize(0)) nothing is queued, so it
+	// discards the new entry like OverflowDropNewest.
+	OverflowDropOldest
+	// OverflowBlock waits up to the block timeout (see WithBlockTimeout)
+	// for room in the queue, then discards the new entry.
+	OverflowBlock
+	// OverflowSync writes the entry in the request goroutine, delaying the
+	// end of the request by one repository write.
+	OverflowSync
+	// OverflowSpill appends the entry to the SpillBuffer configured with
+	// WithSpill; it is persisted once the buffer is drained. Without a
+	// buffer the entry is discarded.
+	OverflowSpill
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowBlock:
+		return "block"
+	case OverflowSync:
+		return "sync"
+	case OverflowSpill:
+		return "spill"
+	}
+	return "unknown"
+}
+
+// WithOverflowPolicy sets the policy applied when the queue is full. Use
+// RouteOverflowPolicy to override it for individual routes.
+func WithOverflowPolicy(p OverflowPolicy) Option {
+	return func(m *AuditMiddleware) {
+		m.overflow = p
+	}
+}
+
+// WithBlockTimeout sets how long OverflowBlock waits for room in the queue.
+// Values of zero or less are ignored.
+func WithBlockTimeout(d time.Duration) Option {
+	return func(m *AuditMiddleware) {
+		if d > 0 {
+			m.blockTimeout = d
+		}
+	}
+}
+
+// requestState is shared between Handler and the middlewares and handlers
+// it wraps, so that per-route settings made further down the chain are
+// visible once the request completes.
+type requestState struct {
+	overflow    OverflowPolicy
+	hasOverflow bool
+
+	policy RoutePolicy
+	body   *capturingBody
+}
+
+type stateKey struct{}
+
+func stateFrom(ctx context.Context) *requestState {
+	s, _ := ctx.Value(stateKey{}).(*requestState)
+	return s
+}
+
+// RouteOverflowPolicy returns a middleware that overrides the overflow
+// policy for the routes it wraps, e.g. to never drop entries of
+// compliance-critical endpoints:
+//
+//	mux.Handle("DELETE /accounts/{id}", httpaudit.RouteOverflowPolicy(httpaudit.OverflowSync)(h))
+//
+// It has no effect outside an AuditMiddleware.Handler.
+func RouteOverflowPolicy(p OverflowPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s := stateFrom(r.Context()); s != nil {
+				s.overflow = p
+				s.hasOverflow = true
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// enqueue hands job to the workers, applying the overflow policy of the
+// request when the queue is full.
+func (m *AuditMiddleware) enqueue(r *http.Request, job auditJob) {
+	select {
+	case m.jobs <- job:
+		m.enqueued()
+		return
+	default:
+	}
+
+	policy := m.overflow
+	if s := stateFrom(r.Context()); s != nil && s.hasOverflow {
+		policy = s.overflow
+	}
+	if policy == OverflowDropOldest && cap(m.jobs) == 0 {
+		// There is no queued entry to make room by discarding.
+		policy = OverflowDropNewest
+	}
+
+	switch policy {
+	case OverflowDropOldest:
+		for {
+			select {
+			case m.jobs <- job:
+				m.enqueued()
+				return
+			default:
+			}
+			select {
+			case old := <-m.jobs:
+				m.discard(old, policy)
+			default:
+			}
+		}
+
+	case OverflowBlock:
+		timer := time.NewTimer(m.blockTimeout)
+		defer timer.Stop()
+		select {
+		case m.jobs <- job:
+			m.enqueued()
+		case <-timer.C:
+			m.discard(job, policy)
+		case <-r.Context().Done():
+			m.discard(job, policy)
+		}
+
+	case OverflowSync:
+		m.write(context.WithoutCancel(r.Context()), job)
+
+	case OverflowSpill:
+		if m.spill == nil {
+			m.discard(job, policy)
+			return
+		}
+		entry, err := job.entry()
+		if err != nil {
+			m.logger.Error("failed to create audit log entry", "error", err)
+			return
+		}
+		if err := m.spill.Append(entry); err != nil {
+			m.logger.Error("failed to spill audit log entry, discarding it",
+				"error", err,
+				"user_id", job.userID,
+				"resource", job.resource,
+				"action", job.action,
+			)
+			return
+		}
+		m.metrics.Add(audit.MetricSpilled, 1)
+		m.ack(job)
+
+	default:
+		m.discard(job, policy)
+	}
+}
+
+// discard logs that job is dropped because the queue is full. A spooled
+// entry stays in the spool and is replayed on the next start.
+func (m *AuditMiddleware) discard(job auditJob, policy OverflowPolicy) {
+	m.metrics.Add(audit.MetricDropped, 1, audit.Label{Key: "policy", Value: policy.String()})
+	m.logger.Warn("audit log queue full, discarding entry",
+		"policy", policy.String(),
+		"spooled", job.record != nil,
+		"user_id", job.userID,
+		"resource", job.resource,
+		"action", job.action,
+	)
+}
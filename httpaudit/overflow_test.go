@@ -0,0 +1,155 @@
+package httpaudit
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// newStalledMiddleware returns a middleware without workers whose queue has
+// the given capacity, so the overflow policy can be observed.
+func newStalledMiddleware(repo *mockRepo, capacity int, policy OverflowPolicy) *AuditMiddleware {
+	return &AuditMiddleware{
+		repo:   repo,
+		logger: slog.Default(),
+		extractor: func(_ context.Context) *UserInfo {
+			return &UserInfo{UserID: "u1", Username: "alice"}
+		},
+		writeTimeout: time.Second,
+		now:          time.Now,
+		metrics:      audit.NopMetrics{},
+		resolver:     ServeMuxResolver{},
+		correlation:  ExtractCorrelationID,
+		jobs:         make(chan auditJob, capacity),
+		overflow:     policy,
+		blockTimeout: 20 * time.Millisecond,
+	}
+}
+
+func serveOrder(mw *AuditMiddleware, id string, routeMW ...func(http.Handler) http.Handler) {
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for i := len(routeMW) - 1; i >= 0; i-- {
+		h = routeMW[i](h)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /v1/orders/{id}", h)
+	mw.Handler()(mux).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/orders/"+id, nil))
+}
+
+func TestOverflow_DropNewest(t *testing.T) {
+	mw := newStalledMiddleware(&mockRepo{}, 1, OverflowDropNewest)
+	serveOrder(mw, "first")
+	serveOrder(mw, "second")
+
+	if job := <-mw.jobs; job.resourceID != "first" {
+		t.Errorf("queued = %q, want the first entry kept", job.resourceID)
+	}
+}
+
+func TestOverflow_DropOldest(t *testing.T) {
+	mw := newStalledMiddleware(&mockRepo{}, 1, OverflowDropOldest)
+	serveOrder(mw, "first")
+	serveOrder(mw, "second")
+
+	if job := <-mw.jobs; job.resourceID != "second" {
+		t.Errorf("queued = %q, want the newest entry kept", job.resourceID)
+	}
+}
+
+func TestOverflow_DropOldestUnbuffered(t *testing.T) {
+	mw := newStalledMiddleware(&mockRepo{}, 0, OverflowDropOldest)
+	metrics := newRecordingMetrics()
+	mw.metrics = metrics
+
+	done := make(chan struct{})
+	go func() {
+		serveOrder(mw, "ord-1")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("request blocked on an unbuffered queue without an idle worker")
+	}
+	if n := metrics.counter(audit.MetricDropped); n != 1 {
+		t.Errorf("dropped = %d, want the new entry dropped", n)
+	}
+}
+
+func TestOverflow_BlockWaitsForRoom(t *testing.T) {
+	mw := newStalledMiddleware(&mockRepo{}, 0, OverflowBlock)
+	mw.blockTimeout = time.Second
+
+	received := make(chan auditJob, 1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		received <- <-mw.jobs
+	}()
+	serveOrder(mw, "ord-1")
+
+	select {
+	case job := <-received:
+		if job.resourceID != "ord-1" {
+			t.Errorf("received %q, want ord-1", job.resourceID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocked entry was not delivered")
+	}
+}
+
+func TestOverflow_BlockTimesOut(t *testing.T) {
+	mw := newStalledMiddleware(&mockRepo{}, 0, OverflowBlock)
+
+	start := time.Now()
+	serveOrder(mw, "ord-1")
+	if elapsed := time.Since(start); elapsed < mw.blockTimeout || elapsed > time.Second {
+		t.Errorf("request took %v, want about the %v block timeout", elapsed, mw.blockTimeout)
+	}
+}
+
+func TestOverflow_SyncWritesInRequest(t *testing.T) {
+	repo := &mockRepo{}
+	mw := newStalledMiddleware(repo, 0, OverflowSync)
+	serveOrder(mw, "ord-1")
+
+	if entries := repo.getEntries(); len(entries) != 1 || entries[0].ResourceID != "ord-1" {
+		t.Fatalf("expected the entry to be written before the request returned, got %v", entries)
+	}
+}
+
+func TestOverflow_RoutePolicyOverridesGlobal(t *testing.T) {
+	repo := &mockRepo{}
+	mw := newStalledMiddleware(repo, 0, OverflowDropNewest)
+
+	serveOrder(mw, "dropped")
+	serveOrder(mw, "kept", RouteOverflowPolicy(OverflowSync))
+
+	entries := repo.getEntries()
+	if len(entries) != 1 || entries[0].ResourceID != "kept" {
+		t.Fatalf("expected only the sync route to be written, got %v", entries)
+	}
+}
+
+func TestOverflow_SpillAndDrain(t *testing.T) {
+	repo := &mockRepo{}
+	mw := newStalledMiddleware(repo, 0, OverflowSpill)
+	mw.spill = NewFileSpill(filepath.Join(t.TempDir(), "audit.spill"))
+
+	serveOrder(mw, "ord-1")
+	if len(repo.getEntries()) != 0 {
+		t.Fatal("spilled entry must not be written synchronously")
+	}
+
+	mw.drainSpillOnce()
+	entries := repo.getEntries()
+	if len(entries) != 1 || entries[0].ResourceID != "ord-1" {
+		t.Fatalf("expected the spilled entry after draining, got %v", entries)
+	}
+}
@@ -0,0 +1,138 @@
+package httpaudit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+const defaultMaxBodyBytes = 64 << 10
+
+// AnonymousUserID is the user ID of entries recorded for unauthenticated
+// requests on routes with RoutePolicy.AllowAnonymous.
+const AnonymousUserID = "anonymous"
+
+// RoutePolicy is the audit policy of a route, declared with Policy.
+type RoutePolicy struct {
+	// Skip disables auditing of the route.
+	Skip bool
+
+	// AllowAnonymous audits the route even if no user is authenticated,
+	// e.g. failed logins. Such entries have the user ID AnonymousUserID.
+	AllowAnonymous bool
+
+	// Action, if set, replaces the action mapped from the request, e.g.
+	// CANCEL for POST /orders/{id}/cancel. It must be registered.
+	Action audit.Action
+
+	// Resource, if set, replaces the resource derived from the route.
+	Resource string
+
+	// Sync writes the entry in the request goroutine instead of queueing
+	// it, delaying the end of the request by one repository write.
+	Sync bool
+
+	// CaptureBody records the request body read by the handler in the
+	// "request_body" detail, as JSON if it is valid JSON and as a string
+	// otherwise. At most MaxBodyBytes are recorded, 64 KiB by default;
+	// longer bodies are recorded as a truncated string and flagged with
+	// "request_body_truncated". Use a RedactionPolicy to mask secrets.
+	CaptureBody  bool
+	MaxBodyBytes int
+}
+
+// merge returns p with the settings of q applied on top of it.
+func (p RoutePolicy) merge(q RoutePolicy) RoutePolicy {
+	p.Skip = p.Skip || q.Skip
+	p.AllowAnonymous = p.AllowAnonymous || q.AllowAnonymous
+	p.Sync = p.Sync || q.Sync
+	p.CaptureBody = p.CaptureBody || q.CaptureBody
+	if q.Action != "" {
+		p.Action = q.Action
+	}
+	if q.Resource != "" {
+		p.Resource = q.Resource
+	}
+	if q.MaxBodyBytes > 0 {
+		p.MaxBodyBytes = q.MaxBodyBytes
+	}
+	return p
+}
+
+// Policy returns a middleware that applies p to the routes it wraps, e.g.
+//
+//	mux.Handle("POST /orders/{id}/cancel", httpaudit.Policy(httpaudit.RoutePolicy{Action: "CANCEL", Sync: true})(h))
+//
+// Nested policies are combined: flags set by any of them apply, and the
+// innermost Action, Resource and MaxBodyBytes win. With WithRequestInfo, a
+// Resource is also set on the request's audit.Info. It has no effect
+// outside an AuditMiddleware.Handler.
+func Policy(p RoutePolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s := stateFrom(r.Context())
+			if s == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			s.policy = s.policy.merge(p)
+			if p.Resource != "" {
+				audit.UpdateInfo(r.Context(), func(i *audit.Info) { i.Resource = p.Resource })
+			}
+			if s.policy.CaptureBody && s.body == nil && r.Body != nil && r.Body != http.NoBody {
+				limit := s.policy.MaxBodyBytes
+				if limit <= 0 {
+					limit = defaultMaxBodyBytes
+				}
+				s.body = &capturingBody{ReadCloser: r.Body, limit: limit}
+				r.Body = s.body
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// capturingBody keeps up to limit bytes of the request body read by the
+// handler.
+type capturingBody struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *capturingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := b.limit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(n, room)])
+		b.truncated = b.truncated || n > room
+	} else if n > 0 {
+		b.truncated = true
+	}
+	return n, err
+}
+
+// addTo records the captured body in details.
+func (b *capturingBody) addTo(details map[string]any) {
+	if b.buf.Len() == 0 {
+		return
+	}
+	if b.truncated {
+		details["request_body"] = b.buf.String()
+		details["request_body_truncated"] = true
+		return
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b.buf.Bytes()))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err == nil && !dec.More() {
+		details["request_body"] = v
+		return
+	}
+	details["request_body"] = b.buf.String()
+}
@@ -0,0 +1,136 @@
+package httpaudit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// servePolicy serves a single request through a route wrapped in the given
+// policies, with a handler reading the whole body, and returns the entries
+// persisted once the middleware is shut down.
+func servePolicy(t *testing.T, user *UserInfo, pattern string, req *http.Request, policies ...RoutePolicy) []*audit.AuditLog {
+	t.Helper()
+	repo := &mockRepo{}
+	mw := NewAuditMiddleware(repo, slog.Default(), func(_ context.Context) *UserInfo { return user })
+
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	})
+	for i := len(policies) - 1; i >= 0; i-- {
+		h = Policy(policies[i])(h)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pattern, h)
+	mw.Handler()(mux).ServeHTTP(httptest.NewRecorder(), req)
+	mw.Shutdown()
+	return repo.getEntries()
+}
+
+var policyUser = &UserInfo{UserID: "u1"}
+
+func TestPolicy_Skip(t *testing.T) {
+	entries := servePolicy(t, policyUser, "GET /v1/orders/{id}",
+		httptest.NewRequest(http.MethodGet, "/v1/orders/o-1", nil), RoutePolicy{Skip: true})
+	if len(entries) != 0 {
+		t.Errorf("expected the skipped route not to be audited, got %d entries", len(entries))
+	}
+}
+
+func TestPolicy_AllowAnonymous(t *testing.T) {
+	entries := servePolicy(t, nil, "POST /v1/sessions",
+		httptest.NewRequest(http.MethodPost, "/v1/sessions", nil), RoutePolicy{AllowAnonymous: true})
+	if len(entries) != 1 || entries[0].UserID != AnonymousUserID {
+		t.Fatalf("expected one anonymous entry, got %v", entries)
+	}
+
+	entries = servePolicy(t, policyUser, "POST /v1/sessions",
+		httptest.NewRequest(http.MethodPost, "/v1/sessions", nil), RoutePolicy{AllowAnonymous: true})
+	if len(entries) != 1 || entries[0].UserID != "u1" {
+		t.Fatalf("expected the authenticated user to be kept, got %v", entries)
+	}
+}
+
+func TestPolicy_ActionAndResource(t *testing.T) {
+	audit.MustRegisterAction("CANCEL", audit.CategoryChange)
+
+	entries := servePolicy(t, policyUser, "POST /v1/orders/{id}/cancel",
+		httptest.NewRequest(http.MethodPost, "/v1/orders/o-1/cancel", nil),
+		RoutePolicy{Resource: "orders"}, RoutePolicy{Action: "CANCEL"})
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(entries))
+	}
+	if e := entries[0]; e.Action != "CANCEL" || e.Resource != "orders" || e.ResourceID != "o-1" {
+		t.Errorf("entry = %s %s/%s, want CANCEL orders/o-1", e.Action, e.Resource, e.ResourceID)
+	}
+}
+
+func TestPolicy_Sync(t *testing.T) {
+	repo := &mockRepo{}
+	mw := newStalledMiddleware(repo, 0, OverflowDropNewest)
+
+	mux := http.NewServeMux()
+	mux.Handle("DELETE /v1/accounts/{id}", Policy(RoutePolicy{Sync: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	mw.Handler()(mux).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/v1/accounts/a-1", nil))
+
+	if entries := repo.getEntries(); len(entries) != 1 || entries[0].ResourceID != "a-1" {
+		t.Fatalf("expected the entry to be written before the request returned, got %v", entries)
+	}
+}
+
+func TestPolicy_CaptureBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		policy        RoutePolicy
+		want          string
+		wantTruncated bool
+	}{
+		{name: "json", body: `{"amount": 12345678901234567890, "note": "x"}`, policy: RoutePolicy{CaptureBody: true}, want: `{"amount":12345678901234567890,"note":"x"}`},
+		{name: "text", body: "plain text", policy: RoutePolicy{CaptureBody: true}, want: `"plain text"`},
+		{name: "truncated", body: `{"a": 1}`, policy: RoutePolicy{CaptureBody: true, MaxBodyBytes: 4}, want: `"{\"a\""`, wantTruncated: true},
+		{name: "disabled", body: `{"a": 1}`, policy: RoutePolicy{}, want: "null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := servePolicy(t, policyUser, "POST /v1/payments",
+				httptest.NewRequest(http.MethodPost, "/v1/payments", strings.NewReader(tt.body)), tt.policy)
+			if len(entries) != 1 {
+				t.Fatalf("expected 1 audit entry, got %d", len(entries))
+			}
+
+			got, err := json.Marshal(entries[0].Details["request_body"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("request_body = %s, want %s", got, tt.want)
+			}
+			if truncated := entries[0].Details["request_body_truncated"] == true; truncated != tt.wantTruncated {
+				t.Errorf("request_body_truncated = %v, want %v", truncated, tt.wantTruncated)
+			}
+			if n := entries[0].Details["request_bytes"]; n != int64(len(tt.body)) {
+				t.Errorf("request_bytes = %v, want %d", n, len(tt.body))
+			}
+		})
+	}
+}
+
+func TestPolicy_OutsideMiddleware(t *testing.T) {
+	called := false
+	h := Policy(RoutePolicy{Skip: true, CaptureBody: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader("x")))
+	if !called {
+		t.Error("expected the handler to be called")
+	}
+}
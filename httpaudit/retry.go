@@ -0,0 +1,219 @@
+package httpaudit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+const (
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	defaultRetryMaxDelay  = 5 * time.Second
+)
+
+// RetryPolicy configures how the workers retry failed repository writes.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of writes tried per entry, including
+	// the first. Values below 2 disable retries.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry; it doubles on every
+	// subsequent retry up to MaxDelay. Default 100ms and 5s.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter randomly shortens each delay by up to this fraction (0 to 1)
+	// so that workers retrying together do not hit the database in step.
+	Jitter float64
+	// Retryable classifies errors; permanent errors go straight to the
+	// dead-letter sink. Defaults to IsRetryable.
+	Retryable func(error) bool
+}
+
+// WithRetry makes the workers retry failed writes according to p. Entries
+// that still fail are handed to the sink set with WithDeadLetter.
+func WithRetry(p RetryPolicy) Option {
+	return func(m *AuditMiddleware) {
+		if p.BaseDelay <= 0 {
+			p.BaseDelay = defaultRetryBaseDelay
+		}
+		if p.MaxDelay <= 0 {
+			p.MaxDelay = defaultRetryMaxDelay
+		}
+		p.Jitter = min(max(p.Jitter, 0), 1)
+		if p.Retryable == nil {
+			p.Retryable = IsRetryable
+		}
+		m.retry = p
+	}
+}
+
+// delay returns the wait before retry number n (1-based).
+func (p RetryPolicy) delay(n int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < n && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxDelay)
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// IsRetryable reports whether a repository error is likely transient.
+// Errors exposing a PostgreSQL SQLSTATE (such as *pgconn.PgError) are
+// retryable for connection exceptions (class 08), serialization failures
+// and deadlocks (40001, 40P01), insufficient resources (class 53), lock
+// timeouts (55P03) and server shutdowns (57P01-57P03); other SQLSTATEs,
+// such as constraint violations, are permanent. Cancellation is permanent,
+// timeouts are retryable, and so are errors of unknown kind.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var coded interface{ SQLState() string }
+	if errors.As(err, &coded) {
+		code := coded.SQLState()
+		switch {
+		case strings.HasPrefix(code, "08"), strings.HasPrefix(code, "53"):
+			return true
+		}
+		switch code {
+		case "40001", "40P01", "55P03", "57P01", "57P02", "57P03":
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// DeadLetterSink receives entries that could not be persisted after all
+// retries, or that failed with a permanent error.
+type DeadLetterSink interface {
+	DeadLetter(ctx context.Context, entry *audit.AuditLog, cause error) error
+}
+
+// WithDeadLetter sets the sink for entries that exhaust their retries. An
+// entry accepted by the sink counts as handled: its spool record is acked
+// and it is removed from the spill buffer.
+func WithDeadLetter(sink DeadLetterSink) Option {
+	return func(m *AuditMiddleware) {
+		m.deadLetter = sink
+	}
+}
+
+// SlogDeadLetter logs dead-lettered entries in full at error level.
+type SlogDeadLetter struct {
+	Logger *slog.Logger
+}
+
+// DeadLetter implements DeadLetterSink.
+func (s SlogDeadLetter) DeadLetter(ctx context.Context, entry *audit.AuditLog, cause error) error {
+	s.Logger.ErrorContext(ctx, "audit log entry dead-lettered",
+		"error", cause,
+		"entry", entry,
+	)
+	return nil
+}
+
+// WriterDeadLetter writes dead-lettered entries to a secondary writer, e.g.
+// a repository on another database or a pgxaudit.OutboxWriter.
+type WriterDeadLetter struct {
+	Writer audit.AuditWriter
+}
+
+// DeadLetter implements DeadLetterSink.
+func (w WriterDeadLetter) DeadLetter(ctx context.Context, entry *audit.AuditLog, _ error) error {
+	return w.Writer.Create(ctx, entry)
+}
+
+// FileDeadLetter appends dead-lettered entries to a file as JSON lines of
+// the form {"error": "...", "entry": {...}}.
+type FileDeadLetter struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileDeadLetter creates a FileDeadLetter appending to the file at path.
+func NewFileDeadLetter(path string) *FileDeadLetter {
+	return &FileDeadLetter{path: path}
+}
+
+// DeadLetter implements DeadLetterSink.
+func (f *FileDeadLetter) DeadLetter(_ context.Context, entry *audit.AuditLog, cause error) error {
+	line, err := json.Marshal(struct {
+		Error string          `json:"error"`
+		Entry *audit.AuditLog `json:"entry"`
+	}{cause.Error(), entry})
+	if err != nil {
+		return fmt.Errorf("serializing dead letter: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening dead-letter file: %w", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("writing dead-letter file: %w", err)
+	}
+	return file.Close()
+}
+
+// Stats are cumulative counters of the middleware pipeline.
+type Stats struct {
+	// Retried counts write attempts after the first.
+	Retried uint64
+	// DeadLettered counts entries accepted by the dead-letter sink.
+	DeadLettered uint64
+	// Failed counts entries that were neither persisted nor dead-lettered.
+	Failed uint64
+}
+
+// stats holds the counters behind Stats.
+type stats struct {
+	retried      atomic.Uint64
+	deadLettered atomic.Uint64
+	failed       atomic.Uint64
+}
+
+// Stats returns a snapshot of the pipeline counters.
+func (m *AuditMiddleware) Stats() Stats {
+	return Stats{
+		Retried:      m.stats.retried.Load(),
+		DeadLettered: m.stats.deadLettered.Load(),
+		Failed:       m.stats.failed.Load(),
+	}
+}
+
+// sleep waits for d or until ctx is done, reporting whether it waited the
+// full duration.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
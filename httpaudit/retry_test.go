@@ -0,0 +1,192 @@
+package httpaudit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// flakyRepo fails the first failures calls to Create with err.
+type flakyRepo struct {
+	mockRepo
+	mu       sync.Mutex
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakyRepo) Create(ctx context.Context, entry *audit.AuditLog) error {
+	f.mu.Lock()
+	f.calls++
+	fail := f.calls <= f.failures
+	f.mu.Unlock()
+	if fail {
+		return f.err
+	}
+	return f.mockRepo.Create(ctx, entry)
+}
+
+// sqlStateError mimics *pgconn.PgError.
+type sqlStateError struct{ code string }
+
+func (e *sqlStateError) Error() string    { return "pg error " + e.code }
+func (e *sqlStateError) SQLState() string { return e.code }
+
+// recordingSink collects dead-lettered entries.
+type recordingSink struct {
+	mu      sync.Mutex
+	entries []*audit.AuditLog
+	causes  []error
+}
+
+func (r *recordingSink) DeadLetter(_ context.Context, entry *audit.AuditLog, cause error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+	r.causes = append(r.causes, cause)
+	return nil
+}
+
+func newRetryMiddleware(repo audit.AuditRepository, opts ...Option) *AuditMiddleware {
+	return NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+		append([]Option{WithWorkers(1)}, opts...)...,
+	)
+}
+
+func TestPersist_RetriesTransientErrors(t *testing.T) {
+	repo := &flakyRepo{failures: 2, err: &sqlStateError{"08006"}}
+	sink := &recordingSink{}
+	mw := newRetryMiddleware(repo,
+		WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+		WithDeadLetter(sink),
+	)
+	defer mw.Shutdown()
+
+	if err := mw.persist(context.Background(), spillEntry(t, "ord-1")); err != nil {
+		t.Fatalf("persist returned error: %v", err)
+	}
+	if len(repo.getEntries()) != 1 {
+		t.Fatal("expected the entry to be persisted on the third attempt")
+	}
+	if got := mw.Stats(); got.Retried != 2 || got.DeadLettered != 0 {
+		t.Errorf("stats = %+v, want 2 retries and no dead letters", got)
+	}
+}
+
+func TestPersist_DeadLettersAfterExhaustingRetries(t *testing.T) {
+	repo := &flakyRepo{failures: 10, err: errors.New("connection refused")}
+	sink := &recordingSink{}
+	mw := newRetryMiddleware(repo,
+		WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, Jitter: 0.5}),
+		WithDeadLetter(sink),
+	)
+	defer mw.Shutdown()
+
+	if err := mw.persist(context.Background(), spillEntry(t, "ord-1")); err != nil {
+		t.Fatalf("expected a dead-lettered entry to count as handled, got %v", err)
+	}
+	if repo.calls != 3 {
+		t.Errorf("attempts = %d, want 3", repo.calls)
+	}
+	if len(sink.entries) != 1 || sink.entries[0].ResourceID != "ord-1" {
+		t.Fatalf("dead letters = %v, want the entry", sink.entries)
+	}
+	if got := mw.Stats(); got.Retried != 2 || got.DeadLettered != 1 {
+		t.Errorf("stats = %+v, want 2 retries and 1 dead letter", got)
+	}
+}
+
+func TestPersist_PermanentErrorSkipsRetries(t *testing.T) {
+	repo := &flakyRepo{failures: 10, err: fmt.Errorf("inserting: %w", &sqlStateError{"23505"})}
+	mw := newRetryMiddleware(repo, WithRetry(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond}))
+	defer mw.Shutdown()
+
+	if err := mw.persist(context.Background(), spillEntry(t, "ord-1")); err == nil {
+		t.Fatal("expected an error without a dead-letter sink")
+	}
+	if repo.calls != 1 {
+		t.Errorf("attempts = %d, want 1 for a permanent error", repo.calls)
+	}
+	if got := mw.Stats(); got.Failed != 1 {
+		t.Errorf("stats = %+v, want 1 failure", got)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&sqlStateError{"08006"}, true},
+		{&sqlStateError{"40001"}, true},
+		{&sqlStateError{"53300"}, true},
+		{&sqlStateError{"57P01"}, true},
+		{&sqlStateError{"23505"}, false},
+		{&sqlStateError{"42P01"}, false},
+		{context.DeadlineExceeded, true},
+		{fmt.Errorf("write: %w", context.Canceled), false},
+		{errors.New("unexpected EOF"), true},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for n, want := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		40: time.Second,
+	} {
+		if got := p.delay(n); got != want {
+			t.Errorf("delay(%d) = %v, want %v", n, got, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for range 20 {
+		if d := p.delay(1); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("jittered delay %v outside [50ms, 100ms]", d)
+		}
+	}
+}
+
+func TestFileDeadLetter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.jsonl")
+	sink := NewFileDeadLetter(path)
+
+	if err := sink.DeadLetter(context.Background(), spillEntry(t, "ord-1"), errors.New("db down")); err != nil {
+		t.Fatalf("DeadLetter returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var line struct {
+		Error string         `json:"error"`
+		Entry audit.AuditLog `json:"entry"`
+	}
+	if err := json.Unmarshal(data, &line); err != nil {
+		t.Fatalf("invalid dead-letter line %q: %v", data, err)
+	}
+	if line.Error != "db down" || line.Entry.ResourceID != "ord-1" {
+		t.Errorf("dead letter = %+v", line)
+	}
+}
@@ -0,0 +1,306 @@
+package httpaudit
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Route is the route matched by a request.
+type Route struct {
+	// Pattern is the path of the route pattern, without method or host,
+	// e.g. /v1/orders/{id}.
+	Pattern string
+	// Params are the values of the pattern's wildcards, in pattern order.
+	Params []RouteParam
+}
+
+// RouteParam is the value of a route pattern wildcard.
+type RouteParam struct {
+	Name  string
+	Value string
+}
+
+// RouteResolver finds the route of a request for a particular router. It
+// is called once the handler has returned, and with WithRequestInfo also
+// before the router has seen the request, so implementations must be able
+// to resolve the route in both states.
+type RouteResolver interface {
+	// Route returns the route of r, or false if r is not served by the
+	// router.
+	Route(r *http.Request) (Route, bool)
+}
+
+// WithRouteResolver sets the resolver deriving the audited resource from
+// the route of each request. The default is a ServeMuxResolver without a
+// Mux. A nil resolver is ignored.
+func WithRouteResolver(res RouteResolver) Option {
+	return func(m *AuditMiddleware) {
+		if res != nil {
+			m.resolver = res
+		}
+	}
+}
+
+// ResourceRules configures how the resource name and resource ID of a
+// request are derived from its route. The zero value strips a /v1 prefix
+// and uses the last route param as the resource ID.
+type ResourceRules struct {
+	// Prefixes are stripped from route patterns and, for requests without
+	// a route, from the request path, e.g. "/api/v2". The first matching
+	// prefix is stripped. Nil means "/v1"; an empty slice strips nothing.
+	Prefixes []string
+
+	// IDParam reports whether a route param holds the resource ID, e.g.
+	//
+	//	func(name string) bool { return name == "id" || strings.HasSuffix(name, "ID") }
+	//
+	// The resource ID is the value of the last matching param, or empty if
+	// none matches. Nil matches every param.
+	IDParam func(name string) bool
+
+	// Parents records the route params other than the resource ID in the
+	// "parents" detail, as references to the enclosing resources, e.g.
+	// {"resource": "orgs", "param": "orgID", "id": "o-1"} for
+	// /orgs/{orgID}/projects/{projectID}.
+	Parents bool
+
+	// Override, if set, is called for every route before the rules above;
+	// if it returns true, its resource and resource ID are used instead,
+	// e.g. to name the resource of a particular route pattern.
+	Override func(route Route) (resource, resourceID string, ok bool)
+}
+
+// ParentRef references a resource enclosing the audited one through a
+// route param.
+type ParentRef struct {
+	// Resource is the static path segment preceding the param, or empty
+	// if there is none.
+	Resource string
+	Param    string
+	ID       string
+}
+
+// WithResourceRules sets the rules deriving the resource name and resource
+// ID from the route of each request.
+func WithResourceRules(rules ResourceRules) Option {
+	return func(m *AuditMiddleware) {
+		m.resources = rules
+	}
+}
+
+// resolveResource derives the resource name, resource ID and, if enabled,
+// the parent references of r from its route, falling back to the request
+// path if it has none.
+func (m *AuditMiddleware) resolveResource(r *http.Request) (resource, resourceID string, parents []ParentRef) {
+	route, ok := m.resolver.Route(r)
+	if !ok {
+		return m.resources.stripPrefix(r.URL.Path), "", nil
+	}
+	resource, resourceID = m.resources.Resource(route)
+	if m.resources.Parents {
+		parents = m.resources.ParentRefs(route)
+	}
+	return resource, resourceID, parents
+}
+
+// ResourceFromRoute derives the resource name and resource ID from a route
+// with the default ResourceRules.
+func ResourceFromRoute(route Route) (resource, resourceID string) {
+	return ResourceRules{}.Resource(route)
+}
+
+// Resource derives the resource name from the route pattern, so that the
+// value is stable regardless of the actual ID in the URL, and the resource
+// ID from the route params.
+func (rr ResourceRules) Resource(route Route) (resource, resourceID string) {
+	if rr.Override != nil {
+		if resource, resourceID, ok := rr.Override(route); ok {
+			return resource, resourceID
+		}
+	}
+
+	if i := rr.idIndex(route.Params); i >= 0 {
+		resourceID = route.Params[i].Value
+	}
+
+	// Build resource from the route pattern, dropping param segments.
+	// /v1/tesoreria/pagos/{id} → tesoreria/pagos
+	parts := strings.Split(rr.stripPrefix(route.Pattern), "/")
+	clean := parts[:0]
+	for _, p := range parts {
+		if !strings.HasPrefix(p, "{") && p != "" && p != "*" {
+			clean = append(clean, p)
+		}
+	}
+	resource = strings.Join(clean, "/")
+
+	return resource, resourceID
+}
+
+// ParentRefs returns references for the route params other than the
+// resource ID, in pattern order. Catch-all params are ignored.
+func (rr ResourceRules) ParentRefs(route Route) []ParentRef {
+	// Map each param name to the static segment preceding it.
+	preceding := map[string]string{}
+	var last string
+	for seg := range strings.SplitSeq(route.Pattern, "/") {
+		name, ok := paramName(seg)
+		switch {
+		case ok:
+			preceding[name] = last
+			last = ""
+		case seg != "" && seg != "*":
+			last = seg
+		}
+	}
+
+	id := rr.idIndex(route.Params)
+	var refs []ParentRef
+	for i, p := range route.Params {
+		if i == id || p.Name == "*" {
+			continue
+		}
+		refs = append(refs, ParentRef{Resource: preceding[p.Name], Param: p.Name, ID: p.Value})
+	}
+	return refs
+}
+
+// idIndex returns the index of the param holding the resource ID, or -1.
+func (rr ResourceRules) idIndex(params []RouteParam) int {
+	for i := len(params) - 1; i >= 0; i-- {
+		if rr.IDParam == nil || rr.IDParam(params[i].Name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// stripPrefix strips the first matching prefix from path. A prefix only
+// matches whole segments.
+func (rr ResourceRules) stripPrefix(path string) string {
+	prefixes := rr.Prefixes
+	if prefixes == nil {
+		prefixes = []string{"/v1"}
+	}
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if rest, ok := strings.CutPrefix(path, prefix+"/"); ok && prefix != "" {
+			return rest
+		}
+	}
+	return path
+}
+
+// parentsDetail converts parent references to their "parents" detail.
+func parentsDetail(refs []ParentRef) []any {
+	detail := make([]any, len(refs))
+	for i, ref := range refs {
+		m := map[string]any{"param": ref.Param, "id": ref.ID}
+		if ref.Resource != "" {
+			m["resource"] = ref.Resource
+		}
+		detail[i] = m
+	}
+	return detail
+}
+
+// ServeMuxResolver resolves the routes of an http.ServeMux with Go 1.22+
+// patterns such as "GET /v1/orders/{id}".
+//
+// Once routed, the pattern is read from Request.Pattern and the params
+// from Request.PathValue. Mux is only needed to resolve requests the mux
+// has not routed yet: before the handler runs (see WithRequestInfo), or
+// when a middleware between the audit middleware and the mux replaces the
+// request.
+type ServeMuxResolver struct {
+	Mux *http.ServeMux
+}
+
+// Route implements RouteResolver.
+func (s ServeMuxResolver) Route(r *http.Request) (Route, bool) {
+	if r.Pattern != "" {
+		path := patternPath(r.Pattern)
+		var params []RouteParam
+		for _, name := range wildcards(path) {
+			params = append(params, RouteParam{Name: name, Value: r.PathValue(name)})
+		}
+		return Route{Pattern: path, Params: params}, true
+	}
+
+	if s.Mux == nil {
+		return Route{}, false
+	}
+	_, pattern := s.Mux.Handler(r)
+	if pattern == "" {
+		return Route{}, false
+	}
+	path := patternPath(pattern)
+	return Route{Pattern: path, Params: matchWildcards(path, r.URL)}, true
+}
+
+// patternPath strips the method and host from a ServeMux pattern.
+func patternPath(pattern string) string {
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		pattern = strings.TrimLeft(pattern[i+1:], " \t")
+	}
+	if i := strings.IndexByte(pattern, '/'); i > 0 {
+		pattern = pattern[i:]
+	}
+	return pattern
+}
+
+// wildcards returns the names of the wildcards of a ServeMux pattern path,
+// ignoring {$}.
+func wildcards(path string) []string {
+	var names []string
+	for seg := range strings.SplitSeq(path, "/") {
+		if name, ok := wildcardName(seg); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// paramName returns the name of a param segment in a ServeMux or chi
+// pattern: {name}, {name...} or {name:regexp}.
+func paramName(seg string) (string, bool) {
+	name, ok := wildcardName(seg)
+	if !ok {
+		return "", false
+	}
+	name, _, _ = strings.Cut(name, ":")
+	return name, true
+}
+
+// wildcardName returns the name of a {name} or {name...} segment.
+func wildcardName(seg string) (string, bool) {
+	if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") || seg == "{$}" {
+		return "", false
+	}
+	return strings.TrimSuffix(seg[1:len(seg)-1], "..."), true
+}
+
+// matchWildcards matches the segments of u's path against a pattern path
+// the mux selected for it, returning the wildcard values.
+func matchWildcards(path string, u *url.URL) []RouteParam {
+	patSegs := strings.Split(path, "/")
+	urlSegs := strings.Split(u.EscapedPath(), "/")
+
+	var params []RouteParam
+	for i, seg := range patSegs {
+		name, ok := wildcardName(seg)
+		if !ok || i >= len(urlSegs) {
+			continue
+		}
+		value := urlSegs[i]
+		if strings.HasSuffix(seg, "...}") {
+			value = strings.Join(urlSegs[i:], "/")
+		}
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			value = unescaped
+		}
+		params = append(params, RouteParam{Name: name, Value: value})
+	}
+	return params
+}
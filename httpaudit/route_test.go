@@ -0,0 +1,267 @@
+package httpaudit
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeMuxResolver_Routed(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		pattern   string
+		url       string
+		wantRes   string
+		wantResID string
+	}{
+		{name: "resource with id", method: http.MethodGet, pattern: "GET /v1/orders/{id}", url: "/v1/orders/abc-123", wantRes: "orders", wantResID: "abc-123"},
+		{name: "nested resource", method: http.MethodGet, pattern: "/v1/tesoreria/pagos/{id}", url: "/v1/tesoreria/pagos/pay-1", wantRes: "tesoreria/pagos", wantResID: "pay-1"},
+		{name: "collection", method: http.MethodPost, pattern: "POST /v1/users", url: "/v1/users", wantRes: "users"},
+		{name: "exact match", method: http.MethodGet, pattern: "GET /v1/users/{$}", url: "/v1/users/", wantRes: "users"},
+		{name: "host pattern", method: http.MethodGet, pattern: "example.com/v1/orders/{id}", url: "http://example.com/v1/orders/o-1", wantRes: "orders", wantResID: "o-1"},
+		{name: "remaining segments", method: http.MethodGet, pattern: "GET /v1/files/{path...}", url: "/v1/files/a/b.txt", wantRes: "files", wantResID: "a/b.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRes, gotResID string
+			mux := http.NewServeMux()
+			mux.HandleFunc(tt.pattern, func(w http.ResponseWriter, r *http.Request) {
+				route, ok := ServeMuxResolver{}.Route(r)
+				if !ok {
+					t.Fatal("expected a route for a request routed by the mux")
+				}
+				gotRes, gotResID = ResourceFromRoute(route)
+			})
+
+			mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.url, nil))
+
+			if gotRes != tt.wantRes || gotResID != tt.wantResID {
+				t.Errorf("resource = %q, %q, want %q, %q", gotRes, gotResID, tt.wantRes, tt.wantResID)
+			}
+		})
+	}
+}
+
+func TestServeMuxResolver_BeforeRouting(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /v1/orders/{order}/items/{item}", func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest(http.MethodPut, "/v1/orders/o-1/items/i%2F2", nil)
+	if _, ok := (ServeMuxResolver{}).Route(req); ok {
+		t.Error("expected no route without a Mux before routing")
+	}
+
+	route, ok := ServeMuxResolver{Mux: mux}.Route(req)
+	if !ok {
+		t.Fatal("expected the route to be resolved through the Mux")
+	}
+	if route.Pattern != "/v1/orders/{order}/items/{item}" {
+		t.Errorf("Pattern = %q", route.Pattern)
+	}
+	want := []RouteParam{{Name: "order", Value: "o-1"}, {Name: "item", Value: "i/2"}}
+	if len(route.Params) != len(want) || route.Params[0] != want[0] || route.Params[1] != want[1] {
+		t.Errorf("Params = %v, want %v", route.Params, want)
+	}
+
+	if _, ok := (ServeMuxResolver{Mux: mux}).Route(httptest.NewRequest(http.MethodGet, "/unknown", nil)); ok {
+		t.Error("expected no route for an unmatched request")
+	}
+}
+
+type staticResolver struct{ route Route }
+
+func (s staticResolver) Route(*http.Request) (Route, bool) { return s.route, true }
+
+func TestHandler_CustomRouteResolver(t *testing.T) {
+	repo := &mockRepo{}
+	mw := NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+		WithRouteResolver(staticResolver{Route{
+			Pattern: "/v1/invoices/{id}",
+			Params:  []RouteParam{{Name: "id", Value: "inv-1"}},
+		}}),
+	)
+
+	h := mw.Handler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/anything", nil))
+	mw.Shutdown()
+
+	entries := repo.getEntries()
+	if len(entries) != 1 || entries[0].Resource != "invoices" || entries[0].ResourceID != "inv-1" {
+		t.Fatalf("expected the resource from the custom resolver, got %v", entries)
+	}
+}
+
+func TestHandler_UnroutedRequestUsesPath(t *testing.T) {
+	repo := &mockRepo{}
+	mw := NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+	)
+
+	h := mw.Handler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/orders/abc-123", nil))
+	mw.Shutdown()
+
+	entries := repo.getEntries()
+	if len(entries) != 1 || entries[0].Resource != "orders/abc-123" || entries[0].ResourceID != "" {
+		t.Fatalf("expected the path as resource, got %v", entries)
+	}
+}
+
+func TestResourceRules_Resource(t *testing.T) {
+	idSuffix := func(name string) bool { return name == "id" || strings.HasSuffix(name, "ID") }
+	members := Route{
+		Pattern: "/api/v2/orgs/{orgID}/projects/{projectID}/members/{memberID}",
+		Params: []RouteParam{
+			{Name: "orgID", Value: "o-1"}, {Name: "projectID", Value: "p-1"}, {Name: "memberID", Value: "m-1"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		rules     ResourceRules
+		route     Route
+		wantRes   string
+		wantResID string
+	}{
+		{
+			name:      "default strips v1",
+			route:     Route{Pattern: "/v1/orders/{id}", Params: []RouteParam{{Name: "id", Value: "o-1"}}},
+			wantRes:   "orders",
+			wantResID: "o-1",
+		},
+		{
+			name:      "configured prefix",
+			rules:     ResourceRules{Prefixes: []string{"/api/v1", "/api/v2/"}},
+			route:     members,
+			wantRes:   "orgs/projects/members",
+			wantResID: "m-1",
+		},
+		{
+			name:    "prefix matches whole segments only",
+			rules:   ResourceRules{Prefixes: []string{"/api"}},
+			route:   Route{Pattern: "/apis/list"},
+			wantRes: "apis/list",
+		},
+		{
+			name:    "no prefix",
+			rules:   ResourceRules{Prefixes: []string{}},
+			route:   Route{Pattern: "/v1/orders"},
+			wantRes: "v1/orders",
+		},
+		{
+			name:      "id param rule skips trailing non-id param",
+			rules:     ResourceRules{IDParam: idSuffix},
+			route:     Route{Pattern: "/v1/orders/{id}/files/{slug}", Params: []RouteParam{{Name: "id", Value: "o-1"}, {Name: "slug", Value: "invoice"}}},
+			wantRes:   "orders/files",
+			wantResID: "o-1",
+		},
+		{
+			name:    "id param rule without a match",
+			rules:   ResourceRules{IDParam: idSuffix},
+			route:   Route{Pattern: "/v1/posts/{slug}", Params: []RouteParam{{Name: "slug", Value: "hello"}}},
+			wantRes: "posts",
+		},
+		{
+			name: "override",
+			rules: ResourceRules{Override: func(route Route) (string, string, bool) {
+				return "memberships", route.Params[len(route.Params)-1].Value, route.Pattern == members.Pattern
+			}},
+			route:     members,
+			wantRes:   "memberships",
+			wantResID: "m-1",
+		},
+		{
+			name:      "override declines",
+			rules:     ResourceRules{Override: func(Route) (string, string, bool) { return "", "", false }},
+			route:     Route{Pattern: "/v1/orders/{id}", Params: []RouteParam{{Name: "id", Value: "o-1"}}},
+			wantRes:   "orders",
+			wantResID: "o-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, resID := tt.rules.Resource(tt.route)
+			if res != tt.wantRes || resID != tt.wantResID {
+				t.Errorf("Resource = %q, %q, want %q, %q", res, resID, tt.wantRes, tt.wantResID)
+			}
+		})
+	}
+}
+
+func TestResourceRules_ParentRefs(t *testing.T) {
+	route := Route{
+		Pattern: "/{tenant}/orgs/{orgID}/projects/{projectID:[0-9]+}/members/{memberID}",
+		Params: []RouteParam{
+			{Name: "tenant", Value: "acme"}, {Name: "orgID", Value: "o-1"},
+			{Name: "projectID", Value: "42"}, {Name: "memberID", Value: "m-1"},
+		},
+	}
+
+	got := ResourceRules{}.ParentRefs(route)
+	want := []ParentRef{
+		{Param: "tenant", ID: "acme"},
+		{Resource: "orgs", Param: "orgID", ID: "o-1"},
+		{Resource: "projects", Param: "projectID", ID: "42"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ParentRefs = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ParentRefs[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestHandler_RecordsParents(t *testing.T) {
+	repo := &mockRepo{}
+	mw := NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+		WithResourceRules(ResourceRules{Prefixes: []string{"/api/v2"}, Parents: true}),
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /api/v2/orgs/{orgID}/members/{memberID}", func(w http.ResponseWriter, r *http.Request) {})
+	mw.Handler()(mux).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/api/v2/orgs/o-1/members/m-1", nil))
+	mw.Shutdown()
+
+	entries := repo.getEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Resource != "orgs/members" || e.ResourceID != "m-1" {
+		t.Errorf("resource = %q, %q, want orgs/members, m-1", e.Resource, e.ResourceID)
+	}
+
+	parents, _ := e.Details["parents"].([]any)
+	if len(parents) != 1 {
+		t.Fatalf("parents = %v, want one reference", e.Details["parents"])
+	}
+	if p := parents[0].(map[string]any); p["resource"] != "orgs" || p["param"] != "orgID" || p["id"] != "o-1" {
+		t.Errorf("parent = %v, want orgs/orgID/o-1", p)
+	}
+}
+
+func TestHandler_UnroutedRequestStripsPrefix(t *testing.T) {
+	repo := &mockRepo{}
+	mw := NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+		WithResourceRules(ResourceRules{Prefixes: []string{"/api/v2"}}),
+	)
+
+	h := mw.Handler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v2/reports", nil))
+	mw.Shutdown()
+
+	if entries := repo.getEntries(); len(entries) != 1 || entries[0].Resource != "reports" {
+		t.Fatalf("expected the prefix stripped from the path, got %v", entries)
+	}
+}
@@ -0,0 +1,185 @@
+package httpaudit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+const defaultSpillInterval = 5 * time.Second
+
+// SpillBuffer holds entries that did not fit in the queue under
+// OverflowSpill until the middleware drains them into the repository.
+type SpillBuffer interface {
+	// Append stores entry.
+	Append(entry *audit.AuditLog) error
+	// Drain calls fn for the stored entries, removing those for which fn
+	// returns nil. It stops at the first error and keeps the remaining
+	// entries for the next call.
+	Drain(fn func(*audit.AuditLog) error) error
+}
+
+// WithSpill sets the buffer used by OverflowSpill and drains it into the
+// repository every interval (5s if zero or less), and once more on
+// Shutdown.
+//
+// Entries reach the buffer before the repository; set FileSpill.Redaction
+// to keep secrets off the disk.
+func WithSpill(buf SpillBuffer, interval time.Duration) Option {
+	return func(m *AuditMiddleware) {
+		m.spill = buf
+		if interval > 0 {
+			m.spillInterval = interval
+		}
+	}
+}
+
+// drainSpill drains the spill buffer every spillInterval until Shutdown.
+func (m *AuditMiddleware) drainSpill() {
+	defer m.drainWG.Done()
+
+	ticker := time.NewTicker(m.spillInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopDrain:
+			return
+		case <-ticker.C:
+			m.drainSpillOnce()
+		}
+	}
+}
+
+// drainSpillOnce persists the spilled entries.
+func (m *AuditMiddleware) drainSpillOnce() {
+	err := m.spill.Drain(func(entry *audit.AuditLog) error {
+		return m.persist(context.Background(), entry)
+	})
+	if err != nil {
+		m.logger.Warn("audit spill buffer not fully drained", "error", err)
+	}
+}
+
+// FileSpill is a SpillBuffer backed by a local file of JSON lines. It is
+// meant for short overflows: entries are buffered until the repository
+// catches up, and survive a restart of the process.
+type FileSpill struct {
+	// Redaction, if set, redacts entries before they are written; see
+	// SpoolConfig.Redaction. Set it before the first Append.
+	Redaction *audit.RedactionPolicy
+
+	path string
+
+	mu      sync.Mutex // guards the spill file
+	drainMu sync.Mutex // serializes Drain
+}
+
+// NewFileSpill creates a FileSpill that appends to the file at path. While
+// draining, the entries are moved to path + ".draining"; a leftover of that
+// file from an interrupted drain is processed first.
+func NewFileSpill(path string) *FileSpill {
+	return &FileSpill{path: path}
+}
+
+// Append writes entry, redacted with Redaction, as one JSON line.
+func (s *FileSpill) Append(entry *audit.AuditLog) error {
+	line, err := json.Marshal(redacted(s.Redaction, entry))
+	if err != nil {
+		return fmt.Errorf("serializing spilled entry: %w", err)
+	}
+	return s.appendLines([][]byte{line})
+}
+
+// appendLines appends raw JSON lines to the spill file.
+func (s *FileSpill) appendLines(lines [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening spill file: %w", err)
+	}
+	for _, line := range lines {
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			f.Close()
+			return fmt.Errorf("writing spill file: %w", err)
+		}
+	}
+	return f.Close()
+}
+
+// Drain implements SpillBuffer. Lines that cannot be decoded are dropped.
+func (s *FileSpill) Drain(fn func(*audit.AuditLog) error) error {
+	s.drainMu.Lock()
+	defer s.drainMu.Unlock()
+
+	draining := s.path + ".draining"
+
+	s.mu.Lock()
+	_, err := os.Stat(draining)
+	if errors.Is(err, os.ErrNotExist) {
+		err = os.Rename(s.path, draining)
+	}
+	s.mu.Unlock()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("claiming spill file: %w", err)
+	}
+
+	content, err := os.ReadFile(draining)
+	if err != nil {
+		return fmt.Errorf("reading spill file: %w", err)
+	}
+
+	var lines [][]byte
+	sc := bufio.NewScanner(bytes.NewReader(content))
+	sc.Buffer(nil, len(content)+1)
+	for sc.Scan() {
+		// The scanner reuses its buffer, so each line is copied.
+		if len(sc.Bytes()) > 0 {
+			lines = append(lines, bytes.Clone(sc.Bytes()))
+		}
+	}
+
+	var drainErr error
+	for i, line := range lines {
+		var entry audit.AuditLog
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		if err := fn(&entry); err != nil {
+			if err := s.appendLines(lines[i:]); err != nil {
+				return fmt.Errorf("returning undrained entries to spill file: %w", err)
+			}
+			drainErr = err
+			break
+		}
+	}
+
+	if err := os.Remove(draining); err != nil {
+		return fmt.Errorf("removing drained spill file: %w", err)
+	}
+	return drainErr
+}
+
+// redacted returns a copy of entry redacted with policy, or entry itself if
+// policy is nil.
+func redacted(policy *audit.RedactionPolicy, entry *audit.AuditLog) *audit.AuditLog {
+	if policy == nil {
+		return entry
+	}
+	cp := *entry
+	policy.Apply(&cp)
+	return &cp
+}
@@ -0,0 +1,149 @@
+package httpaudit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+func spillEntry(t *testing.T, resourceID string) *audit.AuditLog {
+	t.Helper()
+	entry, err := audit.New(audit.ActionRead, "orders", audit.WithActor("u1", ""), audit.WithResourceID(resourceID))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return entry
+}
+
+func TestFileSpill_AppendAndDrain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.spill")
+	spill := NewFileSpill(path)
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := spill.Append(spillEntry(t, id)); err != nil {
+			t.Fatalf("Append returned error: %v", err)
+		}
+	}
+
+	var got []string
+	if err := spill.Drain(func(e *audit.AuditLog) error {
+		got = append(got, e.ResourceID)
+		return nil
+	}); err != nil {
+		t.Fatalf("Drain returned error: %v", err)
+	}
+	if len(got) != 3 || got[0] != "a" || got[2] != "c" {
+		t.Errorf("drained %v, want [a b c]", got)
+	}
+
+	for _, p := range []string{path, path + ".draining"} {
+		if _, err := os.Stat(p); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %s to be removed after draining", p)
+		}
+	}
+}
+
+func TestFileSpill_DrainLargeFile(t *testing.T) {
+	spill := NewFileSpill(filepath.Join(t.TempDir(), "audit.spill"))
+
+	const n = 500
+	for i := range n {
+		if err := spill.Append(spillEntry(t, fmt.Sprintf("ord-%d", i))); err != nil {
+			t.Fatalf("Append returned error: %v", err)
+		}
+	}
+
+	var got []string
+	if err := spill.Drain(func(e *audit.AuditLog) error {
+		got = append(got, e.ResourceID)
+		return nil
+	}); err != nil {
+		t.Fatalf("Drain returned error: %v", err)
+	}
+	if len(got) != n {
+		t.Fatalf("drained %d entries, want %d", len(got), n)
+	}
+	for i, id := range got {
+		if want := fmt.Sprintf("ord-%d", i); id != want {
+			t.Fatalf("entry %d = %q, want %q", i, id, want)
+		}
+	}
+}
+
+func TestFileSpill_RedactsBeforeWriting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.spill")
+	spill := NewFileSpill(path)
+	spill.Redaction = audit.DefaultRedactionPolicy()
+
+	entry := spillEntry(t, "ord-1")
+	entry.Details = map[string]any{"password": "hunter2"}
+	if err := spill.Append(entry); err != nil {
+		t.Fatalf("Append returned error: %v", err)
+	}
+	if entry.Details["password"] != "hunter2" {
+		t.Errorf("expected the appended entry unchanged, got %v", entry.Details)
+	}
+
+	content, _ := os.ReadFile(path)
+	if strings.Contains(string(content), "hunter2") {
+		t.Errorf("spill file holds secrets in clear: %s", content)
+	}
+}
+
+func TestFileSpill_DrainKeepsUndelivered(t *testing.T) {
+	spill := NewFileSpill(filepath.Join(t.TempDir(), "audit.spill"))
+	for _, id := range []string{"a", "b", "c"} {
+		spill.Append(spillEntry(t, id))
+	}
+
+	errDown := errors.New("db down")
+	err := spill.Drain(func(e *audit.AuditLog) error {
+		if e.ResourceID == "b" {
+			return errDown
+		}
+		return nil
+	})
+	if !errors.Is(err, errDown) {
+		t.Fatalf("Drain error = %v, want %v", err, errDown)
+	}
+
+	var got []string
+	spill.Drain(func(e *audit.AuditLog) error {
+		got = append(got, e.ResourceID)
+		return nil
+	})
+	if len(got) != 2 || got[0] != "b" || got[1] != "c" {
+		t.Errorf("second drain = %v, want [b c]", got)
+	}
+}
+
+func TestFileSpill_ResumesInterruptedDrain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.spill")
+	spill := NewFileSpill(path)
+	spill.Append(spillEntry(t, "leftover"))
+	if err := os.Rename(path, path+".draining"); err != nil {
+		t.Fatal(err)
+	}
+	spill.Append(spillEntry(t, "new"))
+
+	var got []string
+	spill.Drain(func(e *audit.AuditLog) error {
+		got = append(got, e.ResourceID)
+		return nil
+	})
+	if len(got) != 1 || got[0] != "leftover" {
+		t.Errorf("drained %v, want the interrupted drain first", got)
+	}
+}
+
+func TestFileSpill_DrainEmpty(t *testing.T) {
+	spill := NewFileSpill(filepath.Join(t.TempDir(), "audit.spill"))
+	if err := spill.Drain(func(*audit.AuditLog) error { return nil }); err != nil {
+		t.Fatalf("Drain on an empty spill returned error: %v", err)
+	}
+}
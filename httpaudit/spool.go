@@ -0,0 +1,521 @@
+package httpaudit
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+const (
+	defaultSegmentSize  = 4 << 20
+	defaultSyncInterval = 100 * time.Millisecond
+
+	segmentExt = ".seg"
+	ackExt     = ".ack"
+	// recordHeaderSize is the length prefix plus the CRC-32C of a record.
+	recordHeaderSize = 8
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SyncPolicy controls when a Spool fsyncs its active segment.
+type SyncPolicy int
+
+const (
+	// SyncEveryWrite fsyncs before Append returns: an acknowledged entry
+	// survives a power loss (default).
+	SyncEveryWrite SyncPolicy = iota
+	// SyncPeriodic fsyncs every SpoolConfig.SyncInterval: entries survive
+	// a process crash, and a power loss loses at most one interval.
+	SyncPeriodic
+	// SyncNever leaves flushing to the operating system: entries survive
+	// a process crash only.
+	SyncNever
+)
+
+// SpoolConfig configures a Spool.
+type SpoolConfig struct {
+	// Dir holds the segment files. It is created if missing and must not
+	// be shared by two processes.
+	Dir string
+	// SegmentSize is the size in bytes after which a new segment is
+	// started. Defaults to 4 MiB.
+	SegmentSize int64
+	Sync        SyncPolicy
+	// SyncInterval is the fsync period of SyncPeriodic. Defaults to 100ms.
+	SyncInterval time.Duration
+	// Redaction, if set, redacts entries before they are written, so that
+	// secrets in Details and ChangedFields do not reach the disk. Without
+	// it, entries are written as built by the middleware, before any
+	// audit.RedactingRepository runs. Use the policy of that repository:
+	// it leaves replayed entries unchanged.
+	Redaction *audit.RedactionPolicy
+}
+
+// SpoolRecord is an entry stored in a Spool. Ack it once the entry is
+// persisted.
+type SpoolRecord struct {
+	Entry   *audit.AuditLog
+	segment uint64
+	index   uint32
+}
+
+// segmentState tracks how many records of a segment are persisted.
+type segmentState struct {
+	records int
+	acked   int
+	sealed  bool
+}
+
+// Spool is a local write-ahead log of audit entries. Entries are appended
+// to segment files as length-prefixed, CRC-32C-checked JSON records, and a
+// segment is deleted once it is sealed and all its records are acked.
+// Acks are recorded in a sidecar file per segment, so unacked records of
+// segments left behind by a crashed process are read back on open and
+// returned by Replay; a torn or corrupt record ends its segment. Delivery
+// is at-least-once: a crash between persisting an entry and acking it
+// replays the entry.
+type Spool struct {
+	cfg SpoolConfig
+
+	mu       sync.Mutex
+	active   *os.File
+	activeSz int64
+	nextSeg  uint64
+	segments map[uint64]*segmentState
+	pending  []SpoolRecord
+	dirty    bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenSpool opens the spool in cfg.Dir, loading the records of existing
+// segments for Replay, and starts a new active segment.
+func OpenSpool(cfg SpoolConfig) (*Spool, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("spool directory is required")
+	}
+	if cfg.SegmentSize <= 0 {
+		cfg.SegmentSize = defaultSegmentSize
+	}
+	if cfg.SyncInterval <= 0 {
+		cfg.SyncInterval = defaultSyncInterval
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating spool directory: %w", err)
+	}
+
+	s := &Spool{cfg: cfg, segments: map[uint64]*segmentState{}}
+
+	seqs, err := s.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	for _, seq := range seqs {
+		s.nextSeg = seq
+		entries, err := readSegment(s.segmentPath(seq))
+		if err != nil {
+			return nil, err
+		}
+		acked, err := readAcks(s.ackPath(seq))
+		if err != nil {
+			return nil, err
+		}
+
+		st := &segmentState{records: len(entries), sealed: true}
+		s.segments[seq] = st
+		for i, e := range entries {
+			if acked[uint32(i)] {
+				st.acked++
+				continue
+			}
+			s.pending = append(s.pending, SpoolRecord{Entry: e, segment: seq, index: uint32(i)})
+		}
+		if err := s.collect(seq); err != nil {
+			return nil, err
+		}
+	}
+	s.nextSeg++
+
+	s.mu.Lock()
+	err = s.rotate()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Sync == SyncPeriodic {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.syncLoop()
+	}
+
+	return s, nil
+}
+
+// Append writes entry, redacted with the configured policy, to the active
+// segment, syncing it according to the sync policy, and returns the record
+// to Ack once the entry is persisted. entry itself is not redacted.
+func (s *Spool) Append(entry *audit.AuditLog) (SpoolRecord, error) {
+	payload, err := json.Marshal(redacted(s.cfg.Redaction, entry))
+	if err != nil {
+		return SpoolRecord{}, fmt.Errorf("serializing spool record: %w", err)
+	}
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	copy(buf[recordHeaderSize:], payload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		return SpoolRecord{}, errors.New("spool is closed")
+	}
+	if s.activeSz > 0 && s.activeSz+int64(len(buf)) > s.cfg.SegmentSize {
+		if err := s.rotate(); err != nil {
+			return SpoolRecord{}, err
+		}
+	}
+
+	if _, err := s.active.Write(buf); err != nil {
+		return SpoolRecord{}, fmt.Errorf("writing spool record: %w", err)
+	}
+	s.activeSz += int64(len(buf))
+	if s.cfg.Sync == SyncEveryWrite {
+		if err := s.active.Sync(); err != nil {
+			return SpoolRecord{}, fmt.Errorf("syncing spool segment: %w", err)
+		}
+	} else {
+		s.dirty = true
+	}
+
+	seq := s.nextSeg - 1
+	st := s.segments[seq]
+	st.records++
+	return SpoolRecord{Entry: entry, segment: seq, index: uint32(st.records - 1)}, nil
+}
+
+// Ack marks rec as persisted and deletes its segment once the segment is
+// sealed and fully acked.
+func (s *Spool) Ack(rec SpoolRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.segments[rec.segment]
+	if !ok {
+		return nil
+	}
+
+	f, err := os.OpenFile(s.ackPath(rec.segment), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening spool ack file: %w", err)
+	}
+	_, err = f.Write(binary.BigEndian.AppendUint32(nil, rec.index))
+	if err == nil && s.cfg.Sync == SyncEveryWrite {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("writing spool ack: %w", err)
+	}
+
+	st.acked++
+	return s.collect(rec.segment)
+}
+
+// Replay calls fn for every record recovered from segments left by a
+// previous process, in the order they were written. It stops at the first
+// error returned by fn; records not yet replayed are offered again by the
+// next call. Each record must be acked by the caller once persisted.
+func (s *Spool) Replay(fn func(SpoolRecord) error) error {
+	for {
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		rec := s.pending[0]
+		s.mu.Unlock()
+
+		if err := fn(rec); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.pending = s.pending[1:]
+		s.mu.Unlock()
+	}
+}
+
+// Close syncs and closes the active segment, deleting it if every record
+// in it was acked. Unacked records are replayed by the next OpenSpool.
+func (s *Spool) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		return nil
+	}
+	if err := s.seal(); err != nil {
+		return err
+	}
+	s.active = nil
+	return nil
+}
+
+// rotate seals the active segment, if any, and starts a new one.
+// s.mu must be held.
+func (s *Spool) rotate() error {
+	if s.active != nil {
+		if err := s.seal(); err != nil {
+			return err
+		}
+	}
+
+	seq := s.nextSeg
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("creating spool segment: %w", err)
+	}
+	if err := syncDir(s.cfg.Dir); err != nil {
+		f.Close()
+		return err
+	}
+
+	s.active = f
+	s.activeSz = 0
+	s.nextSeg++
+	s.segments[seq] = &segmentState{}
+	return nil
+}
+
+// seal syncs and closes the active segment. s.mu must be held.
+func (s *Spool) seal() error {
+	seq := s.nextSeg - 1
+	if err := s.active.Sync(); err != nil {
+		return fmt.Errorf("syncing spool segment: %w", err)
+	}
+	if err := s.active.Close(); err != nil {
+		return fmt.Errorf("closing spool segment: %w", err)
+	}
+	s.dirty = false
+	s.segments[seq].sealed = true
+	return s.collect(seq)
+}
+
+// collect deletes segment seq if it is sealed and fully acked.
+// s.mu must be held.
+func (s *Spool) collect(seq uint64) error {
+	st := s.segments[seq]
+	if !st.sealed || st.acked < st.records {
+		return nil
+	}
+	delete(s.segments, seq)
+	if err := os.Remove(s.segmentPath(seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing spool segment: %w", err)
+	}
+	if err := os.Remove(s.ackPath(seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing spool ack file: %w", err)
+	}
+	return syncDir(s.cfg.Dir)
+}
+
+// syncLoop fsyncs the active segment every SyncInterval under SyncPeriodic.
+func (s *Spool) syncLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.cfg.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.dirty && s.active != nil {
+				if err := s.active.Sync(); err == nil {
+					s.dirty = false
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.cfg.Dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+}
+
+func (s *Spool) ackPath(seq uint64) string {
+	return filepath.Join(s.cfg.Dir, fmt.Sprintf("%020d%s", seq, ackExt))
+}
+
+// listSegments returns the sequence numbers of the segment files in the
+// spool directory, in ascending order.
+func (s *Spool) listSegments() ([]uint64, error) {
+	dirEntries, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading spool directory: %w", err)
+	}
+
+	var seqs []uint64
+	for _, e := range dirEntries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+// readSegment decodes the records of a segment file up to the first torn
+// or corrupt record.
+func readSegment(path string) ([]*audit.AuditLog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading spool segment: %w", err)
+	}
+
+	var entries []*audit.AuditLog
+	for len(data) >= recordHeaderSize {
+		n := binary.BigEndian.Uint32(data[0:4])
+		sum := binary.BigEndian.Uint32(data[4:8])
+		if uint64(len(data)-recordHeaderSize) < uint64(n) {
+			break
+		}
+		payload := data[recordHeaderSize : recordHeaderSize+int(n)]
+		if crc32.Checksum(payload, crcTable) != sum {
+			break
+		}
+
+		var entry audit.AuditLog
+		if err := json.Unmarshal(payload, &entry); err != nil {
+			break
+		}
+		entries = append(entries, &entry)
+		data = data[recordHeaderSize+int(n):]
+	}
+	return entries, nil
+}
+
+// readAcks returns the record indexes listed in an ack file, which may be
+// missing. A torn trailing index is ignored.
+func readAcks(path string) (map[uint32]bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading spool ack file: %w", err)
+	}
+
+	acked := make(map[uint32]bool, len(data)/4)
+	for ; len(data) >= 4; data = data[4:] {
+		acked[binary.BigEndian.Uint32(data)] = true
+	}
+	return acked, nil
+}
+
+// syncDir fsyncs a directory so that file creations and removals in it
+// are durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("opening spool directory: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("syncing spool directory: %w", err)
+	}
+	return nil
+}
+
+// WithSpool makes the middleware append every entry to sp before queuing
+// it, so entries survive a crash of the process: records left in sp by a
+// previous process are replayed into the repository by the workers on
+// startup, and records are acked (and their segments deleted) once
+// persisted. Entries discarded by the overflow policy stay in the spool
+// until the next start.
+//
+// Entries reach the spool before the repository, so set
+// SpoolConfig.Redaction to keep secrets off the disk.
+func WithSpool(sp *Spool) Option {
+	return func(m *AuditMiddleware) {
+		m.spool = sp
+	}
+}
+
+// replaySpool queues the records recovered by the spool.
+func (m *AuditMiddleware) replaySpool() {
+	defer m.replayWG.Done()
+
+	m.spool.Replay(func(rec SpoolRecord) error {
+		m.jobs <- auditJob{
+			userID:   rec.Entry.UserID,
+			action:   rec.Entry.Action,
+			resource: rec.Entry.Resource,
+			built:    rec.Entry,
+			record:   &rec,
+		}
+		return nil
+	})
+}
+
+// spoolJob builds the entry of job and appends it to the spool. If the
+// append fails the entry is still queued, without crash protection.
+func (m *AuditMiddleware) spoolJob(job *auditJob) {
+	entry, err := job.entry()
+	if err != nil {
+		return // logged by the worker
+	}
+	job.built = entry
+
+	rec, err := m.spool.Append(entry)
+	if err != nil {
+		m.logger.Error("failed to spool audit log entry",
+			"error", err,
+			"user_id", job.userID,
+			"resource", job.resource,
+			"action", job.action,
+		)
+		return
+	}
+	job.record = &rec
+}
+
+// ack acknowledges the spool record of a persisted job.
+func (m *AuditMiddleware) ack(job auditJob) {
+	if job.record == nil {
+		return
+	}
+	if err := m.spool.Ack(*job.record); err != nil {
+		m.logger.Error("failed to acknowledge audit spool record", "error", err)
+	}
+}
@@ -0,0 +1,264 @@
+package httpaudit
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func replayAll(t *testing.T, sp *Spool) []SpoolRecord {
+	t.Helper()
+	var recs []SpoolRecord
+	if err := sp.Replay(func(rec SpoolRecord) error {
+		recs = append(recs, rec)
+		return nil
+	}); err != nil {
+		t.Fatalf("Replay returned error: %v", err)
+	}
+	return recs
+}
+
+func TestSpool_ReplaysUnackedRecords(t *testing.T) {
+	dir := t.TempDir()
+
+	sp, err := OpenSpool(SpoolConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("OpenSpool returned error: %v", err)
+	}
+	acked, _ := sp.Append(spillEntry(t, "acked"))
+	sp.Append(spillEntry(t, "lost-1"))
+	sp.Append(spillEntry(t, "lost-2"))
+	sp.Ack(acked)
+	if err := sp.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	sp, err = OpenSpool(SpoolConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("reopening spool: %v", err)
+	}
+	defer sp.Close()
+
+	recs := replayAll(t, sp)
+	if len(recs) != 2 || recs[0].Entry.ResourceID != "lost-1" || recs[1].Entry.ResourceID != "lost-2" {
+		t.Fatalf("replayed %d records, want the 2 unacked ones in order", len(recs))
+	}
+
+	for _, rec := range recs {
+		if err := sp.Ack(rec); err != nil {
+			t.Fatalf("Ack returned error: %v", err)
+		}
+	}
+	if files := segmentFiles(t, dir); len(files) != 1 {
+		t.Errorf("expected only the active segment after acking the replay, got %v", files)
+	}
+	if recs := replayAll(t, sp); len(recs) != 0 {
+		t.Errorf("expected nothing left to replay, got %d", len(recs))
+	}
+}
+
+func TestSpool_RotatesAndDeletesAckedSegments(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := OpenSpool(SpoolConfig{Dir: dir, SegmentSize: 1, Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("OpenSpool returned error: %v", err)
+	}
+
+	var recs []SpoolRecord
+	for _, id := range []string{"a", "b", "c"} {
+		rec, err := sp.Append(spillEntry(t, id))
+		if err != nil {
+			t.Fatalf("Append returned error: %v", err)
+		}
+		recs = append(recs, rec)
+	}
+	if files := segmentFiles(t, dir); len(files) != 3 {
+		t.Fatalf("expected one segment per record, got %v", files)
+	}
+
+	for _, rec := range recs {
+		sp.Ack(rec)
+	}
+	if files := segmentFiles(t, dir); len(files) != 1 {
+		t.Errorf("expected sealed segments to be deleted once acked, got %v", files)
+	}
+
+	sp.Close()
+	if files := segmentFiles(t, dir); len(files) != 0 {
+		t.Errorf("expected the fully acked active segment to be deleted on Close, got %v", files)
+	}
+}
+
+func TestSpool_StopsAtCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	sp, _ := OpenSpool(SpoolConfig{Dir: dir})
+	sp.Append(spillEntry(t, "good"))
+	sp.Append(spillEntry(t, "torn"))
+	sp.Close()
+
+	files := segmentFiles(t, dir)
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a torn write of the last record.
+	if err := os.WriteFile(files[0], data[:len(data)-5], 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sp, err = OpenSpool(SpoolConfig{Dir: dir, Sync: SyncPeriodic})
+	if err != nil {
+		t.Fatalf("OpenSpool returned error: %v", err)
+	}
+	defer sp.Close()
+
+	recs := replayAll(t, sp)
+	if len(recs) != 1 || recs[0].Entry.ResourceID != "good" {
+		t.Fatalf("replayed %v, want only the intact record", recs)
+	}
+}
+
+func TestHandler_SpoolReplaysAndAcks(t *testing.T) {
+	dir := t.TempDir()
+
+	// A previous process spooled an entry and crashed before persisting it.
+	sp, _ := OpenSpool(SpoolConfig{Dir: dir})
+	sp.Append(spillEntry(t, "from-crash"))
+	sp.Close()
+
+	sp, err := OpenSpool(SpoolConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("OpenSpool returned error: %v", err)
+	}
+	repo := &mockRepo{}
+	mw := NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+		WithSpool(sp),
+	)
+
+	mux := http.NewServeMux()
+	r := mw.Handler()(mux)
+	mux.HandleFunc("GET /v1/orders/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/orders/live", nil))
+
+	mw.Shutdown()
+	if err := sp.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	got := map[string]bool{}
+	for _, e := range repo.getEntries() {
+		got[e.ResourceID] = true
+	}
+	if !got["from-crash"] || !got["live"] {
+		t.Errorf("persisted %v, want the replayed and the live entry", got)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected segments and ack files deleted once persisted, got %v", files)
+	}
+}
+
+// storedRepo ignores entries whose ID it already stores, like
+// pgxaudit.PostgresRepo.
+type storedRepo struct {
+	mockRepo
+}
+
+func (r *storedRepo) Create(ctx context.Context, entry *audit.AuditLog) error {
+	for _, e := range r.getEntries() {
+		if e.ID == entry.ID {
+			return nil
+		}
+	}
+	return r.mockRepo.Create(ctx, entry)
+}
+
+func TestHandler_SpoolReplayOfPersistedRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	// A previous process persisted a spooled entry and crashed before
+	// acknowledging it.
+	repo := &storedRepo{}
+	sp, _ := OpenSpool(SpoolConfig{Dir: dir})
+	entry := spillEntry(t, "persisted")
+	sp.Append(entry)
+	repo.Create(context.Background(), entry)
+	sp.Close()
+
+	sp, err := OpenSpool(SpoolConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("OpenSpool returned error: %v", err)
+	}
+	mw := NewAuditMiddleware(repo, slog.Default(),
+		func(_ context.Context) *UserInfo { return &UserInfo{UserID: "u1"} },
+		WithSpool(sp),
+		WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+	)
+	mw.Shutdown()
+	if err := sp.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	if entries := repo.getEntries(); len(entries) != 1 {
+		t.Errorf("expected the entry stored once, got %d", len(entries))
+	}
+	if stats := mw.Stats(); stats != (Stats{}) {
+		t.Errorf("Stats = %+v, want the replay counted as persisted", stats)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected the replayed record acked, got %v", files)
+	}
+}
+
+func TestSpool_RedactsBeforeWriting(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := OpenSpool(SpoolConfig{Dir: dir, Redaction: audit.DefaultRedactionPolicy()})
+	if err != nil {
+		t.Fatalf("OpenSpool returned error: %v", err)
+	}
+
+	entry := spillEntry(t, "ord-1")
+	entry.Details = map[string]any{"password": "hunter2", "ssn": "123-45-6789"}
+	rec, err := sp.Append(entry)
+	if err != nil {
+		t.Fatalf("Append returned error: %v", err)
+	}
+	if rec.Entry.Details["password"] != "hunter2" {
+		t.Errorf("expected the appended entry unchanged, got %v", rec.Entry.Details)
+	}
+	sp.Close()
+
+	for _, file := range segmentFiles(t, dir) {
+		content, _ := os.ReadFile(file)
+		if strings.Contains(string(content), "hunter2") || strings.Contains(string(content), "123-45-6789") {
+			t.Errorf("segment %s holds secrets in clear: %s", file, content)
+		}
+	}
+
+	sp, err = OpenSpool(SpoolConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("reopening spool: %v", err)
+	}
+	defer sp.Close()
+	recs := replayAll(t, sp)
+	if len(recs) != 1 || recs[0].Entry.Details["password"] != "***" {
+		t.Errorf("expected the redacted entry replayed, got %v", recs)
+	}
+}
@@ -0,0 +1,43 @@
+package httpaudit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseWriter_IgnoresInformationalStatus(t *testing.T) {
+	w := newResponseWriter(httptest.NewRecorder())
+	w.WriteHeader(http.StatusEarlyHints)
+	w.WriteHeader(http.StatusAccepted)
+
+	if w.Status() != http.StatusAccepted {
+		t.Errorf("Status = %d, want %d", w.Status(), http.StatusAccepted)
+	}
+}
+
+func TestResponseWriter_ImplicitStatusAndSize(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := newResponseWriter(rec)
+	w.Write([]byte("hello"))
+	w.Write([]byte(" world"))
+
+	if w.Status() != http.StatusOK || w.BytesWritten() != 11 {
+		t.Errorf("Status, BytesWritten = %d, %d, want 200, 11", w.Status(), w.BytesWritten())
+	}
+}
+
+func TestResponseWriter_ResponseController(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := newResponseWriter(rec)
+
+	if err := http.NewResponseController(w).Flush(); err != nil {
+		t.Fatalf("Flush returned error: %v", err)
+	}
+	if !rec.Flushed || w.Status() != http.StatusOK {
+		t.Errorf("expected the flush to reach the recorder with an implicit 200")
+	}
+	if _, _, err := w.Hijack(); err == nil {
+		t.Error("expected Hijack to fail on a writer that does not support it")
+	}
+}
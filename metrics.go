@@ -0,0 +1,190 @@
+package audit
+
+import (
+	"expvar"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric names reported by the middleware and the repositories.
+const (
+	// MetricEnqueued counts entries accepted by the middleware queue.
+	MetricEnqueued = "audit_entries_enqueued_total"
+	// MetricDropped counts entries discarded because the queue was full,
+	// labelled by overflow policy.
+	MetricDropped = "audit_entries_dropped_total"
+	// MetricSpilled counts entries appended to the spill buffer.
+	MetricSpilled = "audit_entries_spilled_total"
+	// MetricPersisted counts entries written to the repository.
+	MetricPersisted = "audit_entries_persisted_total"
+	// MetricFailed counts entries that were neither persisted nor
+	// dead-lettered.
+	MetricFailed = "audit_entries_failed_total"
+	// MetricRetried counts write attempts after the first.
+	MetricRetried = "audit_write_retries_total"
+	// MetricDeadLettered counts entries accepted by the dead-letter sink.
+	MetricDeadLettered = "audit_entries_dead_lettered_total"
+	// MetricWriteDuration is the latency of middleware repository writes,
+	// labelled by op (create, create_batch) and result (ok, error).
+	MetricWriteDuration = "audit_write_duration_seconds"
+	// MetricQueueDepth is the number of entries waiting in the queue.
+	MetricQueueDepth = "audit_queue_depth"
+	// MetricDBOperations counts database operations of the pgxaudit
+	// repository and pool, labelled by op and result (ok, error).
+	MetricDBOperations = "audit_db_operations_total"
+	// MetricDBDuration is the latency of those operations, labelled by op.
+	MetricDBDuration = "audit_db_operation_duration_seconds"
+)
+
+// Label is a metric dimension.
+type Label struct {
+	Key   string
+	Value string
+}
+
+// Metrics receives the measurements of the audit pipeline. Implement it to
+// export them to Prometheus, OpenTelemetry or another system; the metric
+// names are the Metric* constants.
+type Metrics interface {
+	// Add increments the counter name by delta.
+	Add(name string, delta int64, labels ...Label)
+	// Set sets the gauge name to value.
+	Set(name string, value int64, labels ...Label)
+	// Observe records a latency sample in the histogram name.
+	Observe(name string, d time.Duration, labels ...Label)
+}
+
+// NopMetrics discards all measurements.
+type NopMetrics struct{}
+
+func (NopMetrics) Add(string, int64, ...Label)             {}
+func (NopMetrics) Set(string, int64, ...Label)             {}
+func (NopMetrics) Observe(string, time.Duration, ...Label) {}
+
+// expvarBuckets are the histogram upper bounds used by ExpvarMetrics.
+var expvarBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// ExpvarMetrics publishes the measurements as an expvar map, served as JSON
+// on /debug/vars by expvar's handler. Keys are the metric name followed by
+// its labels, e.g. audit_entries_dropped_total{policy="drop-newest"}.
+// Histograms report their count, sum and cumulative bucket counts.
+type ExpvarMetrics struct {
+	vars *expvar.Map
+
+	mu         sync.Mutex
+	histograms map[string]*histogram
+}
+
+// NewExpvarMetrics publishes a new expvar map under name. Like
+// expvar.Publish, it panics if name is already in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	return &ExpvarMetrics{
+		vars:       expvar.NewMap(name),
+		histograms: map[string]*histogram{},
+	}
+}
+
+// Add implements Metrics.
+func (m *ExpvarMetrics) Add(name string, delta int64, labels ...Label) {
+	m.vars.Add(metricKey(name, labels), delta)
+}
+
+// Set implements Metrics.
+func (m *ExpvarMetrics) Set(name string, value int64, labels ...Label) {
+	key := metricKey(name, labels)
+
+	m.mu.Lock()
+	v, ok := m.vars.Get(key).(*expvar.Int)
+	if !ok {
+		v = new(expvar.Int)
+		m.vars.Set(key, v)
+	}
+	m.mu.Unlock()
+
+	v.Set(value)
+}
+
+// Observe implements Metrics.
+func (m *ExpvarMetrics) Observe(name string, d time.Duration, labels ...Label) {
+	key := metricKey(name, labels)
+
+	m.mu.Lock()
+	h, ok := m.histograms[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(expvarBuckets))}
+		m.histograms[key] = h
+		m.vars.Set(key, h)
+	}
+	m.mu.Unlock()
+
+	h.observe(d)
+}
+
+// Vars returns the published map, e.g. to read a value in tests.
+func (m *ExpvarMetrics) Vars() *expvar.Map {
+	return m.vars
+}
+
+// metricKey formats name and labels as name{k1="v1",k2="v2"}.
+func metricKey(name string, labels []Label) string {
+	if len(labels) == 0 {
+		return name
+	}
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.Key)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(l.Value))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// histogram is an expvar.Var counting samples in expvarBuckets.
+type histogram struct {
+	mu     sync.Mutex
+	count  uint64
+	sum    time.Duration
+	counts []uint64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.count++
+	h.sum += d
+	for i, bound := range expvarBuckets {
+		if d <= bound {
+			h.counts[i]++
+		}
+	}
+}
+
+// String renders the histogram as JSON.
+func (h *histogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `{"count": %d, "sum": %g, "buckets": {`, h.count, h.sum.Seconds())
+	for i, bound := range expvarBuckets {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, `"%g": %d`, bound.Seconds(), h.counts[i])
+	}
+	b.WriteString("}}")
+	return b.String()
+}
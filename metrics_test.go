@@ -0,0 +1,64 @@
+package audit_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// expvarRuns makes the names published by the tests unique, since expvar
+// names cannot be reused within a process (e.g. with go test -count=2).
+var expvarRuns atomic.Int64
+
+func expvarName(t *testing.T) string {
+	return fmt.Sprintf("%s_%d", t.Name(), expvarRuns.Add(1))
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	name := expvarName(t)
+	m := audit.NewExpvarMetrics(name)
+
+	m.Add(audit.MetricEnqueued, 2)
+	m.Add(audit.MetricEnqueued, 1)
+	m.Add(audit.MetricDropped, 1, audit.Label{Key: "policy", Value: "drop-newest"})
+	m.Set(audit.MetricQueueDepth, 7)
+	m.Set(audit.MetricQueueDepth, 3)
+	m.Observe(audit.MetricWriteDuration, 3*time.Millisecond, audit.Label{Key: "op", Value: "create"})
+	m.Observe(audit.MetricWriteDuration, 2*time.Second, audit.Label{Key: "op", Value: "create"})
+
+	vars := m.Vars()
+	if got := vars.Get(audit.MetricEnqueued).(*expvar.Int).Value(); got != 3 {
+		t.Errorf("enqueued = %d, want 3", got)
+	}
+	if got := vars.Get(`audit_entries_dropped_total{policy="drop-newest"}`).(*expvar.Int).Value(); got != 1 {
+		t.Errorf("dropped = %d, want 1", got)
+	}
+	if got := vars.Get(audit.MetricQueueDepth).(*expvar.Int).Value(); got != 3 {
+		t.Errorf("queue depth = %d, want 3", got)
+	}
+
+	hist := vars.Get(`audit_write_duration_seconds{op="create"}`)
+	var decoded struct {
+		Count   int            `json:"count"`
+		Sum     float64        `json:"sum"`
+		Buckets map[string]int `json:"buckets"`
+	}
+	if err := json.Unmarshal([]byte(hist.String()), &decoded); err != nil {
+		t.Fatalf("histogram is not valid JSON: %v\n%s", err, hist.String())
+	}
+	if decoded.Count != 2 || decoded.Sum < 2 {
+		t.Errorf("histogram count=%d sum=%g, want 2 samples summing over 2s", decoded.Count, decoded.Sum)
+	}
+	if decoded.Buckets["0.005"] != 1 || decoded.Buckets["2.5"] != 2 || decoded.Buckets["0.001"] != 0 {
+		t.Errorf("unexpected cumulative buckets %v", decoded.Buckets)
+	}
+
+	if expvar.Get(name) != m.Vars() {
+		t.Error("expected the map to be published")
+	}
+}
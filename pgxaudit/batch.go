@@ -0,0 +1,159 @@
+package pgxaudit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// auditLogColumnNames is auditLogColumns as a list, for COPY.
+var auditLogColumnNames = func() []string {
+	names := strings.Split(auditLogColumns, ",")
+	for i, n := range names {
+		names[i] = strings.TrimSpace(n)
+	}
+	return names
+}()
+
+// CreateBatch implements audit.BatchRepository. It writes entries with a
+// single COPY inside a transaction; with WithHashChain the entries are
+// chained in slice order under one lock of the chain head.
+//
+// If the COPY fails because of the data of an entry, e.g. one violates a
+// constraint, the entries are written one by one and the failures are
+// reported in an *audit.BatchError. Other COPY failures, such as a lost
+// connection or an expired context, fail the whole batch. Entries that cannot be serialized are reported the
+// same way without failing the rest of the batch.
+func (r *PostgresRepo) CreateBatch(ctx context.Context, entries []*audit.AuditLog) (err error) {
+	defer observe(r.metrics, "create_batch", time.Now(), &err)
+
+	var failures []audit.BatchEntryError
+	var pending []int
+	for i, e := range entries {
+		if _, err := auditLogValues(e); err != nil {
+			failures = append(failures, audit.BatchEntryError{Index: i, Err: err})
+			continue
+		}
+		pending = append(pending, i)
+	}
+	if len(pending) == 0 {
+		return batchError(failures)
+	}
+
+	batch := make([]*audit.AuditLog, len(pending))
+	for i, idx := range pending {
+		batch[i] = entries[idx]
+	}
+
+	copied, err := r.copyBatch(ctx, batch)
+	if err != nil {
+		return err
+	}
+	if !copied {
+		for _, idx := range pending {
+			if err := r.Create(ctx, entries[idx]); err != nil {
+				failures = append(failures, audit.BatchEntryError{Index: idx, Err: err})
+			}
+		}
+	}
+
+	return batchError(failures)
+}
+
+// copyBatch writes entries with COPY in one transaction. It reports false
+// without an error if the COPY was rejected because of the data of an
+// entry, in which case nothing was written and the entries can be retried
+// individually.
+func (r *PostgresRepo) copyBatch(ctx context.Context, entries []*audit.AuditLog) (bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("beginning batch transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var seq int64
+	var head string
+	if r.chain {
+		err := tx.QueryRow(ctx,
+			`SELECT seq, hash FROM audit.audit_chain_head WHERE id = 1 FOR UPDATE`,
+		).Scan(&seq, &head)
+		if err != nil {
+			return false, fmt.Errorf("locking chain head: %w", err)
+		}
+		for _, b := range entries {
+			seq++
+			b.ChainSeq = seq
+			b.PrevHash = head
+			b.Hash, err = b.ComputeHash()
+			if err != nil {
+				return false, fmt.Errorf("hashing audit log entry: %w", err)
+			}
+			head = b.Hash
+		}
+	}
+
+	rows := make([][]any, len(entries))
+	for i, b := range entries {
+		// Serialization was checked by the caller.
+		rows[i], _ = auditLogValues(b)
+	}
+
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"audit", "audit_logentry"},
+		auditLogColumnNames,
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		if isRowError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("copying batch: %w", err)
+	}
+
+	if r.chain {
+		_, err = tx.Exec(ctx,
+			`UPDATE audit.audit_chain_head SET seq = $1, hash = $2 WHERE id = 1`,
+			seq, head,
+		)
+		if err != nil {
+			return false, fmt.Errorf("advancing chain head: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("committing batch transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// isRowError reports whether err is a PostgreSQL data exception (class 22)
+// or integrity constraint violation (class 23), raised by the values of a
+// row rather than by the connection or the transaction.
+func isRowError(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23")
+}
+
+// batchError returns failures as an *audit.BatchError in batch order, or
+// nil if there are none.
+func batchError(failures []audit.BatchEntryError) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	slices.SortFunc(failures, func(a, b audit.BatchEntryError) int {
+		return a.Index - b.Index
+	})
+	return &audit.BatchError{Failures: failures}
+}
@@ -0,0 +1,208 @@
+package pgxaudit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// copyTx is a mockTx that also implements CopyFrom.
+type copyTx struct {
+	*mockTx
+	copyFn func(table pgx.Identifier, columns []string, rows [][]any) error
+}
+
+func (c *copyTx) CopyFrom(_ context.Context, table pgx.Identifier, columns []string, src pgx.CopyFromSource) (int64, error) {
+	var rows [][]any
+	for src.Next() {
+		values, err := src.Values()
+		if err != nil {
+			return 0, err
+		}
+		rows = append(rows, values)
+	}
+	if c.copyFn != nil {
+		if err := c.copyFn(table, columns, rows); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(rows)), nil
+}
+
+func batchEntries(t *testing.T, n int) []*audit.AuditLog {
+	t.Helper()
+	entries := make([]*audit.AuditLog, n)
+	for i := range entries {
+		entries[i], _ = audit.NewAuditLog("user-1", "alice", "", audit.ActionCreate, "orders", "", "", "", nil)
+	}
+	return entries
+}
+
+func TestPostgresRepo_CreateBatch_Copy(t *testing.T) {
+	var copied [][]any
+	tx := &copyTx{
+		mockTx: &mockTx{},
+		copyFn: func(table pgx.Identifier, columns []string, rows [][]any) error {
+			if table.Sanitize() != `"audit"."audit_logentry"` {
+				t.Errorf("unexpected table %v", table)
+			}
+			if len(columns) != 26 || columns[0] != "id" || columns[25] != "roles" {
+				t.Errorf("unexpected columns %v", columns)
+			}
+			copied = rows
+			return nil
+		},
+	}
+	db := &mockDB{beginFn: func(_ context.Context) (pgx.Tx, error) { return tx, nil }}
+
+	entries := batchEntries(t, 3)
+	if err := NewPostgresRepo(db).CreateBatch(context.Background(), entries); err != nil {
+		t.Fatalf("CreateBatch returned error: %v", err)
+	}
+
+	if len(copied) != 3 || copied[2][0] != entries[2].ID {
+		t.Errorf("expected the 3 entries to be copied in order, got %d rows", len(copied))
+	}
+	if !tx.committed {
+		t.Error("expected batch transaction to be committed")
+	}
+}
+
+func TestPostgresRepo_CreateBatch_FallsBackPerEntry(t *testing.T) {
+	entries := batchEntries(t, 3)
+	dup := &pgconn.PgError{Code: "23514", Message: "check constraint violated"}
+
+	tx := &copyTx{
+		mockTx: &mockTx{},
+		copyFn: func(pgx.Identifier, []string, [][]any) error { return dup },
+	}
+	var inserted int
+	db := &mockDB{
+		beginFn: func(_ context.Context) (pgx.Tx, error) { return tx, nil },
+		execFn: func(_ context.Context, _ string, args ...any) (pgconn.CommandTag, error) {
+			if args[0] == entries[1].ID {
+				return pgconn.CommandTag{}, dup
+			}
+			inserted++
+			return pgconn.CommandTag{}, nil
+		},
+	}
+
+	err := NewPostgresRepo(db).CreateBatch(context.Background(), entries)
+
+	var be *audit.BatchError
+	if !errors.As(err, &be) {
+		t.Fatalf("expected *audit.BatchError, got %v", err)
+	}
+	if len(be.Failures) != 1 || be.Failures[0].Index != 1 || !be.Failed(1) || be.Failed(0) {
+		t.Errorf("expected only entry 1 to fail, got %+v", be.Failures)
+	}
+	if !errors.Is(err, dup) {
+		t.Error("expected BatchError to unwrap to the entry error")
+	}
+	if inserted != 2 {
+		t.Errorf("expected 2 entries inserted individually, got %d", inserted)
+	}
+	if tx.committed {
+		t.Error("expected failed batch transaction to be rolled back")
+	}
+}
+
+func TestPostgresRepo_CreateBatch_ReportsUnserializableEntries(t *testing.T) {
+	entries := batchEntries(t, 3)
+	entries[0].Details = map[string]any{"bad": make(chan int)}
+
+	var copied int
+	tx := &copyTx{
+		mockTx: &mockTx{},
+		copyFn: func(_ pgx.Identifier, _ []string, rows [][]any) error {
+			copied = len(rows)
+			return nil
+		},
+	}
+	db := &mockDB{beginFn: func(_ context.Context) (pgx.Tx, error) { return tx, nil }}
+
+	err := NewPostgresRepo(db).CreateBatch(context.Background(), entries)
+
+	var be *audit.BatchError
+	if !errors.As(err, &be) || len(be.Failures) != 1 || be.Failures[0].Index != 0 {
+		t.Fatalf("expected entry 0 to fail, got %v", err)
+	}
+	if copied != 2 {
+		t.Errorf("expected the other 2 entries to be copied, got %d", copied)
+	}
+}
+
+func TestPostgresRepo_CreateBatch_HashChain(t *testing.T) {
+	var headArgs []any
+	tx := &copyTx{
+		mockTx: &mockTx{
+			queryRowFn: func(_ context.Context, _ string, _ ...any) pgx.Row {
+				return &valueRow{values: []any{int64(41), "prevhash"}}
+			},
+			execFn: func(_ context.Context, _ string, args ...any) (pgconn.CommandTag, error) {
+				headArgs = args
+				return pgconn.CommandTag{}, nil
+			},
+		},
+	}
+	db := &mockDB{beginFn: func(_ context.Context) (pgx.Tx, error) { return tx, nil }}
+
+	entries := batchEntries(t, 2)
+	if err := NewPostgresRepo(db, WithHashChain()).CreateBatch(context.Background(), entries); err != nil {
+		t.Fatalf("CreateBatch returned error: %v", err)
+	}
+
+	if entries[0].ChainSeq != 42 || entries[0].PrevHash != "prevhash" {
+		t.Errorf("first entry: seq=%d prev=%q", entries[0].ChainSeq, entries[0].PrevHash)
+	}
+	if entries[1].ChainSeq != 43 || entries[1].PrevHash != entries[0].Hash {
+		t.Errorf("second entry not linked to the first: seq=%d prev=%q", entries[1].ChainSeq, entries[1].PrevHash)
+	}
+	if headArgs[0] != int64(43) || headArgs[1] != entries[1].Hash {
+		t.Errorf("expected chain head advanced to the last entry, got %v", headArgs)
+	}
+}
+
+func TestPostgresRepo_CreateBatch_CopyConnectionError(t *testing.T) {
+	tx := &copyTx{
+		mockTx: &mockTx{},
+		copyFn: func(pgx.Identifier, []string, [][]any) error { return context.DeadlineExceeded },
+	}
+	var inserted int
+	db := &mockDB{
+		beginFn: func(_ context.Context) (pgx.Tx, error) { return tx, nil },
+		execFn: func(_ context.Context, _ string, _ ...any) (pgconn.CommandTag, error) {
+			inserted++
+			return pgconn.CommandTag{}, nil
+		},
+	}
+
+	err := NewPostgresRepo(db).CreateBatch(context.Background(), batchEntries(t, 3))
+
+	var be *audit.BatchError
+	if err == nil || errors.As(err, &be) {
+		t.Fatalf("expected a whole-batch error, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the COPY error to be wrapped, got %v", err)
+	}
+	if inserted != 0 {
+		t.Errorf("expected no individual inserts, got %d", inserted)
+	}
+}
+
+func TestPostgresRepo_CreateBatch_BeginError(t *testing.T) {
+	db := &mockDB{}
+	err := NewPostgresRepo(db).CreateBatch(context.Background(), batchEntries(t, 2))
+
+	var be *audit.BatchError
+	if err == nil || errors.As(err, &be) {
+		t.Fatalf("expected a whole-batch error, got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package pgxaudit
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// entryRow returns entry as the values scanned for auditLogSelectColumns.
+func entryRow(t *testing.T, e *audit.AuditLog) []any {
+	t.Helper()
+	details, _ := json.Marshal(e.Details)
+	changed, _ := json.Marshal(e.ChangedFields)
+	return []any{
+		e.ID, e.UserID, e.Username, nullString(e.CorrelationID), string(e.Action),
+		e.Resource, e.ResourceID, e.IP, e.UserAgent,
+		details, changed, e.CreatedAt,
+		nullInt64(e.ChainSeq), nullString(e.PrevHash), nullString(e.Hash),
+		e.Signature, nullString(e.SignatureKeyID),
+		string(e.Outcome), string(e.Severity), e.Reason, e.TenantID,
+		string(e.ActorType), e.SubjectID, e.SubjectName, e.AuthMethod, e.Roles,
+		ingestedAt(e),
+	}
+}
+
+// ingestedAt returns the ingested_at value of e, NULL if unset.
+func ingestedAt(e *audit.AuditLog) any {
+	if e.IngestedAt.IsZero() {
+		return nil
+	}
+	return &e.IngestedAt
+}
+
+// buildChain returns n correctly linked entries.
+func buildChain(t *testing.T, n int) []*audit.AuditLog {
+	t.Helper()
+	var chain []*audit.AuditLog
+	prev := ""
+	for i := range n {
+		e, _ := audit.NewAuditLog("user-1", "alice", "", audit.ActionCreate, "orders", "", "", "",
+			map[string]any{"i": i},
+			func() time.Time { return time.Date(2025, 1, 1, 0, 0, i, 0, time.UTC) },
+		)
+		e.ChainSeq = int64(i + 1)
+		e.PrevHash = prev
+		e.Hash, _ = e.ComputeHash()
+		prev = e.Hash
+		chain = append(chain, e)
+	}
+	return chain
+}
+
+// chainDB serves chain entries for Verify and reports head as the chain head.
+func chainDB(t *testing.T, chain []*audit.AuditLog, headSeq int64, headHash string) *mockDB {
+	t.Helper()
+	return &mockDB{
+		queryFn: func(_ context.Context, _ string, _ ...any) (pgx.Rows, error) {
+			rows := &mockRows{}
+			for _, e := range chain {
+				rows.rows = append(rows.rows, entryRow(t, e))
+			}
+			return rows, nil
+		},
+		queryRowFn: func(_ context.Context, _ string, _ ...any) pgx.Row {
+			return &valueRow{values: []any{headSeq, headHash}}
+		},
+	}
+}
+
+func TestPostgresRepo_Create_HashChain(t *testing.T) {
+	var insertArgs []any
+	var headArgs []any
+	tx := &mockTx{
+		queryRowFn: func(_ context.Context, sql string, _ ...any) pgx.Row {
+			if !strings.Contains(sql, "FOR UPDATE") {
+				t.Errorf("expected chain head to be locked, got %q", sql)
+			}
+			return &valueRow{values: []any{int64(41), "prevhash"}}
+		},
+		execFn: func(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+			if strings.Contains(sql, "audit_chain_head") {
+				headArgs = args
+				return pgconn.NewCommandTag("UPDATE 1"), nil
+			}
+			insertArgs = args
+			return pgconn.NewCommandTag("INSERT 0 1"), nil
+		},
+	}
+	db := &mockDB{beginFn: func(_ context.Context) (pgx.Tx, error) { return tx, nil }}
+
+	repo := NewPostgresRepo(db, WithHashChain())
+	entry, _ := audit.NewAuditLog("user-1", "alice", "", audit.ActionCreate, "orders", "ord-1", "", "", nil)
+
+	if err := repo.Create(context.Background(), entry); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	if entry.ChainSeq != 42 || entry.PrevHash != "prevhash" {
+		t.Errorf("expected seq=42 prev=prevhash, got seq=%d prev=%q", entry.ChainSeq, entry.PrevHash)
+	}
+	want, _ := entry.ComputeHash()
+	if entry.Hash != want {
+		t.Errorf("Hash = %q, want %q", entry.Hash, want)
+	}
+	if *insertArgs[12].(*int64) != 42 || *insertArgs[14].(*string) != want {
+		t.Errorf("expected chain columns in insert, got %v %v", insertArgs[12], insertArgs[14])
+	}
+	if headArgs[0] != int64(42) || headArgs[1] != want {
+		t.Errorf("expected chain head advanced to (42, hash), got %v", headArgs)
+	}
+	if !tx.committed {
+		t.Error("expected chain transaction to be committed")
+	}
+}
+
+func TestPostgresRepo_Create_HashChainDuplicate(t *testing.T) {
+	headAdvanced := false
+	tx := &mockTx{
+		queryRowFn: func(_ context.Context, _ string, _ ...any) pgx.Row {
+			return &valueRow{values: []any{int64(41), "prevhash"}}
+		},
+		execFn: func(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+			if strings.Contains(sql, "audit_chain_head") {
+				headAdvanced = true
+			}
+			// The entry is already stored: ON CONFLICT DO NOTHING.
+			return pgconn.NewCommandTag("INSERT 0 0"), nil
+		},
+	}
+	db := &mockDB{beginFn: func(_ context.Context) (pgx.Tx, error) { return tx, nil }}
+
+	entry, _ := audit.NewAuditLog("user-1", "alice", "", audit.ActionCreate, "orders", "ord-1", "", "", nil)
+	if err := NewPostgresRepo(db, WithHashChain()).Create(context.Background(), entry); err != nil {
+		t.Fatalf("Create of a stored entry returned error: %v", err)
+	}
+	if headAdvanced || tx.committed {
+		t.Error("expected the chain head to stay put for an entry already stored")
+	}
+}
+
+func TestPostgresRepo_Verify_Intact(t *testing.T) {
+	chain := buildChain(t, 3)
+	repo := NewPostgresRepo(chainDB(t, chain, 3, chain[2].Hash))
+
+	brk, err := repo.Verify(context.Background(), 0, 0)
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if brk != nil {
+		t.Fatalf("expected intact chain, got %v", brk)
+	}
+}
+
+func TestPostgresRepo_Verify_DetectsTampering(t *testing.T) {
+	chain := buildChain(t, 3)
+	chain[1].Details = map[string]any{"i": 99}
+
+	brk, err := NewPostgresRepo(chainDB(t, chain, 3, chain[2].Hash)).Verify(context.Background(), 0, 0)
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if brk == nil || brk.Seq != 2 || brk.EntryID != chain[1].ID {
+		t.Fatalf("expected break at seq 2, got %v", brk)
+	}
+}
+
+func TestPostgresRepo_Verify_DetectsDeletion(t *testing.T) {
+	chain := buildChain(t, 3)
+
+	// Middle entry deleted.
+	brk, _ := NewPostgresRepo(chainDB(t, []*audit.AuditLog{chain[0], chain[2]}, 3, chain[2].Hash)).
+		Verify(context.Background(), 0, 0)
+	if brk == nil || brk.Seq != 2 {
+		t.Fatalf("expected break at seq 2, got %v", brk)
+	}
+
+	// Last entry deleted: only the chain head reveals it.
+	brk, _ = NewPostgresRepo(chainDB(t, chain[:2], 3, chain[2].Hash)).
+		Verify(context.Background(), 0, 0)
+	if brk == nil || brk.Seq != 3 {
+		t.Fatalf("expected break at seq 3, got %v", brk)
+	}
+}
+
+func TestPostgresRepo_Verify_BoundedRange(t *testing.T) {
+	chain := buildChain(t, 3)
+	db := &mockDB{
+		queryFn: func(_ context.Context, _ string, args ...any) (pgx.Rows, error) {
+			if args[0] != int64(2) || args[1] != int64(3) {
+				t.Errorf("unexpected range args %v", args)
+			}
+			return &mockRows{rows: [][]any{entryRow(t, chain[1]), entryRow(t, chain[2])}}, nil
+		},
+		queryRowFn: func(_ context.Context, _ string, _ ...any) pgx.Row {
+			// Predecessor of the range.
+			return &valueRow{values: []any{chain[0].Hash}}
+		},
+	}
+
+	brk, err := NewPostgresRepo(db).Verify(context.Background(), 2, 3)
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if brk != nil {
+		t.Fatalf("expected intact range, got %v", brk)
+	}
+}
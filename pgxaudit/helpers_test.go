@@ -1,6 +1,13 @@
 package pgxaudit
 
-import "testing"
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
 
 func TestNullString(t *testing.T) {
 	tests := []struct {
@@ -46,3 +53,99 @@ type mockScanner struct {
 func (m *mockScanner) Scan(_ ...any) error {
 	return m.err
 }
+
+// mockTx implements pgx.Tx for the methods used by the package. Calls to
+// any other method panic through the nil embedded interface.
+type mockTx struct {
+	pgx.Tx
+	execFn     func(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	queryFn    func(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	queryRowFn func(ctx context.Context, sql string, args ...any) pgx.Row
+	commitErr  error
+	committed  bool
+	rolledBack bool
+}
+
+func (m *mockTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if m.execFn != nil {
+		return m.execFn(ctx, sql, args...)
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+func (m *mockTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if m.queryFn != nil {
+		return m.queryFn(ctx, sql, args...)
+	}
+	return &mockRows{}, nil
+}
+
+func (m *mockTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if m.queryRowFn != nil {
+		return m.queryRowFn(ctx, sql, args...)
+	}
+	return &errorRow{err: pgx.ErrNoRows}
+}
+
+func (m *mockTx) Commit(_ context.Context) error {
+	if m.commitErr != nil {
+		return m.commitErr
+	}
+	m.committed = true
+	return nil
+}
+
+func (m *mockTx) Rollback(_ context.Context) error {
+	if !m.committed {
+		m.rolledBack = true
+	}
+	return nil
+}
+
+// mockRows implements pgx.Rows over in-memory values. Each row's values are
+// assigned to the Scan destinations by position.
+type mockRows struct {
+	pgx.Rows
+	rows [][]any
+	pos  int
+	err  error
+}
+
+func (m *mockRows) Next() bool {
+	if m.pos >= len(m.rows) {
+		return false
+	}
+	m.pos++
+	return true
+}
+
+func (m *mockRows) Scan(dest ...any) error {
+	return assignScan(m.rows[m.pos-1], dest)
+}
+
+func (m *mockRows) Close() {}
+
+func (m *mockRows) Err() error { return m.err }
+
+// valueRow implements pgx.Row over in-memory values.
+type valueRow struct {
+	values []any
+}
+
+func (r *valueRow) Scan(dest ...any) error {
+	return assignScan(r.values, dest)
+}
+
+// assignScan assigns values to Scan destinations by position. A nil value
+// zeroes the destination, mirroring a NULL column.
+func assignScan(values []any, dest []any) error {
+	for i, d := range dest {
+		v := reflect.ValueOf(d).Elem()
+		if values[i] == nil {
+			v.Set(reflect.Zero(v.Type()))
+			continue
+		}
+		v.Set(reflect.ValueOf(values[i]))
+	}
+	return nil
+}
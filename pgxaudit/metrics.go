@@ -0,0 +1,61 @@
+package pgxaudit
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// WithMetrics reports the count, result and latency of the repository
+// operations (create, create_batch, get_by_id, list, verify) to metrics as
+// audit.MetricDBOperations and audit.MetricDBDuration.
+func WithMetrics(metrics audit.Metrics) RepoOption {
+	return func(r *PostgresRepo) {
+		if metrics != nil {
+			r.metrics = metrics
+		}
+	}
+}
+
+// PoolOption configures an AuditPool.
+type PoolOption func(*AuditPool)
+
+// WithPoolMetrics reports the count, result and latency of the pool
+// operations (exec, query, query_row, begin) to metrics as
+// audit.MetricDBOperations and audit.MetricDBDuration. The latency of
+// query_row is measured until its Scan returns.
+func WithPoolMetrics(metrics audit.Metrics) PoolOption {
+	return func(p *AuditPool) {
+		if metrics != nil {
+			p.metrics = metrics
+		}
+	}
+}
+
+// observe records a database operation that started at start and failed
+// with *err, if not nil. It is meant to be deferred.
+func observe(metrics audit.Metrics, op string, start time.Time, err *error) {
+	result := "ok"
+	if *err != nil && !errors.Is(*err, pgx.ErrNoRows) {
+		result = "error"
+	}
+	opLabel := audit.Label{Key: "op", Value: op}
+	metrics.Observe(audit.MetricDBDuration, time.Since(start), opLabel)
+	metrics.Add(audit.MetricDBOperations, 1, opLabel, audit.Label{Key: "result", Value: result})
+}
+
+// observedRow is a pgx.Row that records the query_row operation once
+// scanned.
+type observedRow struct {
+	pgx.Row
+	metrics audit.Metrics
+	start   time.Time
+}
+
+func (r observedRow) Scan(dest ...any) (err error) {
+	defer observe(r.metrics, "query_row", r.start, &err)
+	return r.Row.Scan(dest...)
+}
@@ -0,0 +1,91 @@
+package pgxaudit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// recordingMetrics records operation counts as "op/result" and latency
+// samples per op.
+type recordingMetrics struct {
+	mu      sync.Mutex
+	ops     map[string]int64
+	samples map[string]int
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{ops: map[string]int64{}, samples: map[string]int{}}
+}
+
+func (r *recordingMetrics) Add(name string, delta int64, labels ...audit.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name == audit.MetricDBOperations {
+		r.ops[labels[0].Value+"/"+labels[1].Value] += delta
+	}
+}
+
+func (r *recordingMetrics) Set(string, int64, ...audit.Label) {}
+
+func (r *recordingMetrics) Observe(name string, _ time.Duration, labels ...audit.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name == audit.MetricDBDuration {
+		r.samples[labels[0].Value]++
+	}
+}
+
+func TestPostgresRepo_Metrics(t *testing.T) {
+	metrics := newRecordingMetrics()
+	db := &mockDB{
+		execFn: func(_ context.Context, _ string, _ ...any) (pgconn.CommandTag, error) {
+			return pgconn.CommandTag{}, nil
+		},
+		queryFn: func(_ context.Context, _ string, _ ...any) (pgx.Rows, error) {
+			return nil, errors.New("connection refused")
+		},
+		queryRowFn: func(_ context.Context, _ string, _ ...any) pgx.Row {
+			return &errorRow{err: pgx.ErrNoRows}
+		},
+	}
+	repo := NewPostgresRepo(db, WithMetrics(metrics))
+
+	entry, _ := audit.NewAuditLog("user-1", "alice", "", audit.ActionCreate, "orders", "", "", "", nil)
+	repo.Create(context.Background(), entry)
+	repo.List(context.Background(), audit.AuditFilters{})
+	repo.GetByID(context.Background(), uuid.New())
+
+	want := map[string]int64{"create/ok": 1, "list/error": 1, "get_by_id/ok": 1}
+	for key, n := range want {
+		if metrics.ops[key] != n {
+			t.Errorf("%s = %d, want %d (all: %v)", key, metrics.ops[key], n, metrics.ops)
+		}
+	}
+	if metrics.samples["create"] != 1 || metrics.samples["list"] != 1 {
+		t.Errorf("expected latency samples per op, got %v", metrics.samples)
+	}
+}
+
+func TestObservedRow_RecordsOnScan(t *testing.T) {
+	metrics := newRecordingMetrics()
+	row := observedRow{Row: &errorRow{err: errors.New("timeout")}, metrics: metrics, start: time.Now()}
+
+	if metrics.samples["query_row"] != 0 {
+		t.Fatal("expected nothing recorded before Scan")
+	}
+	if err := row.Scan(); err == nil {
+		t.Fatal("expected the row error")
+	}
+	if metrics.ops["query_row/error"] != 1 || metrics.samples["query_row"] != 1 {
+		t.Errorf("expected query_row recorded once, got %v %v", metrics.ops, metrics.samples)
+	}
+}
@@ -11,12 +11,56 @@ import (
 	"strings"
 )
 
-//go:embed migrations/*.sql
+//go:embed migrations/*.sql migrations/security/*.sql
 var embeddedMigrations embed.FS
 
+// Embedded migration sets. The security set is optional and applied after
+// the core set; its versions start at 100001 so both can share a folder.
+const (
+	coreMigrationsDir     = "migrations"
+	securityMigrationsDir = "migrations/security"
+)
+
 // MigrationFiles returns migration file names embedded in the package.
 func MigrationFiles() ([]string, error) {
-	entries, err := fs.ReadDir(embeddedMigrations, "migrations")
+	return migrationFiles(coreMigrationsDir)
+}
+
+// SecurityMigrationFiles returns the file names of the optional security
+// migration set: audit_writer/audit_reader roles without UPDATE, DELETE or
+// TRUNCATE, an append-only guard trigger, and row-level security keyed off
+// app.tenant_id. See VerifySecurity.
+func SecurityMigrationFiles() ([]string, error) {
+	return migrationFiles(securityMigrationsDir)
+}
+
+// CopyMigrations writes embedded migration files into dstDir.
+// It fails if any target file already exists.
+func CopyMigrations(dstDir string) error {
+	return copyMigrations(coreMigrationsDir, dstDir)
+}
+
+// CopySecurityMigrations writes the security migration set into dstDir.
+// It fails if any target file already exists.
+func CopySecurityMigrations(dstDir string) error {
+	return copyMigrations(securityMigrationsDir, dstDir)
+}
+
+// CopyGooseMigrations writes embedded migrations using Goose SQL format
+// (<version>_<name>.sql with -- +goose Up/Down sections).
+func CopyGooseMigrations(dstDir string) error {
+	return copyGooseMigrations(coreMigrationsDir, dstDir)
+}
+
+// CopyGooseSecurityMigrations writes the security migration set using Goose
+// SQL format.
+func CopyGooseSecurityMigrations(dstDir string) error {
+	return copyGooseMigrations(securityMigrationsDir, dstDir)
+}
+
+// migrationFiles returns the sorted file names of the migration set in dir.
+func migrationFiles(dir string) ([]string, error) {
+	entries, err := fs.ReadDir(embeddedMigrations, dir)
 	if err != nil {
 		return nil, fmt.Errorf("reading embedded migrations: %w", err)
 	}
@@ -32,14 +76,13 @@ func MigrationFiles() ([]string, error) {
 	return files, nil
 }
 
-// CopyMigrations writes embedded migration files into dstDir.
-// It fails if any target file already exists.
-func CopyMigrations(dstDir string) error {
+// copyMigrations writes the migration set in dir into dstDir.
+func copyMigrations(dir, dstDir string) error {
 	if err := os.MkdirAll(dstDir, 0o755); err != nil {
 		return fmt.Errorf("creating destination directory: %w", err)
 	}
 
-	files, err := MigrationFiles()
+	files, err := migrationFiles(dir)
 	if err != nil {
 		return err
 	}
@@ -52,7 +95,7 @@ func CopyMigrations(dstDir string) error {
 			return fmt.Errorf("checking existing migration %s: %w", target, err)
 		}
 
-		content, err := fs.ReadFile(embeddedMigrations, path.Join("migrations", name))
+		content, err := fs.ReadFile(embeddedMigrations, path.Join(dir, name))
 		if err != nil {
 			return fmt.Errorf("reading embedded migration %s: %w", name, err)
 		}
@@ -65,14 +108,14 @@ func CopyMigrations(dstDir string) error {
 	return nil
 }
 
-// CopyGooseMigrations writes embedded migrations using Goose SQL format
-// (<version>_<name>.sql with -- +goose Up/Down sections).
-func CopyGooseMigrations(dstDir string) error {
+// copyGooseMigrations writes the migration set in dir into dstDir using
+// Goose SQL format.
+func copyGooseMigrations(dir, dstDir string) error {
 	if err := os.MkdirAll(dstDir, 0o755); err != nil {
 		return fmt.Errorf("creating destination directory: %w", err)
 	}
 
-	files, err := MigrationFiles()
+	files, err := migrationFiles(dir)
 	if err != nil {
 		return err
 	}
@@ -122,12 +165,12 @@ func CopyGooseMigrations(dstDir string) error {
 			return fmt.Errorf("checking existing migration %s: %w", target, err)
 		}
 
-		upContent, err := fs.ReadFile(embeddedMigrations, path.Join("migrations", p.upFile))
+		upContent, err := fs.ReadFile(embeddedMigrations, path.Join(dir, p.upFile))
 		if err != nil {
 			return fmt.Errorf("reading embedded migration %s: %w", p.upFile, err)
 		}
 
-		downContent, err := fs.ReadFile(embeddedMigrations, path.Join("migrations", p.downFile))
+		downContent, err := fs.ReadFile(embeddedMigrations, path.Join(dir, p.downFile))
 		if err != nil {
 			return fmt.Errorf("reading embedded migration %s: %w", p.downFile, err)
 		}
@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS audit.log_row_change() CASCADE;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS audit.audit_chain_head;
+DROP INDEX IF EXISTS audit.audit_logentry_chain_seq_idx;
+
+ALTER TABLE audit.audit_logentry
+    DROP COLUMN IF EXISTS hash,
+    DROP COLUMN IF EXISTS prev_hash,
+    DROP COLUMN IF EXISTS chain_seq;
@@ -0,0 +1,19 @@
+ALTER TABLE audit.audit_logentry
+    ADD COLUMN IF NOT EXISTS chain_seq BIGINT,
+    ADD COLUMN IF NOT EXISTS prev_hash TEXT,
+    ADD COLUMN IF NOT EXISTS hash      TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS audit_logentry_chain_seq_idx
+    ON audit.audit_logentry (chain_seq)
+    WHERE chain_seq IS NOT NULL;
+
+-- Single-row table holding the tip of the hash chain. Writers lock this row
+-- (SELECT ... FOR UPDATE) to append, which serializes chain appends across
+-- connections and processes.
+CREATE TABLE IF NOT EXISTS audit.audit_chain_head (
+    id   INT PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    seq  BIGINT NOT NULL DEFAULT 0,
+    hash TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO audit.audit_chain_head (id) VALUES (1) ON CONFLICT DO NOTHING;
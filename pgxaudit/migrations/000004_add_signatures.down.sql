@@ -0,0 +1,3 @@
+ALTER TABLE audit.audit_logentry
+    DROP COLUMN IF EXISTS signature_key_id,
+    DROP COLUMN IF EXISTS signature;
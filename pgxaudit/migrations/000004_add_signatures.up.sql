@@ -0,0 +1,3 @@
+ALTER TABLE audit.audit_logentry
+    ADD COLUMN IF NOT EXISTS signature        BYTEA,
+    ADD COLUMN IF NOT EXISTS signature_key_id TEXT;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS audit.audit_logentry_outcome_idx;
+
+ALTER TABLE audit.audit_logentry
+    DROP COLUMN IF EXISTS reason,
+    DROP COLUMN IF EXISTS severity,
+    DROP COLUMN IF EXISTS outcome;
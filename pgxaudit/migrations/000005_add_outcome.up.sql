@@ -0,0 +1,7 @@
+ALTER TABLE audit.audit_logentry
+    ADD COLUMN IF NOT EXISTS outcome  TEXT NOT NULL DEFAULT 'unknown',
+    ADD COLUMN IF NOT EXISTS severity TEXT NOT NULL DEFAULT 'info',
+    ADD COLUMN IF NOT EXISTS reason   TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS audit_logentry_outcome_idx
+    ON audit.audit_logentry (outcome, action, created_at);
@@ -0,0 +1,74 @@
+-- Restore the row-change trigger function of 000002.
+CREATE OR REPLACE FUNCTION audit.log_row_change() RETURNS trigger
+LANGUAGE plpgsql AS $$
+DECLARE
+    id_column TEXT   := 'id';
+    excluded  TEXT[] := '{}';
+    old_row   JSONB  := '{}';
+    new_row   JSONB  := '{}';
+    changed   JSONB  := '{}';
+    col       TEXT;
+    row_id    TEXT;
+BEGIN
+    IF TG_NARGS > 0 THEN
+        id_column := TG_ARGV[0];
+    END IF;
+    IF TG_NARGS > 1 THEN
+        excluded := TG_ARGV[1:TG_NARGS - 1];
+    END IF;
+
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        old_row := to_jsonb(OLD);
+        row_id := old_row ->> id_column;
+        old_row := old_row - excluded;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        new_row := to_jsonb(NEW);
+        row_id := new_row ->> id_column;
+        new_row := new_row - excluded;
+    END IF;
+
+    FOR col IN SELECT jsonb_object_keys(old_row || new_row) LOOP
+        IF (old_row -> col) IS DISTINCT FROM (new_row -> col) THEN
+            changed := changed || jsonb_build_object(
+                col, jsonb_build_object('old', old_row -> col, 'new', new_row -> col)
+            );
+        END IF;
+    END LOOP;
+
+    -- Nothing but excluded columns changed.
+    IF TG_OP = 'UPDATE' AND changed = '{}' THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO audit.audit_logentry (
+        id, user_id, username, correlation_id, action, resource, resource_id,
+        ip, user_agent, details, changed_fields, created_at
+    ) VALUES (
+        gen_random_uuid(),
+        COALESCE(current_setting('app.user_id', true), ''),
+        COALESCE(current_setting('app.username', true), ''),
+        NULLIF(current_setting('app.correlation_id', true), ''),
+        CASE TG_OP WHEN 'INSERT' THEN 'CREATE' WHEN 'UPDATE' THEN 'UPDATE' ELSE 'DELETE' END,
+        TG_TABLE_SCHEMA || '.' || TG_TABLE_NAME,
+        COALESCE(row_id, ''),
+        COALESCE(current_setting('app.ip', true), ''),
+        COALESCE(current_setting('app.user_agent', true), ''),
+        jsonb_build_object(
+            'source', 'trigger',
+            'operation', TG_OP,
+            'request_resource', COALESCE(current_setting('app.resource', true), ''),
+            'request_resource_id', COALESCE(current_setting('app.resource_id', true), '')
+        ),
+        changed,
+        now()
+    );
+
+    RETURN NULL;
+END;
+$$;
+
+DROP INDEX IF EXISTS audit.audit_logentry_tenant_idx;
+
+ALTER TABLE audit.audit_logentry
+    DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,88 @@
+ALTER TABLE audit.audit_logentry
+    ADD COLUMN IF NOT EXISTS actor_type   TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS subject_id   TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS subject_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS auth_method  TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS roles        TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS audit_logentry_subject_idx
+    ON audit.audit_logentry (subject_id, created_at)
+    WHERE subject_id <> '';
+
+-- Record the actor model of row changes from the app.* session variables.
+CREATE OR REPLACE FUNCTION audit.log_row_change() RETURNS trigger
+LANGUAGE plpgsql AS $$
+DECLARE
+    id_column TEXT   := 'id';
+    excluded  TEXT[] := '{}';
+    old_row   JSONB  := '{}';
+    new_row   JSONB  := '{}';
+    changed   JSONB  := '{}';
+    col       TEXT;
+    row_id    TEXT;
+BEGIN
+    IF TG_NARGS > 0 THEN
+        id_column := TG_ARGV[0];
+    END IF;
+    IF TG_NARGS > 1 THEN
+        excluded := TG_ARGV[1:TG_NARGS - 1];
+    END IF;
+
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        old_row := to_jsonb(OLD);
+        row_id := old_row ->> id_column;
+        old_row := old_row - excluded;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        new_row := to_jsonb(NEW);
+        row_id := new_row ->> id_column;
+        new_row := new_row - excluded;
+    END IF;
+
+    FOR col IN SELECT jsonb_object_keys(old_row || new_row) LOOP
+        IF (old_row -> col) IS DISTINCT FROM (new_row -> col) THEN
+            changed := changed || jsonb_build_object(
+                col, jsonb_build_object('old', old_row -> col, 'new', new_row -> col)
+            );
+        END IF;
+    END LOOP;
+
+    -- Nothing but excluded columns changed.
+    IF TG_OP = 'UPDATE' AND changed = '{}' THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO audit.audit_logentry (
+        id, tenant_id, user_id, username,
+        actor_type, subject_id, subject_name, auth_method, roles,
+        correlation_id, action, resource, resource_id,
+        ip, user_agent, details, changed_fields, created_at
+    ) VALUES (
+        gen_random_uuid(),
+        COALESCE(current_setting('app.tenant_id', true), ''),
+        COALESCE(current_setting('app.user_id', true), ''),
+        COALESCE(current_setting('app.username', true), ''),
+        COALESCE(current_setting('app.actor_type', true), ''),
+        COALESCE(current_setting('app.subject_id', true), ''),
+        COALESCE(current_setting('app.subject_name', true), ''),
+        COALESCE(current_setting('app.auth_method', true), ''),
+        COALESCE(string_to_array(NULLIF(current_setting('app.roles', true), ''), ','), '{}'),
+        NULLIF(current_setting('app.correlation_id', true), ''),
+        CASE TG_OP WHEN 'INSERT' THEN 'CREATE' WHEN 'UPDATE' THEN 'UPDATE' ELSE 'DELETE' END,
+        TG_TABLE_SCHEMA || '.' || TG_TABLE_NAME,
+        COALESCE(row_id, ''),
+        COALESCE(current_setting('app.ip', true), ''),
+        COALESCE(current_setting('app.user_agent', true), ''),
+        jsonb_build_object(
+            'source', 'trigger',
+            'operation', TG_OP,
+            'request_resource', COALESCE(current_setting('app.resource', true), ''),
+            'request_resource_id', COALESCE(current_setting('app.resource_id', true), '')
+        ),
+        changed,
+        now()
+    );
+
+    RETURN NULL;
+END;
+$$;
@@ -0,0 +1,2 @@
+ALTER TABLE audit.audit_logentry
+    DROP COLUMN IF EXISTS ingested_at;
@@ -0,0 +1,8 @@
+-- created_at is when the audited action occurred; ingested_at is when the
+-- entry was stored. Rows written before this migration have no ingestion
+-- time and keep ingested_at NULL.
+ALTER TABLE audit.audit_logentry
+    ADD COLUMN IF NOT EXISTS ingested_at TIMESTAMPTZ;
+
+ALTER TABLE audit.audit_logentry
+    ALTER COLUMN ingested_at SET DEFAULT now();
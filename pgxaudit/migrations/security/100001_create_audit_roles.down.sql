@@ -0,0 +1,6 @@
+REVOKE ALL ON ALL TABLES IN SCHEMA audit FROM audit_writer, audit_reader;
+REVOKE ALL ON ALL SEQUENCES IN SCHEMA audit FROM audit_writer, audit_reader;
+REVOKE ALL ON SCHEMA audit FROM audit_writer, audit_reader;
+
+DROP ROLE IF EXISTS audit_reader;
+DROP ROLE IF EXISTS audit_writer;
@@ -0,0 +1,32 @@
+-- Separate roles for writing and reading the audit trail. Grant them to
+-- the application's login roles, e.g.:
+--
+--   GRANT audit_writer TO app;
+--   GRANT audit_reader TO audit_dashboard;
+--
+-- Neither role may UPDATE, DELETE or TRUNCATE audit.audit_logentry. The
+-- table owner keeps those privileges, so the application must not connect
+-- as the owner.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'audit_writer') THEN
+        CREATE ROLE audit_writer NOLOGIN;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'audit_reader') THEN
+        CREATE ROLE audit_reader NOLOGIN;
+    END IF;
+END;
+$$;
+
+REVOKE UPDATE, DELETE, TRUNCATE ON audit.audit_logentry FROM PUBLIC;
+
+GRANT USAGE ON SCHEMA audit TO audit_writer, audit_reader;
+
+-- Writers insert entries (directly, through the row-change trigger or the
+-- outbox relay) and advance the hash chain head.
+GRANT INSERT ON audit.audit_logentry TO audit_writer;
+GRANT SELECT, UPDATE ON audit.audit_chain_head TO audit_writer;
+GRANT SELECT, INSERT, UPDATE ON audit.audit_outbox TO audit_writer;
+GRANT USAGE ON SEQUENCE audit.audit_outbox_id_seq TO audit_writer;
+
+GRANT SELECT ON audit.audit_logentry, audit.audit_chain_head TO audit_reader;
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS audit_no_truncate ON audit.audit_logentry;
+DROP TRIGGER IF EXISTS audit_append_only ON audit.audit_logentry;
+
+DROP FUNCTION IF EXISTS audit.reject_modification();
@@ -0,0 +1,20 @@
+-- Reject any modification of recorded entries, including by roles that
+-- were granted UPDATE or DELETE by mistake. Only a superuser or the table
+-- owner can bypass the guard, by disabling the triggers.
+CREATE OR REPLACE FUNCTION audit.reject_modification() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+    RAISE EXCEPTION 'audit.audit_logentry is append-only: % is not allowed', TG_OP
+        USING ERRCODE = 'insufficient_privilege';
+END;
+$$;
+
+DROP TRIGGER IF EXISTS audit_append_only ON audit.audit_logentry;
+CREATE TRIGGER audit_append_only
+    BEFORE UPDATE OR DELETE ON audit.audit_logentry
+    FOR EACH ROW EXECUTE FUNCTION audit.reject_modification();
+
+DROP TRIGGER IF EXISTS audit_no_truncate ON audit.audit_logentry;
+CREATE TRIGGER audit_no_truncate
+    BEFORE TRUNCATE ON audit.audit_logentry
+    FOR EACH STATEMENT EXECUTE FUNCTION audit.reject_modification();
@@ -0,0 +1,4 @@
+DROP POLICY IF EXISTS audit_tenant_write ON audit.audit_logentry;
+DROP POLICY IF EXISTS audit_tenant_read ON audit.audit_logentry;
+
+ALTER TABLE audit.audit_logentry DISABLE ROW LEVEL SECURITY;
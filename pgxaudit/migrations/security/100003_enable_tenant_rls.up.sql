@@ -0,0 +1,34 @@
+-- Row-level security keyed off the app.tenant_id session variable set by
+-- AuditPool (migration 000006 adds the tenant_id column; this migration is
+-- a no-op without it). Readers only see the rows of the tenant set for the
+-- transaction, and see nothing when no tenant is set. Writers may insert
+-- rows for the current tenant, or for any tenant when none is set (e.g.
+-- the chiware worker pool). The table owner and BYPASSRLS roles are not
+-- subject to these policies.
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = 'audit'
+            AND table_name = 'audit_logentry'
+            AND column_name = 'tenant_id'
+    ) THEN
+        RETURN;
+    END IF;
+
+    ALTER TABLE audit.audit_logentry ENABLE ROW LEVEL SECURITY;
+
+    DROP POLICY IF EXISTS audit_tenant_read ON audit.audit_logentry;
+    CREATE POLICY audit_tenant_read ON audit.audit_logentry
+        FOR SELECT TO audit_reader
+        USING (tenant_id = current_setting('app.tenant_id', true));
+
+    DROP POLICY IF EXISTS audit_tenant_write ON audit.audit_logentry;
+    CREATE POLICY audit_tenant_write ON audit.audit_logentry
+        FOR INSERT TO audit_writer
+        WITH CHECK (
+            COALESCE(current_setting('app.tenant_id', true), '') = ''
+            OR tenant_id = current_setting('app.tenant_id', true)
+        );
+END;
+$$;
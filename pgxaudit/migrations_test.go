@@ -64,3 +64,35 @@ func TestCopyGooseMigrations(t *testing.T) {
 		t.Fatal("expected error when copying on top of existing goose files")
 	}
 }
+
+func TestCopySecurityMigrations(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := CopySecurityMigrations(dir); err != nil {
+		t.Fatalf("CopySecurityMigrations returned error: %v", err)
+	}
+
+	files, err := SecurityMigrationFiles()
+	if err != nil {
+		t.Fatalf("SecurityMigrationFiles returned error: %v", err)
+	}
+	if len(files) == 0 {
+		t.Fatal("expected embedded security migration files")
+	}
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Fatalf("expected copied file %s: %v", f, err)
+		}
+	}
+
+	core, _ := MigrationFiles()
+	for _, f := range core {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			t.Fatalf("core migration %s copied with the security set", f)
+		}
+	}
+
+	if err := CopyGooseSecurityMigrations(t.TempDir()); err != nil {
+		t.Fatalf("CopyGooseSecurityMigrations returned error: %v", err)
+	}
+}
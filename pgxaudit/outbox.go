@@ -0,0 +1,276 @@
+package pgxaudit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+const (
+	defaultRelayBatchSize    = 100
+	defaultRelayPollInterval = time.Second
+	defaultRelayBaseBackoff  = time.Second
+	defaultRelayMaxBackoff   = 5 * time.Minute
+)
+
+// OutboxWriter enqueues audit entries into audit.audit_outbox instead of
+// writing them to audit.audit_logentry directly. A Relay later claims the
+// rows and delivers them, so a failing or unavailable sink does not lose
+// entries.
+type OutboxWriter struct {
+	db DB
+}
+
+// NewOutboxWriter creates a new OutboxWriter.
+func NewOutboxWriter(db DB) *OutboxWriter {
+	return &OutboxWriter{db: db}
+}
+
+// WithDB returns a copy of w that enqueues on db, typically the pgx.Tx of
+// the business transaction the entry describes.
+func (w *OutboxWriter) WithDB(db DB) *OutboxWriter {
+	return &OutboxWriter{db: db}
+}
+
+// Enqueue serializes entry and inserts it as a pending outbox row.
+func (w *OutboxWriter) Enqueue(ctx context.Context, entry *audit.AuditLog) error {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("serializing outbox payload: %w", err)
+	}
+
+	_, err = w.db.Exec(ctx,
+		`INSERT INTO audit.audit_outbox (event_id, payload) VALUES ($1, $2)`,
+		entry.ID, payload,
+	)
+	if err != nil {
+		return fmt.Errorf("enqueuing audit outbox entry: %w", err)
+	}
+
+	return nil
+}
+
+// Create implements audit.AuditWriter by enqueuing entry.
+func (w *OutboxWriter) Create(ctx context.Context, entry *audit.AuditLog) error {
+	return w.Enqueue(ctx, entry)
+}
+
+// OutboxRepo is an audit.AuditRepository whose writes go through the outbox
+// while reads are served from audit.audit_logentry. It is a drop-in
+// replacement for PostgresRepo in chiware.AuditMiddleware when entries must
+// survive a failing insert.
+type OutboxRepo struct {
+	*PostgresRepo
+	outbox *OutboxWriter
+}
+
+// NewOutboxRepo creates a new OutboxRepo backed by db.
+func NewOutboxRepo(db DB) *OutboxRepo {
+	return &OutboxRepo{
+		PostgresRepo: NewPostgresRepo(db),
+		outbox:       NewOutboxWriter(db),
+	}
+}
+
+// WithDB returns a copy of r whose reads and outbox writes run on db.
+func (r *OutboxRepo) WithDB(db DB) *OutboxRepo {
+	return &OutboxRepo{
+		PostgresRepo: r.PostgresRepo.WithDB(db),
+		outbox:       r.outbox.WithDB(db),
+	}
+}
+
+// Create enqueues entry into the outbox.
+func (r *OutboxRepo) Create(ctx context.Context, entry *audit.AuditLog) error {
+	return r.outbox.Enqueue(ctx, entry)
+}
+
+// RelayConfig tunes a Relay. Zero values fall back to the defaults.
+type RelayConfig struct {
+	// BatchSize is the maximum number of rows claimed per RunOnce call.
+	BatchSize int
+	// PollInterval is how long Run waits when the outbox has no due rows.
+	PollInterval time.Duration
+	// BaseBackoff is the delay before the first retry; it doubles on
+	// every subsequent failure up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// MaxAttempts stops retrying a row after this many failed deliveries.
+	// Zero retries forever.
+	MaxAttempts int
+
+	Logger *slog.Logger
+	// Now overrides the clock used for next_retry_at and processed_at.
+	Now func() time.Time
+}
+
+// Relay moves rows from audit.audit_outbox into a sink. Rows are claimed
+// with FOR UPDATE SKIP LOCKED, so several relays (in one or many
+// processes) can run against the same table without delivering a row twice
+// concurrently. Delivery is at-least-once: if the process dies after the
+// sink accepted an entry but before the row is marked processed, the entry
+// is delivered again. PostgresRepo ignores entries whose ID is already
+// stored, so redeliveries to it are harmless; other sinks should do the
+// same.
+type Relay struct {
+	db   DB
+	sink audit.AuditWriter
+	cfg  RelayConfig
+}
+
+// NewRelay creates a Relay that claims rows through db and delivers them to
+// sink (typically a *PostgresRepo).
+func NewRelay(db DB, sink audit.AuditWriter, cfg RelayConfig) *Relay {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultRelayBatchSize
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultRelayPollInterval
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = defaultRelayBaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultRelayMaxBackoff
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Relay{db: db, sink: sink, cfg: cfg}
+}
+
+// outboxRow is a claimed audit.audit_outbox row.
+type outboxRow struct {
+	id       int64
+	payload  []byte
+	attempts int
+}
+
+// RunOnce claims up to BatchSize due rows, delivers them to the sink and
+// records the outcome of each delivery. It returns the number of rows
+// delivered and marked processed, which is zero if the bookkeeping is
+// rolled back.
+func (r *Relay) RunOnce(ctx context.Context) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("beginning outbox transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	now := r.cfg.Now()
+
+	rows, err := tx.Query(ctx,
+		`SELECT id, payload, attempts
+			FROM audit.audit_outbox
+			WHERE processed_at IS NULL
+				AND next_retry_at <= $1
+				AND ($2::INT = 0 OR attempts < $2)
+			ORDER BY id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED`,
+		now, r.cfg.MaxAttempts, r.cfg.BatchSize,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("claiming outbox rows: %w", err)
+	}
+
+	var claimed []outboxRow
+	for rows.Next() {
+		var row outboxRow
+		if err := rows.Scan(&row.id, &row.payload, &row.attempts); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scanning outbox row: %w", err)
+		}
+		claimed = append(claimed, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("iterating outbox rows: %w", err)
+	}
+
+	delivered := 0
+	for _, row := range claimed {
+		if err := r.deliver(ctx, row.payload); err != nil {
+			attempts := row.attempts + 1
+			r.cfg.Logger.Warn("audit outbox delivery failed",
+				"error", err,
+				"outbox_id", row.id,
+				"attempts", attempts,
+			)
+			_, err = tx.Exec(ctx,
+				`UPDATE audit.audit_outbox
+					SET attempts = $2, next_retry_at = $3, last_error = $4
+					WHERE id = $1`,
+				row.id, attempts, now.Add(r.backoff(attempts)), err.Error(),
+			)
+			if err != nil {
+				return 0, fmt.Errorf("recording outbox failure: %w", err)
+			}
+			continue
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE audit.audit_outbox
+				SET attempts = attempts + 1, processed_at = $2, last_error = NULL
+				WHERE id = $1`,
+			row.id, now,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("marking outbox row processed: %w", err)
+		}
+		delivered++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("committing outbox transaction: %w", err)
+	}
+
+	return delivered, nil
+}
+
+// Run calls RunOnce until ctx is cancelled, sleeping PollInterval whenever
+// a pass claims fewer rows than BatchSize.
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		n, err := r.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.cfg.Logger.Error("audit outbox relay pass failed", "error", err)
+		}
+
+		if n < r.cfg.BatchSize || err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(r.cfg.PollInterval):
+			}
+		}
+	}
+}
+
+// deliver decodes an outbox payload and hands it to the sink.
+func (r *Relay) deliver(ctx context.Context, payload []byte) error {
+	var entry audit.AuditLog
+	if err := json.Unmarshal(payload, &entry); err != nil {
+		return fmt.Errorf("deserializing outbox payload: %w", err)
+	}
+	return r.sink.Create(ctx, &entry)
+}
+
+// backoff returns the retry delay after the given number of failed attempts.
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.cfg.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= r.cfg.MaxBackoff {
+			return r.cfg.MaxBackoff
+		}
+	}
+	return min(d, r.cfg.MaxBackoff)
+}
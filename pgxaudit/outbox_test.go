@@ -0,0 +1,286 @@
+package pgxaudit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+// ---------- Mock sink ----------
+
+type mockSink struct {
+	err     error
+	entries []*audit.AuditLog
+}
+
+func (m *mockSink) Create(_ context.Context, entry *audit.AuditLog) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+// ---------- OutboxWriter ----------
+
+func TestOutboxWriter_Enqueue(t *testing.T) {
+	var capturedSQL string
+	var capturedArgs []any
+
+	db := &mockDB{
+		execFn: func(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+			capturedSQL = sql
+			capturedArgs = args
+			return pgconn.NewCommandTag("INSERT 0 1"), nil
+		},
+	}
+
+	entry, _ := audit.NewAuditLog("user-1", "alice", "corr-1", audit.ActionCreate, "orders", "ord-1", "", "", nil)
+
+	if err := NewOutboxWriter(db).Enqueue(context.Background(), entry); err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+
+	if !strings.Contains(capturedSQL, "audit.audit_outbox") {
+		t.Errorf("expected insert into audit_outbox, got %q", capturedSQL)
+	}
+	if capturedArgs[0] != entry.ID {
+		t.Errorf("arg[0] (event_id) = %v, want %v", capturedArgs[0], entry.ID)
+	}
+
+	var decoded audit.AuditLog
+	if err := json.Unmarshal(capturedArgs[1].([]byte), &decoded); err != nil {
+		t.Fatalf("failed to unmarshal payload: %v", err)
+	}
+	if decoded.ID != entry.ID || decoded.Resource != "orders" || decoded.CorrelationID != "corr-1" {
+		t.Errorf("payload round-trip mismatch: %+v", decoded)
+	}
+}
+
+func TestOutboxRepo_CreateEnqueues(t *testing.T) {
+	var capturedSQL string
+	db := &mockDB{
+		execFn: func(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+			capturedSQL = sql
+			return pgconn.CommandTag{}, nil
+		},
+	}
+
+	var repo audit.AuditRepository = NewOutboxRepo(db)
+	entry, _ := audit.NewAuditLog("user-1", "alice", "", audit.ActionRead, "orders", "", "", "", nil)
+
+	if err := repo.Create(context.Background(), entry); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if !strings.Contains(capturedSQL, "audit.audit_outbox") {
+		t.Errorf("expected Create to write to the outbox, got %q", capturedSQL)
+	}
+}
+
+// ---------- Relay ----------
+
+func newTestRelay(t *testing.T, tx *mockTx, sink audit.AuditWriter, now time.Time) *Relay {
+	t.Helper()
+	db := &mockDB{
+		beginFn: func(_ context.Context) (pgx.Tx, error) { return tx, nil },
+	}
+	return NewRelay(db, sink, RelayConfig{
+		BaseBackoff: time.Second,
+		MaxBackoff:  10 * time.Second,
+		Now:         func() time.Time { return now },
+	})
+}
+
+func outboxPayload(t *testing.T) []byte {
+	t.Helper()
+	entry, _ := audit.NewAuditLog("user-1", "alice", "", audit.ActionDelete, "orders", "ord-1", "", "", nil)
+	b, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return b
+}
+
+func TestRelay_RunOnce_DeliversAndMarksProcessed(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var claimSQL string
+	var updates []string
+	tx := &mockTx{
+		queryFn: func(_ context.Context, sql string, _ ...any) (pgx.Rows, error) {
+			claimSQL = sql
+			return &mockRows{rows: [][]any{{int64(7), outboxPayload(t), 0}}}, nil
+		},
+		execFn: func(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+			updates = append(updates, sql)
+			return pgconn.CommandTag{}, nil
+		},
+	}
+	sink := &mockSink{}
+
+	n, err := newTestRelay(t, tx, sink, now).RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce returned error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("delivered = %d, want 1", n)
+	}
+	if !strings.Contains(claimSQL, "FOR UPDATE SKIP LOCKED") {
+		t.Error("expected claim query to use FOR UPDATE SKIP LOCKED")
+	}
+	if len(sink.entries) != 1 || sink.entries[0].ResourceID != "ord-1" {
+		t.Fatalf("expected decoded entry delivered to sink, got %+v", sink.entries)
+	}
+	if len(updates) != 1 || !strings.Contains(updates[0], "processed_at") {
+		t.Errorf("expected processed_at update, got %v", updates)
+	}
+	if !tx.committed {
+		t.Error("expected transaction to be committed")
+	}
+}
+
+func TestRelay_RunOnce_FailureSchedulesRetry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var updateArgs []any
+	tx := &mockTx{
+		queryFn: func(_ context.Context, _ string, _ ...any) (pgx.Rows, error) {
+			return &mockRows{rows: [][]any{{int64(7), outboxPayload(t), 2}}}, nil
+		},
+		execFn: func(_ context.Context, _ string, args ...any) (pgconn.CommandTag, error) {
+			updateArgs = args
+			return pgconn.CommandTag{}, nil
+		},
+	}
+	sink := &mockSink{err: errors.New("db down")}
+
+	n, err := newTestRelay(t, tx, sink, now).RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce returned error: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("delivered = %d, want 0", n)
+	}
+
+	if updateArgs[1] != 3 {
+		t.Errorf("attempts = %v, want 3", updateArgs[1])
+	}
+	// Third attempt: 1s * 2^2 = 4s.
+	if got := updateArgs[2].(time.Time); !got.Equal(now.Add(4 * time.Second)) {
+		t.Errorf("next_retry_at = %v, want %v", got, now.Add(4*time.Second))
+	}
+	if updateArgs[3] != "db down" {
+		t.Errorf("last_error = %v, want %q", updateArgs[3], "db down")
+	}
+	if !tx.committed {
+		t.Error("expected failure bookkeeping to be committed")
+	}
+}
+
+func TestRelay_RunOnce_RedeliveryIsIdempotent(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var updates []string
+	tx := &mockTx{
+		queryFn: func(_ context.Context, _ string, _ ...any) (pgx.Rows, error) {
+			return &mockRows{rows: [][]any{{int64(7), outboxPayload(t), 1}}}, nil
+		},
+		execFn: func(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+			updates = append(updates, sql)
+			return pgconn.CommandTag{}, nil
+		},
+	}
+	// The previous pass stored the entry but failed to mark the row.
+	sink := NewPostgresRepo(&mockDB{
+		execFn: func(_ context.Context, _ string, _ ...any) (pgconn.CommandTag, error) {
+			return pgconn.NewCommandTag("INSERT 0 0"), nil
+		},
+	})
+
+	n, err := newTestRelay(t, tx, sink, now).RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce returned error: %v", err)
+	}
+	if n != 1 || len(updates) != 1 || !strings.Contains(updates[0], "processed_at") {
+		t.Errorf("expected the redelivered row marked processed, got n=%d updates=%v", n, updates)
+	}
+}
+
+func TestRelay_RunOnce_CommitErrorDeliversNothing(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tx := &mockTx{
+		queryFn: func(_ context.Context, _ string, _ ...any) (pgx.Rows, error) {
+			return &mockRows{rows: [][]any{{int64(7), outboxPayload(t), 0}}}, nil
+		},
+		commitErr: errors.New("connection reset"),
+	}
+
+	n, err := newTestRelay(t, tx, &mockSink{}, now).RunOnce(context.Background())
+	if err == nil {
+		t.Fatal("expected the commit error")
+	}
+	if n != 0 {
+		t.Errorf("delivered = %d, want 0 after a rollback", n)
+	}
+}
+
+func TestRelay_RunOnce_BookkeepingErrorDeliversNothing(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tx := &mockTx{
+		queryFn: func(_ context.Context, _ string, _ ...any) (pgx.Rows, error) {
+			return &mockRows{rows: [][]any{{int64(7), outboxPayload(t), 0}, {int64(8), outboxPayload(t), 0}}}, nil
+		},
+		execFn: func(_ context.Context, _ string, args ...any) (pgconn.CommandTag, error) {
+			if args[0] == int64(8) {
+				return pgconn.CommandTag{}, errors.New("connection reset")
+			}
+			return pgconn.CommandTag{}, nil
+		},
+	}
+
+	n, err := newTestRelay(t, tx, &mockSink{}, now).RunOnce(context.Background())
+	if err == nil {
+		t.Fatal("expected the bookkeeping error")
+	}
+	if n != 0 {
+		t.Errorf("delivered = %d, want 0 after a rollback", n)
+	}
+}
+
+func TestRelay_RunOnce_BeginError(t *testing.T) {
+	db := &mockDB{}
+	_, err := NewRelay(db, &mockSink{}, RelayConfig{}).RunOnce(context.Background())
+	if err == nil {
+		t.Fatal("expected error when Begin fails")
+	}
+}
+
+func TestRelay_Backoff(t *testing.T) {
+	r := NewRelay(&mockDB{}, &mockSink{}, RelayConfig{BaseBackoff: time.Second, MaxBackoff: 10 * time.Second})
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := r.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
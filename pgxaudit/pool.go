@@ -5,6 +5,8 @@ package pgxaudit
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -26,29 +28,38 @@ type DB interface {
 // variables on write operations via SET LOCAL inside a transaction.
 // Read operations pass through directly.
 type AuditPool struct {
-	pool *pgxpool.Pool
+	pool    *pgxpool.Pool
+	metrics audit.Metrics
 }
 
 // NewAuditPool creates a new AuditPool wrapping the given pool.
-func NewAuditPool(pool *pgxpool.Pool) *AuditPool {
-	return &AuditPool{pool: pool}
+func NewAuditPool(pool *pgxpool.Pool, opts ...PoolOption) *AuditPool {
+	p := &AuditPool{pool: pool, metrics: audit.NopMetrics{}}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // Query passes through to the underlying pool (reads don't need audit context).
-func (p *AuditPool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+func (p *AuditPool) Query(ctx context.Context, sql string, args ...any) (_ pgx.Rows, err error) {
+	defer observe(p.metrics, "query", time.Now(), &err)
 	return p.pool.Query(ctx, sql, args...)
 }
 
 // QueryRow passes through to the underlying pool.
 func (p *AuditPool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
-	return p.pool.QueryRow(ctx, sql, args...)
+	start := time.Now()
+	return observedRow{Row: p.pool.QueryRow(ctx, sql, args...), metrics: p.metrics, start: start}
 }
 
 // Begin starts a transaction on the underlying pool.
 // If audit info is present in the context, it automatically sets the
 // session variables (SET LOCAL) so that DB-level audit triggers work
 // for every operation within the transaction.
-func (p *AuditPool) Begin(ctx context.Context) (pgx.Tx, error) {
+func (p *AuditPool) Begin(ctx context.Context) (_ pgx.Tx, err error) {
+	defer observe(p.metrics, "begin", time.Now(), &err)
+
 	tx, err := p.pool.Begin(ctx)
 	if err != nil {
 		return nil, err
@@ -59,16 +70,7 @@ func (p *AuditPool) Begin(ctx context.Context) (pgx.Tx, error) {
 		return tx, nil
 	}
 
-	configs := map[string]string{
-		"app.user_id":        info.UserID,
-		"app.username":       info.Username,
-		"app.correlation_id": info.CorrelationID,
-		"app.resource":       info.Resource,
-		"app.resource_id":    info.ResourceID,
-		"app.ip":             info.IP,
-		"app.user_agent":     info.UserAgent,
-	}
-	for key, val := range configs {
+	for key, val := range sessionVars(info) {
 		if _, err := tx.Exec(ctx, "SELECT set_config($1, $2, true)", key, val); err != nil {
 			tx.Rollback(ctx)
 			return nil, err
@@ -80,7 +82,9 @@ func (p *AuditPool) Begin(ctx context.Context) (pgx.Tx, error) {
 
 // Exec wraps write operations in a transaction with audit session variables.
 // If no audit info is in context or skip_audit is set, passes through directly.
-func (p *AuditPool) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+func (p *AuditPool) Exec(ctx context.Context, sql string, args ...any) (_ pgconn.CommandTag, err error) {
+	defer observe(p.metrics, "exec", time.Now(), &err)
+
 	info := audit.InfoFrom(ctx)
 	if info == nil || audit.ShouldSkip(ctx) {
 		return p.pool.Exec(ctx, sql, args...)
@@ -92,16 +96,7 @@ func (p *AuditPool) Exec(ctx context.Context, sql string, args ...any) (pgconn.C
 	}
 	defer tx.Rollback(ctx)
 
-	configs := map[string]string{
-		"app.user_id":        info.UserID,
-		"app.username":       info.Username,
-		"app.correlation_id": info.CorrelationID,
-		"app.resource":       info.Resource,
-		"app.resource_id":    info.ResourceID,
-		"app.ip":             info.IP,
-		"app.user_agent":     info.UserAgent,
-	}
-	for key, val := range configs {
+	for key, val := range sessionVars(info) {
 		if _, err := tx.Exec(ctx, "SELECT set_config($1, $2, true)", key, val); err != nil {
 			return pgconn.CommandTag{}, err
 		}
@@ -118,3 +113,23 @@ func (p *AuditPool) Exec(ctx context.Context, sql string, args ...any) (pgconn.C
 
 	return tag, nil
 }
+
+// sessionVars returns the app.* settings read by DB-level audit triggers
+// and row-level security policies. Roles are comma-separated.
+func sessionVars(info *audit.Info) map[string]string {
+	return map[string]string{
+		"app.tenant_id":      info.TenantID,
+		"app.user_id":        info.UserID,
+		"app.username":       info.Username,
+		"app.actor_type":     string(info.ActorType),
+		"app.subject_id":     info.SubjectID,
+		"app.subject_name":   info.SubjectName,
+		"app.auth_method":    info.AuthMethod,
+		"app.roles":          strings.Join(info.Roles, ","),
+		"app.correlation_id": info.CorrelationID,
+		"app.resource":       info.Resource,
+		"app.resource_id":    info.ResourceID,
+		"app.ip":             info.IP,
+		"app.user_agent":     info.UserAgent,
+	}
+}
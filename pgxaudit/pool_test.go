@@ -83,3 +83,31 @@ func TestAuditPool_ExecBranching_WithInfo(t *testing.T) {
 		t.Errorf("UserAgent = %q, want %q", info.UserAgent, "TestAgent/1.0")
 	}
 }
+
+func TestSessionVars(t *testing.T) {
+	vars := sessionVars(&audit.Info{
+		TenantID:    "acme",
+		UserID:      "agent-7",
+		Username:    "support",
+		ActorType:   audit.ActorHuman,
+		SubjectID:   "cust-9",
+		SubjectName: "carol",
+		AuthMethod:  "oidc",
+		Roles:       []string{"support", "billing"},
+	})
+
+	want := map[string]string{
+		"app.tenant_id":    "acme",
+		"app.user_id":      "agent-7",
+		"app.actor_type":   "human",
+		"app.subject_id":   "cust-9",
+		"app.subject_name": "carol",
+		"app.auth_method":  "oidc",
+		"app.roles":        "support,billing",
+	}
+	for key, val := range want {
+		if vars[key] != val {
+			t.Errorf("%s = %q, want %q", key, vars[key], val)
+		}
+	}
+}
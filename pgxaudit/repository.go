@@ -3,28 +3,170 @@ package pgxaudit
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 
 	audit "github.com/kafeiih/go-audit"
 )
 
+// auditLogColumns is the column list written by inserts.
+const auditLogColumns = `id, user_id, username, correlation_id, action, resource, resource_id, ip, user_agent, details, changed_fields, created_at,
+	chain_seq, prev_hash, hash, signature, signature_key_id, outcome, severity, reason, tenant_id,
+	actor_type, subject_id, subject_name, auth_method, roles`
+
+// auditLogSelectColumns is the column list read by selects, in scan order:
+// auditLogColumns followed by ingested_at, which the database sets.
+const auditLogSelectColumns = auditLogColumns + `, ingested_at`
+
+// ErrTenantRequired is returned by the reads of a repository created with
+// WithTenantEnforcement when the context carries no tenant.
+var ErrTenantRequired = errors.New("tenant is required")
+
+// RepoOption configures a PostgresRepo.
+type RepoOption func(*PostgresRepo)
+
+// WithHashChain makes Create link every entry into a tamper-evident hash
+// chain (see audit.AuditLog.ComputeHash). Appends lock the single row of
+// audit.audit_chain_head, so concurrent writers — the chiware worker pool,
+// several replicas — are serialized in the database and the chain order is
+// the commit order. Requires migration 000003.
+func WithHashChain() RepoOption {
+	return func(r *PostgresRepo) {
+		r.chain = true
+	}
+}
+
+// WithTenantEnforcement restricts List and GetByID to the tenant of the
+// audit.Info in the request context (see audit.WithInfo). Reads without a
+// tenant in context fail with ErrTenantRequired, and a List filter naming
+// another tenant is rejected, so one tenant can never read another's rows.
+func WithTenantEnforcement() RepoOption {
+	return func(r *PostgresRepo) {
+		r.enforceTenant = true
+	}
+}
+
 // PostgresRepo implements audit.AuditRepository using any DB-compatible pool.
 type PostgresRepo struct {
-	pool DB
+	pool          DB
+	chain         bool
+	enforceTenant bool
+	metrics       audit.Metrics
 }
 
 // NewPostgresRepo creates a new PostgresRepo.
 // It accepts any DB implementation (*pgxpool.Pool, *AuditPool, or a test mock).
-func NewPostgresRepo(pool DB) *PostgresRepo {
-	return &PostgresRepo{pool: pool}
+func NewPostgresRepo(pool DB, opts ...RepoOption) *PostgresRepo {
+	r := &PostgresRepo{pool: pool, metrics: audit.NopMetrics{}}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
-func (r *PostgresRepo) Create(ctx context.Context, b *audit.AuditLog) error {
+// WithDB returns a copy of r that runs its statements on db instead of the
+// DB it was constructed with. Pass the pgx.Tx of a business transaction
+// (e.g. one opened via AuditPool.Begin) to write the entry atomically with
+// the change it describes: a rollback discards the entry and a commit
+// guarantees it exists.
+func (r *PostgresRepo) WithDB(db DB) *PostgresRepo {
+	cp := *r
+	cp.pool = db
+	return &cp
+}
+
+func (r *PostgresRepo) Create(ctx context.Context, b *audit.AuditLog) (err error) {
+	defer observe(r.metrics, "create", time.Now(), &err)
+
+	if r.chain {
+		return r.createChained(ctx, b)
+	}
+	_, err = insertAuditLog(ctx, r.pool, b)
+	return err
+}
+
+// createChained appends b to the hash chain inside a transaction that holds
+// the chain head lock until the entry is committed.
+func (r *PostgresRepo) createChained(ctx context.Context, b *audit.AuditLog) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning chain transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var seq int64
+	var head string
+	err = tx.QueryRow(ctx,
+		`SELECT seq, hash FROM audit.audit_chain_head WHERE id = 1 FOR UPDATE`,
+	).Scan(&seq, &head)
+	if err != nil {
+		return fmt.Errorf("locking chain head: %w", err)
+	}
+
+	b.ChainSeq = seq + 1
+	b.PrevHash = head
+	b.Hash, err = b.ComputeHash()
+	if err != nil {
+		return fmt.Errorf("hashing audit log entry: %w", err)
+	}
+
+	inserted, err := insertAuditLog(ctx, tx, b)
+	if err != nil {
+		return err
+	}
+	if !inserted {
+		// The entry is already stored, with its own chain position.
+		b.ChainSeq, b.PrevHash, b.Hash = 0, "", ""
+		return nil
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE audit.audit_chain_head SET seq = $1, hash = $2 WHERE id = 1`,
+		b.ChainSeq, b.Hash,
+	)
+	if err != nil {
+		return fmt.Errorf("advancing chain head: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing chain transaction: %w", err)
+	}
+
+	return nil
+}
+
+// insertAuditLog writes b to audit.audit_logentry using db. Inserting an
+// entry whose ID is already stored is a no-op reported by inserted, so
+// that redeliveries (outbox relay, spool replay) are idempotent.
+func insertAuditLog(ctx context.Context, db DB, b *audit.AuditLog) (inserted bool, err error) {
+	values, err := auditLogValues(b)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := db.Exec(ctx,
+		`INSERT INTO audit.audit_logentry (`+auditLogColumns+`)
+		 	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21,
+				$22, $23, $24, $25, $26)
+			ON CONFLICT (id) DO NOTHING`,
+		values...,
+	)
+	if err != nil {
+		return false, fmt.Errorf("inserting audit log entry: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// auditLogValues returns the values of b for auditLogColumns.
+func auditLogValues(b *audit.AuditLog) ([]any, error) {
 	detailsJSON, err := json.Marshal(b.Details)
 	if err != nil {
-		return fmt.Errorf("serializing details: %w", err)
+		return nil, fmt.Errorf("serializing details: %w", err)
 	}
 
 	changedFields := b.ChangedFields
@@ -33,26 +175,37 @@ func (r *PostgresRepo) Create(ctx context.Context, b *audit.AuditLog) error {
 	}
 	changedFieldsJSON, err := json.Marshal(changedFields)
 	if err != nil {
-		return fmt.Errorf("serializing changed_fields: %w", err)
+		return nil, fmt.Errorf("serializing changed_fields: %w", err)
+	}
+
+	roles := b.Roles
+	if roles == nil {
+		roles = []string{}
 	}
 
-	_, err = r.pool.Exec(ctx,
-		`INSERT INTO audit.audit_logentry (id, user_id, username, correlation_id, action, resource, resource_id, ip, user_agent, details, changed_fields, created_at)
-		 	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+	return []any{
 		b.ID, b.UserID, b.Username, b.CorrelationID, string(b.Action), b.Resource, b.ResourceID,
 		b.IP, b.UserAgent, detailsJSON, changedFieldsJSON, b.CreatedAt,
-	)
+		nullInt64(b.ChainSeq), nullString(b.PrevHash), nullString(b.Hash),
+		b.Signature, nullString(b.SignatureKeyID),
+		string(b.Outcome), string(b.Severity), b.Reason, b.TenantID,
+		string(b.ActorType), b.SubjectID, b.SubjectName, b.AuthMethod, roles,
+	}, nil
+}
+
+func (r *PostgresRepo) GetByID(ctx context.Context, id uuid.UUID) (_ *audit.AuditLog, err error) {
+	defer observe(r.metrics, "get_by_id", time.Now(), &err)
+
+	tenant, err := r.tenantScope(ctx)
 	if err != nil {
-		return fmt.Errorf("inserting audit log entry: %w", err)
+		return nil, err
 	}
 
-	return nil
-}
-
-func (r *PostgresRepo) GetByID(ctx context.Context, id uuid.UUID) (*audit.AuditLog, error) {
 	row := r.pool.QueryRow(ctx,
-		`SELECT id, user_id, username, correlation_id, action, resource, resource_id, ip, user_agent, details, changed_fields, created_at
-		 	FROM audit.audit_logentry WHERE id = $1`, id,
+		`SELECT `+auditLogSelectColumns+`
+		 	FROM audit.audit_logentry
+			WHERE id = $1 AND ($2::TEXT IS NULL OR tenant_id = $2)`,
+		id, nullString(tenant),
 	)
 
 	b, err := scanAuditLog(row)
@@ -63,9 +216,34 @@ func (r *PostgresRepo) GetByID(ctx context.Context, id uuid.UUID) (*audit.AuditL
 	return b, nil
 }
 
-func (r *PostgresRepo) List(ctx context.Context, f audit.AuditFilters) ([]audit.AuditLog, int, error) {
+func (r *PostgresRepo) List(ctx context.Context, f audit.AuditFilters) (_ []audit.AuditLog, _ int, err error) {
+	defer observe(r.metrics, "list", time.Now(), &err)
+
+	if err := f.Validate(); err != nil {
+		return nil, 0, err
+	}
+
+	tenant, err := r.tenantScope(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if tenant != "" {
+		if f.TenantID != "" && f.TenantID != tenant {
+			return nil, 0, fmt.Errorf("tenant filter %q does not match the context tenant", f.TenantID)
+		}
+		f.TenantID = tenant
+	}
+
+	var categoryActions []string
+	if f.Category != "" {
+		categoryActions = []string{}
+		for _, a := range audit.ActionsInCategory(f.Category) {
+			categoryActions = append(categoryActions, string(a))
+		}
+	}
+
 	rows, err := r.pool.Query(ctx,
-		`SELECT id, user_id, username, correlation_id, action, resource, resource_id, ip, user_agent, details, changed_fields, created_at,
+		`SELECT `+auditLogSelectColumns+`,
 				count(*) OVER()::INT AS total
 			FROM audit.audit_logentry
 			WHERE ($1::TEXT IS NULL OR user_id  = $1)
@@ -74,11 +252,22 @@ func (r *PostgresRepo) List(ctx context.Context, f audit.AuditFilters) ([]audit.
 				AND ($4::TEXT IS NULL OR action   = $4)
 				AND ($5::TIMESTAMPTZ IS NULL OR created_at >= $5)
 				AND ($6::TIMESTAMPTZ IS NULL OR created_at <= $6)
+				AND ($9::TEXT[] IS NULL OR action = ANY($9))
+				AND ($10::TEXT IS NULL OR outcome = $10)
+				AND ($11::TEXT IS NULL OR severity = $11)
+				AND ($12::TEXT IS NULL OR tenant_id = $12)
+				AND ($13::TEXT IS NULL OR subject_id = $13)
+				AND ($14::TEXT IS NULL OR user_id = $14 OR subject_id = $14)
+				AND ($15::TEXT IS NULL OR actor_type = $15)
 			ORDER BY created_at DESC
 			LIMIT $7 OFFSET $8`,
 		nullString(f.UserID), nullString(f.CorrelationID), nullString(f.Resource), nullString(string(f.Action)),
 		f.From, f.To,
 		f.Limit, f.Offset,
+		categoryActions,
+		nullString(string(f.Outcome)), nullString(string(f.Severity)),
+		nullString(f.TenantID),
+		nullString(f.SubjectID), nullString(f.Identity), nullString(string(f.ActorType)),
 	)
 	if err != nil {
 		return nil, 0, fmt.Errorf("listing audit log entries: %w", err)
@@ -88,7 +277,7 @@ func (r *PostgresRepo) List(ctx context.Context, f audit.AuditFilters) ([]audit.
 	var items []audit.AuditLog
 	var total int
 	for rows.Next() {
-		b, err := scanAuditLogWithTotal(rows, &total)
+		b, err := scanAuditLog(rows, &total)
 		if err != nil {
 			return nil, 0, fmt.Errorf("scanning audit log entry: %w", err)
 		}
@@ -101,53 +290,176 @@ func (r *PostgresRepo) List(ctx context.Context, f audit.AuditFilters) ([]audit.
 	return items, total, nil
 }
 
-// scanner abstracts pgx.Row and pgx.Rows for shared scan logic.
-type scanner interface {
-	Scan(dest ...any) error
+// tenantScope returns the tenant reads are restricted to: "" when tenant
+// enforcement is off, otherwise the tenant of the audit.Info in ctx.
+func (r *PostgresRepo) tenantScope(ctx context.Context) (string, error) {
+	if !r.enforceTenant {
+		return "", nil
+	}
+	info := audit.InfoFrom(ctx)
+	if info == nil || info.TenantID == "" {
+		return "", ErrTenantRequired
+	}
+	return info.TenantID, nil
 }
 
-func scanAuditLogWithTotal(s scanner, total *int) (*audit.AuditLog, error) {
-	var b audit.AuditLog
-	var action string
-	var detailsJSON []byte
-	var changedFieldsJSON []byte
+// ChainBreak describes the first inconsistency found by Verify.
+type ChainBreak struct {
+	// Seq is the chain position where the chain stops verifying.
+	Seq int64
+	// EntryID is the entry at Seq, or uuid.Nil if the entry is missing.
+	EntryID uuid.UUID
+	Reason  string
+}
 
-	err := s.Scan(
-		&b.ID, &b.UserID, &b.Username, &b.CorrelationID, &action,
-		&b.Resource, &b.ResourceID, &b.IP, &b.UserAgent,
-		&detailsJSON, &changedFieldsJSON, &b.CreatedAt, total,
+func (b *ChainBreak) Error() string {
+	return fmt.Sprintf("audit chain broken at seq %d: %s", b.Seq, b.Reason)
+}
+
+// Verify walks the hash chain from position from to position to
+// (inclusive) and reports the first broken link: a missing entry, an entry
+// whose prev_hash does not match its predecessor, or an entry whose content
+// no longer matches its hash. A to of zero or less verifies up to the chain
+// head, which also detects entries deleted from the end of the chain.
+// It returns nil if the range is intact.
+func (r *PostgresRepo) Verify(ctx context.Context, from, to int64) (_ *ChainBreak, err error) {
+	defer observe(r.metrics, "verify", time.Now(), &err)
+
+	if from < 1 {
+		from = 1
+	}
+
+	prev := ""
+	if from > 1 {
+		err := r.pool.QueryRow(ctx,
+			`SELECT hash FROM audit.audit_logentry WHERE chain_seq = $1`, from-1,
+		).Scan(&prev)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &ChainBreak{Seq: from - 1, Reason: "entry missing"}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fetching chain predecessor: %w", err)
+		}
+	}
+
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+auditLogSelectColumns+`
+			FROM audit.audit_logentry
+			WHERE chain_seq >= $1
+				AND ($2::BIGINT <= 0 OR chain_seq <= $2)
+			ORDER BY chain_seq`,
+		from, to,
 	)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("listing chain entries: %w", err)
 	}
+	defer rows.Close()
 
-	b.Action = audit.Action(action)
-	if err := json.Unmarshal(detailsJSON, &b.Details); err != nil {
-		return nil, fmt.Errorf("deserializing details: %w", err)
+	expected := from
+	for rows.Next() {
+		b, err := scanAuditLog(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning chain entry: %w", err)
+		}
+		if brk := verifyLink(b, expected, prev); brk != nil {
+			return brk, nil
+		}
+		prev = b.Hash
+		expected++
 	}
-	if err := json.Unmarshal(changedFieldsJSON, &b.ChangedFields); err != nil {
-		return nil, fmt.Errorf("deserializing changed_fields: %w", err)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating chain entries: %w", err)
 	}
 
-	return &b, nil
+	if to > 0 {
+		if expected <= to {
+			return &ChainBreak{Seq: expected, Reason: "entry missing"}, nil
+		}
+		return nil, nil
+	}
+
+	var headSeq int64
+	var headHash string
+	err = r.pool.QueryRow(ctx,
+		`SELECT seq, hash FROM audit.audit_chain_head WHERE id = 1`,
+	).Scan(&headSeq, &headHash)
+	if err != nil {
+		return nil, fmt.Errorf("fetching chain head: %w", err)
+	}
+	switch {
+	case headSeq >= expected:
+		return &ChainBreak{Seq: expected, Reason: "entry missing"}, nil
+	case headSeq < expected-1:
+		return &ChainBreak{Seq: headSeq, Reason: "chain head is behind the last entry"}, nil
+	case headHash != prev:
+		return &ChainBreak{Seq: headSeq, Reason: "chain head hash does not match last entry"}, nil
+	}
+
+	return nil, nil
+}
+
+// verifyLink checks a single chain entry against its expected position and
+// its predecessor's hash.
+func verifyLink(b *audit.AuditLog, expected int64, prev string) *ChainBreak {
+	if b.ChainSeq != expected {
+		return &ChainBreak{Seq: expected, Reason: "entry missing"}
+	}
+	if b.PrevHash != prev {
+		return &ChainBreak{Seq: b.ChainSeq, EntryID: b.ID, Reason: "prev_hash does not match previous entry"}
+	}
+	hash, err := b.ComputeHash()
+	if err != nil {
+		return &ChainBreak{Seq: b.ChainSeq, EntryID: b.ID, Reason: err.Error()}
+	}
+	if hash != b.Hash {
+		return &ChainBreak{Seq: b.ChainSeq, EntryID: b.ID, Reason: "entry content does not match its hash"}
+	}
+	return nil
 }
 
-func scanAuditLog(s scanner) (*audit.AuditLog, error) {
+// scanner abstracts pgx.Row and pgx.Rows for shared scan logic.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanAuditLog scans the auditLogSelectColumns of a row, followed by any extra
+// destinations (e.g. a window-function total).
+func scanAuditLog(s scanner, extra ...any) (*audit.AuditLog, error) {
 	var b audit.AuditLog
-	var action string
+	var action, outcome, severity, actorType string
+	var correlationID, prevHash, hash, keyID *string
+	var chainSeq *int64
+	var ingestedAt *time.Time
 	var detailsJSON []byte
 	var changedFieldsJSON []byte
 
-	err := s.Scan(
-		&b.ID, &b.UserID, &b.Username, &b.CorrelationID, &action,
+	dest := []any{
+		&b.ID, &b.UserID, &b.Username, &correlationID, &action,
 		&b.Resource, &b.ResourceID, &b.IP, &b.UserAgent,
 		&detailsJSON, &changedFieldsJSON, &b.CreatedAt,
-	)
-	if err != nil {
+		&chainSeq, &prevHash, &hash, &b.Signature, &keyID,
+		&outcome, &severity, &b.Reason, &b.TenantID,
+		&actorType, &b.SubjectID, &b.SubjectName, &b.AuthMethod, &b.Roles,
+		&ingestedAt,
+	}
+	if err := s.Scan(append(dest, extra...)...); err != nil {
 		return nil, err
 	}
 
 	b.Action = audit.Action(action)
+	b.Outcome = audit.Outcome(outcome)
+	b.Severity = audit.Severity(severity)
+	b.ActorType = audit.ActorType(actorType)
+	b.CorrelationID = derefString(correlationID)
+	b.PrevHash = derefString(prevHash)
+	b.Hash = derefString(hash)
+	b.SignatureKeyID = derefString(keyID)
+	if chainSeq != nil {
+		b.ChainSeq = *chainSeq
+	}
+	if ingestedAt != nil {
+		b.IngestedAt = *ingestedAt
+	}
 	if err := json.Unmarshal(detailsJSON, &b.Details); err != nil {
 		return nil, fmt.Errorf("deserializing details: %w", err)
 	}
@@ -165,3 +477,19 @@ func nullString(s string) *string {
 	}
 	return &s
 }
+
+// nullInt64 returns nil for zero, used for optional SQL columns.
+func nullInt64(n int64) *int64 {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+// derefString returns the value of a nullable text column, or "" for NULL.
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
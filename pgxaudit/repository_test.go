@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -20,6 +21,7 @@ type mockDB struct {
 	execFn     func(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
 	queryFn    func(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
 	queryRowFn func(ctx context.Context, sql string, args ...any) pgx.Row
+	beginFn    func(ctx context.Context) (pgx.Tx, error)
 }
 
 func (m *mockDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
@@ -43,7 +45,10 @@ func (m *mockDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
 	return nil
 }
 
-func (m *mockDB) Begin(_ context.Context) (pgx.Tx, error) {
+func (m *mockDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	if m.beginFn != nil {
+		return m.beginFn(ctx)
+	}
 	return nil, errors.New("mockDB: Begin not implemented")
 }
 
@@ -82,10 +87,13 @@ func TestPostgresRepo_Create_Success(t *testing.T) {
 	if capturedSQL == "" {
 		t.Fatal("expected SQL to be captured")
 	}
+	if !strings.Contains(capturedSQL, "ON CONFLICT (id) DO NOTHING") {
+		t.Errorf("expected the insert to ignore stored entries, got %q", capturedSQL)
+	}
 
-	// Verify all 12 args were passed.
-	if len(capturedArgs) != 12 {
-		t.Fatalf("expected 12 args, got %d", len(capturedArgs))
+	// Verify all 26 args were passed.
+	if len(capturedArgs) != 26 {
+		t.Fatalf("expected 26 args, got %d", len(capturedArgs))
 	}
 
 	// Verify the ID is passed correctly.
@@ -119,6 +127,16 @@ func TestPostgresRepo_Create_Success(t *testing.T) {
 	if len(changed) != 0 {
 		t.Errorf("expected empty changed_fields by default, got %v", changed)
 	}
+	if capturedArgs[17] != "unknown" || capturedArgs[18] != "info" {
+		t.Errorf("expected default outcome/severity, got %v/%v", capturedArgs[17], capturedArgs[18])
+	}
+	if roles, ok := capturedArgs[25].([]string); !ok || roles == nil {
+		t.Errorf("expected non-nil roles array, got %#v", capturedArgs[25])
+	}
+	// Chain columns are NULL unless the repo maintains a hash chain.
+	if capturedArgs[12] != (*int64)(nil) || capturedArgs[14] != (*string)(nil) {
+		t.Errorf("expected NULL chain columns, got seq=%v hash=%v", capturedArgs[12], capturedArgs[14])
+	}
 }
 
 func TestPostgresRepo_Create_ExecError(t *testing.T) {
@@ -211,18 +229,24 @@ func TestPostgresRepo_List_FiltersPassedCorrectly(t *testing.T) {
 	from := now.Add(-24 * time.Hour)
 
 	repo.List(context.Background(), audit.AuditFilters{
+		TenantID:      "acme",
 		UserID:        "user-1",
+		SubjectID:     "cust-9",
+		Identity:      "cust-9",
+		ActorType:     audit.ActorHuman,
 		CorrelationID: "corr-123",
 		Resource:      "orders",
 		Action:        audit.ActionCreate,
+		Outcome:       audit.OutcomeFailure,
+		Severity:      audit.SeverityError,
 		From:          &from,
 		To:            &now,
 		Limit:         20,
 		Offset:        5,
 	})
 
-	if len(capturedArgs) != 8 {
-		t.Fatalf("expected 8 args, got %d", len(capturedArgs))
+	if len(capturedArgs) != 15 {
+		t.Fatalf("expected 15 args, got %d", len(capturedArgs))
 	}
 
 	// $1 = UserID (as *string)
@@ -249,6 +273,28 @@ func TestPostgresRepo_List_FiltersPassedCorrectly(t *testing.T) {
 	if capturedArgs[7] != 5 {
 		t.Errorf("arg[7] (Offset) = %v, want 5", capturedArgs[7])
 	}
+	// $10 = Outcome
+	if s := capturedArgs[9].(*string); s == nil || *s != "failure" {
+		t.Errorf("arg[9] (Outcome) = %v, want 'failure'", capturedArgs[9])
+	}
+	// $11 = Severity
+	if s := capturedArgs[10].(*string); s == nil || *s != "error" {
+		t.Errorf("arg[10] (Severity) = %v, want 'error'", capturedArgs[10])
+	}
+	// $12 = TenantID
+	if s := capturedArgs[11].(*string); s == nil || *s != "acme" {
+		t.Errorf("arg[11] (TenantID) = %v, want 'acme'", capturedArgs[11])
+	}
+	// $13 = SubjectID, $14 = Identity, $15 = ActorType
+	if s := capturedArgs[12].(*string); s == nil || *s != "cust-9" {
+		t.Errorf("arg[12] (SubjectID) = %v, want 'cust-9'", capturedArgs[12])
+	}
+	if s := capturedArgs[13].(*string); s == nil || *s != "cust-9" {
+		t.Errorf("arg[13] (Identity) = %v, want 'cust-9'", capturedArgs[13])
+	}
+	if s := capturedArgs[14].(*string); s == nil || *s != "human" {
+		t.Errorf("arg[14] (ActorType) = %v, want 'human'", capturedArgs[14])
+	}
 }
 
 func TestPostgresRepo_List_EmptyFilters(t *testing.T) {
@@ -277,6 +323,12 @@ func TestPostgresRepo_List_EmptyFilters(t *testing.T) {
 	if capturedArgs[3] != (*string)(nil) {
 		t.Errorf("arg[3] (Action) should be nil for empty filter, got %v", capturedArgs[3])
 	}
+	if capturedArgs[9] != (*string)(nil) {
+		t.Errorf("arg[9] (Outcome) should be nil for empty filter, got %v", capturedArgs[9])
+	}
+	if capturedArgs[10] != (*string)(nil) {
+		t.Errorf("arg[10] (Severity) should be nil for empty filter, got %v", capturedArgs[10])
+	}
 }
 
 // ---------- Helpers ----------
@@ -289,3 +341,225 @@ type errorRow struct {
 func (r *errorRow) Scan(_ ...any) error {
 	return r.err
 }
+
+// ---------- WithDB ----------
+
+func TestPostgresRepo_WithDB_WritesOnTx(t *testing.T) {
+	poolCalls, txCalls := 0, 0
+	pool := &mockDB{
+		execFn: func(_ context.Context, _ string, _ ...any) (pgconn.CommandTag, error) {
+			poolCalls++
+			return pgconn.CommandTag{}, nil
+		},
+	}
+	tx := &mockTx{
+		execFn: func(_ context.Context, _ string, _ ...any) (pgconn.CommandTag, error) {
+			txCalls++
+			return pgconn.CommandTag{}, nil
+		},
+	}
+
+	repo := NewPostgresRepo(pool)
+	entry, _ := audit.NewAuditLog("user-1", "alice", "", audit.ActionUpdate, "orders", "ord-1", "", "", nil)
+
+	if err := repo.WithDB(tx).Create(context.Background(), entry); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if txCalls != 1 || poolCalls != 0 {
+		t.Errorf("expected write on tx only, got tx=%d pool=%d", txCalls, poolCalls)
+	}
+
+	// The original repo stays bound to the pool.
+	if err := repo.Create(context.Background(), entry); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if poolCalls != 1 {
+		t.Errorf("expected original repo to keep using the pool, got pool=%d", poolCalls)
+	}
+}
+
+func TestOutboxRepo_WithDB_EnqueuesOnTx(t *testing.T) {
+	var txSQL string
+	tx := &mockTx{
+		execFn: func(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+			txSQL = sql
+			return pgconn.CommandTag{}, nil
+		},
+	}
+
+	repo := NewOutboxRepo(&mockDB{}).WithDB(tx)
+	entry, _ := audit.NewAuditLog("user-1", "alice", "", audit.ActionUpdate, "orders", "ord-1", "", "", nil)
+
+	if err := repo.Create(context.Background(), entry); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if txSQL == "" {
+		t.Fatal("expected outbox row to be written on tx")
+	}
+}
+
+func TestPostgresRepo_GetByID_ScansSignature(t *testing.T) {
+	entry, _ := audit.NewAuditLog("user-1", "alice", "", audit.ActionCreate, "orders", "ord-1", "", "", nil)
+	if err := entry.Sign(audit.NewHMACSigner("k1", []byte("secret"))); err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+
+	db := &mockDB{
+		queryRowFn: func(_ context.Context, _ string, _ ...any) pgx.Row {
+			return &valueRow{values: entryRow(t, entry)}
+		},
+	}
+
+	got, err := NewPostgresRepo(db).GetByID(context.Background(), entry.ID)
+	if err != nil {
+		t.Fatalf("GetByID returned error: %v", err)
+	}
+	if got.SignatureKeyID != "k1" || string(got.Signature) != string(entry.Signature) {
+		t.Fatalf("expected signature round-trip, got key=%q", got.SignatureKeyID)
+	}
+
+	v := audit.NewVerifier()
+	v.AddKey("k1", audit.NewHMACSigner("k1", []byte("secret")))
+	if status := v.Verify(got); status != audit.SignatureValid {
+		t.Errorf("Verify = %s, want valid", status)
+	}
+}
+
+func TestPostgresRepo_GetByID_ScansIngestedAt(t *testing.T) {
+	occurred := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	entry, _ := audit.New(audit.ActionCreate, "orders",
+		audit.WithActor("user-1", "alice"),
+		audit.WithOccurredAt(occurred),
+	)
+	entry.IngestedAt = occurred.Add(3 * time.Second)
+
+	var capturedSQL string
+	db := &mockDB{
+		queryRowFn: func(_ context.Context, sql string, _ ...any) pgx.Row {
+			capturedSQL = sql
+			return &valueRow{values: entryRow(t, entry)}
+		},
+	}
+
+	got, err := NewPostgresRepo(db).GetByID(context.Background(), entry.ID)
+	if err != nil {
+		t.Fatalf("GetByID returned error: %v", err)
+	}
+	if !strings.Contains(capturedSQL, "ingested_at") {
+		t.Errorf("expected ingested_at to be selected, got %q", capturedSQL)
+	}
+	if !got.CreatedAt.Equal(occurred) || !got.IngestedAt.Equal(entry.IngestedAt) {
+		t.Errorf("created_at=%v ingested_at=%v, want %v and %v", got.CreatedAt, got.IngestedAt, occurred, entry.IngestedAt)
+	}
+}
+
+func TestPostgresRepo_List_CategoryFilter(t *testing.T) {
+	var capturedArgs []any
+	db := &mockDB{
+		queryFn: func(_ context.Context, _ string, args ...any) (pgx.Rows, error) {
+			capturedArgs = args
+			return nil, errors.New("stop")
+		},
+	}
+
+	repo := NewPostgresRepo(db)
+	repo.List(context.Background(), audit.AuditFilters{Category: audit.CategoryChange})
+
+	got, ok := capturedArgs[8].([]string)
+	if !ok {
+		t.Fatalf("arg[8] (category actions) expected []string, got %T", capturedArgs[8])
+	}
+	want := []string{"CREATE", "DELETE", "UPDATE"}
+	if len(got) != len(want) {
+		t.Fatalf("category actions = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("category actions = %v, want %v", got, want)
+		}
+	}
+
+	// Without a category the filter is NULL.
+	repo.List(context.Background(), audit.AuditFilters{})
+	if capturedArgs[8].([]string) != nil {
+		t.Errorf("expected nil category filter, got %v", capturedArgs[8])
+	}
+}
+
+func TestPostgresRepo_List_RejectsUnknownAction(t *testing.T) {
+	called := false
+	db := &mockDB{
+		queryFn: func(_ context.Context, _ string, _ ...any) (pgx.Rows, error) {
+			called = true
+			return nil, errors.New("stop")
+		},
+	}
+
+	_, _, err := NewPostgresRepo(db).List(context.Background(), audit.AuditFilters{Action: "NOPE"})
+	if err == nil {
+		t.Fatal("expected error for unknown action filter")
+	}
+	if called {
+		t.Error("expected List to fail before querying")
+	}
+}
+
+// ---------- Tenant enforcement ----------
+
+func TestPostgresRepo_TenantEnforcement_RequiresTenant(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(_ context.Context, _ string, _ ...any) (pgx.Rows, error) {
+			t.Fatal("List must not query without a tenant")
+			return nil, nil
+		},
+		queryRowFn: func(_ context.Context, _ string, _ ...any) pgx.Row {
+			t.Fatal("GetByID must not query without a tenant")
+			return nil
+		},
+	}
+	repo := NewPostgresRepo(db, WithTenantEnforcement())
+	ctx := audit.WithInfo(context.Background(), audit.Info{UserID: "u1"})
+
+	if _, _, err := repo.List(ctx, audit.AuditFilters{}); !errors.Is(err, ErrTenantRequired) {
+		t.Errorf("List error = %v, want ErrTenantRequired", err)
+	}
+	if _, err := repo.GetByID(ctx, uuid.New()); !errors.Is(err, ErrTenantRequired) {
+		t.Errorf("GetByID error = %v, want ErrTenantRequired", err)
+	}
+}
+
+func TestPostgresRepo_TenantEnforcement_ScopesReads(t *testing.T) {
+	var listArgs, getArgs []any
+	db := &mockDB{
+		queryFn: func(_ context.Context, _ string, args ...any) (pgx.Rows, error) {
+			listArgs = args
+			return nil, errors.New("stop")
+		},
+		queryRowFn: func(_ context.Context, _ string, args ...any) pgx.Row {
+			getArgs = args
+			return &errorRow{err: pgx.ErrNoRows}
+		},
+	}
+	repo := NewPostgresRepo(db, WithTenantEnforcement())
+	ctx := audit.WithInfo(context.Background(), audit.Info{TenantID: "acme", UserID: "u1"})
+
+	repo.List(ctx, audit.AuditFilters{})
+	if s := listArgs[11].(*string); s == nil || *s != "acme" {
+		t.Errorf("List tenant arg = %v, want 'acme'", listArgs[11])
+	}
+
+	if _, err := repo.GetByID(ctx, uuid.New()); err == nil {
+		t.Error("expected error for a row outside the tenant")
+	}
+	if s := getArgs[1].(*string); s == nil || *s != "acme" {
+		t.Errorf("GetByID tenant arg = %v, want 'acme'", getArgs[1])
+	}
+
+	listArgs = nil
+	if _, _, err := repo.List(ctx, audit.AuditFilters{TenantID: "globex"}); err == nil {
+		t.Error("expected error for a filter naming another tenant")
+	}
+	if listArgs != nil {
+		t.Error("List must not query with a foreign tenant filter")
+	}
+}
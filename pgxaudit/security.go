@@ -0,0 +1,74 @@
+package pgxaudit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SecurityOptions selects the protections checked by VerifySecurity.
+type SecurityOptions struct {
+	// RequireRLS also requires row-level security on audit.audit_logentry
+	// (security migration 100003).
+	RequireRLS bool
+}
+
+// SecurityError lists the protections VerifySecurity found missing.
+type SecurityError struct {
+	Problems []string
+}
+
+func (e *SecurityError) Error() string {
+	return "audit schema is not protected: " + strings.Join(e.Problems, "; ")
+}
+
+// VerifySecurity checks, as the role db connects with, that the optional
+// security migrations are in effect: the role cannot UPDATE, DELETE or
+// TRUNCATE audit.audit_logentry, the append-only guard triggers are
+// enabled and, if opts.RequireRLS is set, row-level security is on. Call it
+// at startup to refuse to run with a tamperable audit trail. It returns a
+// *SecurityError listing every missing protection.
+func VerifySecurity(ctx context.Context, db DB, opts SecurityOptions) error {
+	var canUpdate, canDelete, canTruncate, rls bool
+	var guards int
+	err := db.QueryRow(ctx,
+		`SELECT
+				has_table_privilege('audit.audit_logentry', 'UPDATE'),
+				has_table_privilege('audit.audit_logentry', 'DELETE'),
+				has_table_privilege('audit.audit_logentry', 'TRUNCATE'),
+				(SELECT count(*)::INT FROM pg_trigger
+					WHERE tgrelid = 'audit.audit_logentry'::regclass
+						AND tgname IN ('audit_append_only', 'audit_no_truncate')
+						AND tgenabled <> 'D'),
+				(SELECT relrowsecurity FROM pg_class
+					WHERE oid = 'audit.audit_logentry'::regclass)`,
+	).Scan(&canUpdate, &canDelete, &canTruncate, &guards, &rls)
+	if err != nil {
+		return fmt.Errorf("inspecting audit schema protections: %w", err)
+	}
+
+	var problems []string
+	for _, p := range []struct {
+		name    string
+		granted bool
+	}{
+		{"UPDATE", canUpdate},
+		{"DELETE", canDelete},
+		{"TRUNCATE", canTruncate},
+	} {
+		if p.granted {
+			problems = append(problems, "current role has "+p.name+" on audit.audit_logentry")
+		}
+	}
+	if guards < 2 {
+		problems = append(problems, "append-only guard triggers are missing or disabled")
+	}
+	if opts.RequireRLS && !rls {
+		problems = append(problems, "row-level security is disabled on audit.audit_logentry")
+	}
+
+	if len(problems) > 0 {
+		return &SecurityError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package pgxaudit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func securityDB(values ...any) *mockDB {
+	return &mockDB{
+		queryRowFn: func(_ context.Context, _ string, _ ...any) pgx.Row {
+			return &valueRow{values: values}
+		},
+	}
+}
+
+func TestVerifySecurity_Protected(t *testing.T) {
+	db := securityDB(false, false, false, 2, true)
+	if err := VerifySecurity(context.Background(), db, SecurityOptions{RequireRLS: true}); err != nil {
+		t.Fatalf("expected protected schema, got %v", err)
+	}
+}
+
+func TestVerifySecurity_ReportsEveryProblem(t *testing.T) {
+	db := securityDB(true, true, false, 1, false)
+
+	err := VerifySecurity(context.Background(), db, SecurityOptions{RequireRLS: true})
+	var secErr *SecurityError
+	if !errors.As(err, &secErr) {
+		t.Fatalf("expected *SecurityError, got %v", err)
+	}
+	want := []string{
+		"current role has UPDATE on audit.audit_logentry",
+		"current role has DELETE on audit.audit_logentry",
+		"append-only guard triggers are missing or disabled",
+		"row-level security is disabled on audit.audit_logentry",
+	}
+	if len(secErr.Problems) != len(want) {
+		t.Fatalf("problems = %v, want %v", secErr.Problems, want)
+	}
+	for i := range want {
+		if secErr.Problems[i] != want[i] {
+			t.Errorf("problem[%d] = %q, want %q", i, secErr.Problems[i], want[i])
+		}
+	}
+}
+
+func TestVerifySecurity_RLSOptional(t *testing.T) {
+	db := securityDB(false, false, false, 2, false)
+	if err := VerifySecurity(context.Background(), db, SecurityOptions{}); err != nil {
+		t.Fatalf("expected RLS to be optional, got %v", err)
+	}
+}
+
+func TestVerifySecurity_QueryError(t *testing.T) {
+	db := &mockDB{
+		queryRowFn: func(_ context.Context, _ string, _ ...any) pgx.Row {
+			return &errorRow{err: errors.New("relation does not exist")}
+		},
+	}
+	if err := VerifySecurity(context.Background(), db, SecurityOptions{}); err == nil {
+		t.Fatal("expected error when the inspection query fails")
+	}
+}
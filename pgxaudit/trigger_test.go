@@ -0,0 +1,85 @@
+package pgxaudit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestEnableTableAudit(t *testing.T) {
+	var capturedSQL string
+	db := &mockDB{
+		execFn: func(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+			capturedSQL = sql
+			return pgconn.CommandTag{}, nil
+		},
+	}
+
+	err := EnableTableAudit(context.Background(), db, "public.orders", TableAuditOptions{
+		IDColumn:        "order_id",
+		ExcludedColumns: []string{"updated_at", "o'brien"},
+	})
+	if err != nil {
+		t.Fatalf("EnableTableAudit returned error: %v", err)
+	}
+
+	for _, want := range []string{
+		`DROP TRIGGER IF EXISTS audit_row_change ON "public"."orders"`,
+		`CREATE TRIGGER audit_row_change`,
+		`AFTER INSERT OR UPDATE OR DELETE ON "public"."orders"`,
+		`audit.log_row_change('order_id', 'updated_at', 'o''brien')`,
+	} {
+		if !strings.Contains(capturedSQL, want) {
+			t.Errorf("expected SQL to contain %q, got:\n%s", want, capturedSQL)
+		}
+	}
+}
+
+func TestEnableTableAudit_DefaultIDColumn(t *testing.T) {
+	var capturedSQL string
+	db := &mockDB{
+		execFn: func(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+			capturedSQL = sql
+			return pgconn.CommandTag{}, nil
+		},
+	}
+
+	if err := EnableTableAudit(context.Background(), db, "orders", TableAuditOptions{}); err != nil {
+		t.Fatalf("EnableTableAudit returned error: %v", err)
+	}
+	if !strings.Contains(capturedSQL, `ON "orders"`) {
+		t.Errorf("expected unqualified table identifier, got:\n%s", capturedSQL)
+	}
+	if !strings.Contains(capturedSQL, `audit.log_row_change('id')`) {
+		t.Errorf("expected default id column, got:\n%s", capturedSQL)
+	}
+}
+
+func TestEnableTableAudit_InvalidTable(t *testing.T) {
+	for _, table := range []string{"", "a.b.c", "public."} {
+		if err := EnableTableAudit(context.Background(), &mockDB{}, table, TableAuditOptions{}); err == nil {
+			t.Errorf("expected error for table %q", table)
+		}
+	}
+}
+
+func TestDisableTableAudit(t *testing.T) {
+	var capturedSQL string
+	db := &mockDB{
+		execFn: func(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+			capturedSQL = sql
+			return pgconn.CommandTag{}, errors.New("boom")
+		},
+	}
+
+	err := DisableTableAudit(context.Background(), db, "public.orders")
+	if err == nil {
+		t.Fatal("expected Exec error to be returned")
+	}
+	if capturedSQL != `DROP TRIGGER IF EXISTS audit_row_change ON "public"."orders"` {
+		t.Errorf("unexpected SQL: %s", capturedSQL)
+	}
+}
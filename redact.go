@@ -0,0 +1,430 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// RedactStrategy selects how a matched value is redacted.
+type RedactStrategy int
+
+const (
+	// RedactMask replaces the value with the policy's MaskValue, keeping the
+	// last KeepLast characters of string values when set.
+	RedactMask RedactStrategy = iota
+	// RedactDrop removes the key (or changed field) entirely.
+	RedactDrop
+	// RedactHash replaces the value with "sha256:<hex>", keyed with the
+	// policy's HashSalt when set, so equal values stay correlatable. Values
+	// already in that form are kept, so that redacting twice (e.g. a
+	// spooled entry on replay) does not hash them again.
+	RedactHash
+	// RedactTruncate keeps the first KeepFirst characters of the value.
+	RedactTruncate
+)
+
+// RedactionRule selects values to redact. Set exactly one of Key, Path or
+// Value.
+type RedactionRule struct {
+	// Name identifies the rule in documentation and debugging.
+	Name string
+
+	// Key matches key names at any depth, e.g. (?i)password.
+	Key *regexp.Regexp
+	// Path matches a dot-separated key path from the root of Details (or
+	// the changed field name in ChangedFields). A "*" segment matches any
+	// single key, e.g. "payment.*.number".
+	Path string
+	// Value matches substrings of string values anywhere, e.g. emails.
+	// Only the matched substrings are redacted, except with RedactDrop,
+	// which removes the whole key.
+	Value *regexp.Regexp
+	// Validate optionally confirms a Value match (e.g. a Luhn check for
+	// card numbers) to avoid redacting look-alikes.
+	Validate func(match string) bool
+
+	Strategy  RedactStrategy
+	KeepLast  int
+	KeepFirst int
+}
+
+// RedactionPolicy redacts sensitive data from Details and ChangedFields
+// before entries are persisted. Key and Path rules are checked in order and
+// the first match wins; Value rules then apply to the remaining strings.
+type RedactionPolicy struct {
+	Rules []RedactionRule
+
+	// MaskValue replaces masked values. Defaults to "***".
+	MaskValue string
+	// HashSalt keys RedactHash with HMAC-SHA256 instead of plain SHA-256.
+	HashSalt []byte
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	hashPattern  = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+	cardPattern  = regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`)
+	ibanPattern  = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`)
+)
+
+// DefaultRedactionPolicy returns a policy that masks credentials, hashes
+// national identifiers, and masks emails, card numbers and IBANs found in
+// any string value.
+func DefaultRedactionPolicy() *RedactionPolicy {
+	return &RedactionPolicy{
+		Rules: []RedactionRule{
+			{
+				Name:     "credentials",
+				Key:      regexp.MustCompile(`(?i)(password|passwd|secret|token|api[_\-]?key|authorization|cookie)`),
+				Strategy: RedactMask,
+			},
+			{
+				Name:     "national_id",
+				Key:      regexp.MustCompile(`(?i)^(ssn|national_?id|tax_?id)$`),
+				Strategy: RedactHash,
+			},
+			{
+				Name:     "email",
+				Value:    emailPattern,
+				Strategy: RedactMask,
+			},
+			{
+				Name:     "card_number",
+				Value:    cardPattern,
+				Validate: luhnValid,
+				Strategy: RedactMask,
+				KeepLast: 4,
+			},
+			{
+				Name:     "iban",
+				Value:    ibanPattern,
+				Validate: ibanValid,
+				Strategy: RedactMask,
+				KeepLast: 4,
+			},
+		},
+	}
+}
+
+// Apply redacts entry.Details and entry.ChangedFields in place. The maps are
+// replaced by redacted copies, so maps shared with the caller are not
+// modified. Applying a policy to an entry it already redacted leaves the
+// entry unchanged.
+func (p *RedactionPolicy) Apply(entry *AuditLog) {
+	if entry.Details != nil {
+		entry.Details = p.RedactMap(entry.Details)
+	}
+	if entry.ChangedFields != nil {
+		entry.ChangedFields = p.redactChangedFields(entry.ChangedFields)
+	}
+}
+
+// RedactMap returns a redacted copy of m. Nested map[string]any, []any and
+// map[string]string values are walked; other types are only subject to Key
+// and Path rules.
+func (p *RedactionPolicy) RedactMap(m map[string]any) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		if nv, keep := p.redactValue(k, k, v); keep {
+			out[k] = nv
+		}
+	}
+	return out
+}
+
+// redactChangedFields redacts a {field: {old, new}} map. Key and Path rules
+// match the field name and apply to both old and new values.
+func (p *RedactionPolicy) redactChangedFields(changed map[string]any) map[string]any {
+	out := make(map[string]any, len(changed))
+	for field, raw := range changed {
+		key := field
+		if i := strings.LastIndexByte(field, '.'); i >= 0 {
+			key = field[i+1:]
+		}
+
+		delta, ok := raw.(map[string]any)
+		if !ok {
+			if nv, keep := p.redactValue(field, key, raw); keep {
+				out[field] = nv
+			}
+			continue
+		}
+
+		if rule := p.matchKey(field, key); rule != nil {
+			if rule.Strategy == RedactDrop {
+				continue
+			}
+			redacted := make(map[string]any, len(delta))
+			for side, v := range delta {
+				if v == nil {
+					redacted[side] = nil
+					continue
+				}
+				redacted[side] = p.redactWhole(rule, v)
+			}
+			out[field] = redacted
+			continue
+		}
+
+		redacted := make(map[string]any, len(delta))
+		keepField := true
+		for side, v := range delta {
+			nv, keep := p.redactNested(field, v)
+			if !keep {
+				keepField = false
+				break
+			}
+			redacted[side] = nv
+		}
+		if keepField {
+			out[field] = redacted
+		}
+	}
+	return out
+}
+
+// redactValue redacts v stored under key at path. It returns false if the
+// key must be dropped.
+func (p *RedactionPolicy) redactValue(path, key string, v any) (any, bool) {
+	if rule := p.matchKey(path, key); rule != nil {
+		if rule.Strategy == RedactDrop {
+			return nil, false
+		}
+		return p.redactWhole(rule, v), true
+	}
+	return p.redactNested(path, v)
+}
+
+// redactNested walks containers below path and applies Value rules to
+// strings.
+func (p *RedactionPolicy) redactNested(path string, v any) (any, bool) {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, vv := range t {
+			if nv, keep := p.redactValue(path+"."+k, k, vv); keep {
+				out[k] = nv
+			}
+		}
+		return out, true
+	case map[string]string:
+		out := make(map[string]any, len(t))
+		for k, vv := range t {
+			if nv, keep := p.redactValue(path+"."+k, k, vv); keep {
+				out[k] = nv
+			}
+		}
+		return out, true
+	case []any:
+		out := make([]any, 0, len(t))
+		for _, e := range t {
+			if nv, keep := p.redactNested(path, e); keep {
+				out = append(out, nv)
+			}
+		}
+		return out, true
+	case string:
+		return p.redactString(t)
+	}
+	return v, true
+}
+
+// matchKey returns the first Key or Path rule matching key at path.
+func (p *RedactionPolicy) matchKey(path, key string) *RedactionRule {
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Key != nil && r.Key.MatchString(key) {
+			return r
+		}
+		if r.Path != "" && pathMatches(r.Path, path) {
+			return r
+		}
+	}
+	return nil
+}
+
+// redactString applies Value rules to s. It returns false if a RedactDrop
+// rule matched.
+func (p *RedactionPolicy) redactString(s string) (any, bool) {
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Value == nil {
+			continue
+		}
+		if r.Strategy == RedactDrop {
+			for _, match := range r.Value.FindAllString(s, -1) {
+				if r.Validate == nil || r.Validate(match) {
+					return nil, false
+				}
+			}
+			continue
+		}
+		s = r.Value.ReplaceAllStringFunc(s, func(match string) string {
+			if r.Validate != nil && !r.Validate(match) {
+				return match
+			}
+			return p.redactWhole(r, match).(string)
+		})
+	}
+	return s, true
+}
+
+// redactWhole applies rule's strategy to an entire value.
+func (p *RedactionPolicy) redactWhole(rule *RedactionRule, v any) any {
+	s, isString := v.(string)
+	if !isString {
+		s = fmt.Sprint(v)
+	}
+
+	switch rule.Strategy {
+	case RedactHash:
+		if isString && hashPattern.MatchString(s) {
+			return s
+		}
+		var sum []byte
+		if len(p.HashSalt) > 0 {
+			mac := hmac.New(sha256.New, p.HashSalt)
+			mac.Write([]byte(s))
+			sum = mac.Sum(nil)
+		} else {
+			h := sha256.Sum256([]byte(s))
+			sum = h[:]
+		}
+		return "sha256:" + hex.EncodeToString(sum)
+	case RedactTruncate:
+		r := []rune(s)
+		if len(r) <= rule.KeepFirst {
+			return s
+		}
+		return string(r[:rule.KeepFirst]) + "…"
+	default:
+		mask := p.MaskValue
+		if mask == "" {
+			mask = "***"
+		}
+		if isString && rule.KeepLast > 0 {
+			return mask + lastChars(s, rule.KeepLast)
+		}
+		return mask
+	}
+}
+
+// lastChars returns the last n non-separator characters of s.
+func lastChars(s string, n int) string {
+	var kept []rune
+	for _, r := range []rune(s) {
+		if r != ' ' && r != '-' {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) <= n {
+		return ""
+	}
+	return string(kept[len(kept)-n:])
+}
+
+// pathMatches reports whether path matches pattern, where a "*" segment in
+// pattern matches any single segment.
+func pathMatches(pattern, path string) bool {
+	ps, ks := strings.Split(pattern, "."), strings.Split(path, ".")
+	if len(ps) != len(ks) {
+		return false
+	}
+	for i := range ps {
+		if ps[i] != "*" && ps[i] != ks[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// ibanValid reports whether s is an IBAN with a valid mod-97 checksum.
+func ibanValid(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 15 {
+		return false
+	}
+	rearranged := s[4:] + s[:4]
+	rem := 0
+	for _, r := range rearranged {
+		switch {
+		case unicode.IsDigit(r):
+			rem = (rem*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			v := int(r-'A') + 10
+			rem = (rem*100 + v) % 97
+		default:
+			return false
+		}
+	}
+	return rem == 1
+}
+
+// RedactingRepository applies a RedactionPolicy to every entry before
+// handing it to the wrapped repository. Reads pass through unchanged.
+//
+// Wrap it outside a SigningRepository so that entries are signed after
+// redaction:
+//
+//	repo := audit.NewRedactingRepository(audit.NewSigningRepository(pg, signer), policy)
+type RedactingRepository struct {
+	AuditRepository
+	policy *RedactionPolicy
+}
+
+// NewRedactingRepository wraps repo so that Create redacts entries with
+// policy.
+func NewRedactingRepository(repo AuditRepository, policy *RedactionPolicy) *RedactingRepository {
+	return &RedactingRepository{AuditRepository: repo, policy: policy}
+}
+
+// Create persists a redacted copy of entry through the wrapped repository.
+// entry itself is left unchanged, so that retrying Create with it redacts
+// the original values again rather than the redacted ones.
+func (r *RedactingRepository) Create(ctx context.Context, entry *AuditLog) error {
+	redacted := *entry
+	r.policy.Apply(&redacted)
+	return r.AuditRepository.Create(ctx, &redacted)
+}
+
+// CreateBatch persists redacted copies of entries through the wrapped
+// repository, in one call if it is a BatchRepository and one call per
+// entry otherwise. Like Create, it leaves entries unchanged.
+func (r *RedactingRepository) CreateBatch(ctx context.Context, entries []*AuditLog) error {
+	redacted := make([]*AuditLog, len(entries))
+	for i, entry := range entries {
+		cp := *entry
+		redacted[i] = &cp
+	}
+	return createBatch(ctx, r.AuditRepository, redacted, func(entry *AuditLog) error {
+		r.policy.Apply(entry)
+		return nil
+	})
+}
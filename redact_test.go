@@ -0,0 +1,220 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+func TestDefaultRedactionPolicy_Details(t *testing.T) {
+	entry, _ := audit.New(audit.ActionCreate, "users",
+		audit.WithActor("u1", ""),
+		audit.WithDetails(map[string]any{
+			"password":    "hunter2",
+			"ssn":         "123-45-6789",
+			"status_code": 201,
+			"note":        "contact alice@example.com, card 4111 1111 1111 1111",
+			"order_ref":   "1234567890123", // fails Luhn, not a card
+			"payout":      map[string]any{"iban": "GB82 WEST 1234 5698 7654 32", "api_key": "k"},
+			"recipients":  []any{"bob@example.com"},
+		}),
+	)
+
+	audit.DefaultRedactionPolicy().Apply(entry)
+	d := entry.Details
+
+	if d["password"] != "***" {
+		t.Errorf("password = %v, want ***", d["password"])
+	}
+	if s, _ := d["ssn"].(string); !strings.HasPrefix(s, "sha256:") {
+		t.Errorf("ssn = %v, want hashed", d["ssn"])
+	}
+	if d["status_code"] != 201 {
+		t.Errorf("status_code = %v, want untouched 201", d["status_code"])
+	}
+	if d["note"] != "contact ***, card ***1111" {
+		t.Errorf("note = %q", d["note"])
+	}
+	if d["order_ref"] != "1234567890123" {
+		t.Errorf("order_ref = %v, want untouched", d["order_ref"])
+	}
+	payout := d["payout"].(map[string]any)
+	if payout["iban"] != "***5432" || payout["api_key"] != "***" {
+		t.Errorf("payout = %v", payout)
+	}
+	if r := d["recipients"].([]any); r[0] != "***" {
+		t.Errorf("recipients = %v", r)
+	}
+}
+
+func TestRedactionPolicy_Strategies(t *testing.T) {
+	policy := &audit.RedactionPolicy{
+		MaskValue: "[redacted]",
+		HashSalt:  []byte("pepper"),
+		Rules: []audit.RedactionRule{
+			{Path: "session", Strategy: audit.RedactDrop},
+			{Path: "payment.*.number", Strategy: audit.RedactMask, KeepLast: 2},
+			{Key: regexp.MustCompile(`^comment$`), Strategy: audit.RedactTruncate, KeepFirst: 5},
+			{Key: regexp.MustCompile(`^customer$`), Strategy: audit.RedactHash},
+			{Value: regexp.MustCompile(`DROPME`), Strategy: audit.RedactDrop},
+		},
+	}
+
+	in := map[string]any{
+		"session":  "abc",
+		"payment":  map[string]any{"card": map[string]any{"number": "4242", "brand": "visa"}},
+		"comment":  "a very long comment",
+		"customer": "c-1",
+		"tag":      "please DROPME",
+	}
+	out := policy.RedactMap(in)
+
+	if _, ok := out["session"]; ok {
+		t.Error("expected session to be dropped")
+	}
+	if _, ok := out["tag"]; ok {
+		t.Error("expected tag to be dropped by value rule")
+	}
+	card := out["payment"].(map[string]any)["card"].(map[string]any)
+	if card["number"] != "[redacted]42" || card["brand"] != "visa" {
+		t.Errorf("card = %v", card)
+	}
+	if out["comment"] != "a ver…" {
+		t.Errorf("comment = %q", out["comment"])
+	}
+
+	unsalted := (&audit.RedactionPolicy{Rules: policy.Rules}).RedactMap(in)
+	if out["customer"] == unsalted["customer"] {
+		t.Error("expected salt to change the hash")
+	}
+
+	// The input map is not modified.
+	if in["session"] != "abc" {
+		t.Error("expected input map to be left intact")
+	}
+}
+
+func TestRedactionPolicy_ChangedFields(t *testing.T) {
+	entry, _ := audit.New(audit.ActionUpdate, "users",
+		audit.WithActor("u1", ""),
+		audit.WithChangedFields(map[string]any{
+			"password":      map[string]any{"old": "a", "new": "b"},
+			"profile.email": map[string]any{"old": "a@x.io", "new": nil},
+			"name":          map[string]any{"old": "Al", "new": "Alice"},
+		}),
+	)
+
+	audit.DefaultRedactionPolicy().Apply(entry)
+	cf := entry.ChangedFields
+
+	pw := cf["password"].(map[string]any)
+	if pw["old"] != "***" || pw["new"] != "***" {
+		t.Errorf("password = %v", pw)
+	}
+	email := cf["profile.email"].(map[string]any)
+	if email["old"] != "***" || email["new"] != nil {
+		t.Errorf("profile.email = %v", email)
+	}
+	if cf["name"].(map[string]any)["new"] != "Alice" {
+		t.Errorf("name = %v", cf["name"])
+	}
+}
+
+func TestRedactingRepository_RedactsBeforeCreate(t *testing.T) {
+	inner := &memRepo{}
+	repo := audit.NewRedactingRepository(inner, audit.DefaultRedactionPolicy())
+
+	entry, _ := audit.New(audit.ActionCreate, "users",
+		audit.WithActor("u1", ""),
+		audit.WithDetails(map[string]any{"token": "abc"}),
+	)
+	if err := repo.Create(context.Background(), entry); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if inner.entries[0].Details["token"] != "***" {
+		t.Errorf("expected token redacted before persistence, got %v", inner.entries[0].Details)
+	}
+}
+
+func TestRedactingRepository_CreateBatch(t *testing.T) {
+	inner := &memBatchRepo{}
+	signer := audit.NewHMACSigner("k1", []byte("secret"))
+	repo := audit.NewRedactingRepository(audit.NewSigningRepository(inner, signer), audit.DefaultRedactionPolicy())
+
+	entries := newBatchEntries(t, "ord-1", "ord-2")
+	entries[0].Details = map[string]any{"token": "abc"}
+	if err := repo.CreateBatch(context.Background(), entries); err != nil {
+		t.Fatalf("CreateBatch returned error: %v", err)
+	}
+
+	if inner.batches != 1 || len(inner.entries) != 2 {
+		t.Fatalf("expected one batch through both wrappers, got %d batches and %d entries", inner.batches, len(inner.entries))
+	}
+	if inner.entries[0].Details["token"] != "***" {
+		t.Errorf("expected token redacted before persistence, got %v", inner.entries[0].Details)
+	}
+	v := audit.NewVerifier()
+	v.AddKey("k1", signer)
+	if got := v.Verify(inner.entries[0]); got != audit.SignatureValid {
+		t.Errorf("Verify = %s, want the redacted entry signed", got)
+	}
+}
+
+func TestRedactingRepository_CreateIsRepeatable(t *testing.T) {
+	inner := &memRepo{}
+	repo := audit.NewRedactingRepository(inner, audit.DefaultRedactionPolicy())
+
+	entry, _ := audit.New(audit.ActionCreate, "users",
+		audit.WithActor("u1", ""),
+		audit.WithDetails(map[string]any{"ssn": "123-45-6789", "password": "hunter2"}),
+	)
+	// A retry, e.g. after a transient failure, writes the same entry again.
+	var stored []string
+	for range 2 {
+		if err := repo.Create(context.Background(), entry); err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+		b, _ := json.Marshal(inner.entries[len(inner.entries)-1].Details)
+		stored = append(stored, string(b))
+	}
+
+	if stored[0] != stored[1] {
+		t.Errorf("stored details differ between attempts: %s and %s", stored[0], stored[1])
+	}
+	if !strings.Contains(stored[0], `"ssn":"sha256:`) {
+		t.Errorf("details = %s, want the ssn hashed", stored[0])
+	}
+	if entry.Details["ssn"] != "123-45-6789" {
+		t.Errorf("expected the caller's entry unchanged, got %v", entry.Details)
+	}
+}
+
+func TestRedactionPolicy_ApplyIsIdempotent(t *testing.T) {
+	for name, policy := range map[string]*audit.RedactionPolicy{
+		"default": audit.DefaultRedactionPolicy(),
+		"salted":  {HashSalt: []byte("pepper"), Rules: []audit.RedactionRule{{Key: regexp.MustCompile(`^ssn$`), Strategy: audit.RedactHash}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			entry := &audit.AuditLog{
+				Details: map[string]any{
+					"ssn":      "123-45-6789",
+					"password": "hunter2",
+					"contact":  "mail alice@example.com",
+					"card":     "4242 4242 4242 4242",
+				},
+				ChangedFields: map[string]any{"ssn": map[string]any{"old": "1", "new": "2"}},
+			}
+			policy.Apply(entry)
+			once, _ := json.Marshal(entry)
+			policy.Apply(entry)
+			twice, _ := json.Marshal(entry)
+			if string(once) != string(twice) {
+				t.Errorf("redacting twice changed the entry:\n%s\n%s", once, twice)
+			}
+		})
+	}
+}
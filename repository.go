@@ -1,27 +1,162 @@
 package audit
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"fmt"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 // AuditFilters defines the search criteria for listing audit log entries.
+// Category restricts results to the actions registered in that category.
+// UserID matches the real actor and SubjectID the effective subject, while
+// Identity matches entries where the ID is either of the two.
 type AuditFilters struct {
+	TenantID      string
 	UserID        string
+	SubjectID     string
+	Identity      string
+	ActorType     ActorType
 	CorrelationID string
 	Resource      string
 	Action        Action
+	Category      ActionCategory
+	Outcome       Outcome
+	Severity      Severity
 	From          *time.Time
 	To            *time.Time
 	Limit         int
 	Offset        int
 }
 
+// Validate reports whether the filters refer to known actions, outcomes
+// and severities.
+func (f AuditFilters) Validate() error {
+	if f.Action != "" && !f.Action.IsValid() {
+		return fmt.Errorf("unknown action filter %q", f.Action)
+	}
+	if f.ActorType != "" && !f.ActorType.IsValid() {
+		return fmt.Errorf("unknown actor type filter %q", f.ActorType)
+	}
+	if f.Outcome != "" && !f.Outcome.IsValid() {
+		return fmt.Errorf("unknown outcome filter %q", f.Outcome)
+	}
+	if f.Severity != "" && !f.Severity.IsValid() {
+		return fmt.Errorf("unknown severity filter %q", f.Severity)
+	}
+	return nil
+}
+
+// AuditWriter is the write-only subset of AuditRepository. It is the
+// contract for sinks that only need to receive entries (e.g. the target of
+// an outbox relay).
+type AuditWriter interface {
+	Create(ctx context.Context, entry *AuditLog) error
+}
+
 // AuditRepository defines the contract for audit log persistence.
 type AuditRepository interface {
-	Create(ctx context.Context, entry *AuditLog) error
+	AuditWriter
 	GetByID(ctx context.Context, id uuid.UUID) (*AuditLog, error)
 	List(ctx context.Context, filters AuditFilters) ([]AuditLog, int, error)
 }
+
+// BatchRepository is an AuditRepository that can persist several entries in
+// one round-trip. CreateBatch returns nil if every entry was persisted and
+// a *BatchError if only some were; any other error means none were.
+type BatchRepository interface {
+	AuditRepository
+	CreateBatch(ctx context.Context, entries []*AuditLog) error
+}
+
+// BatchEntryError is the failure of a single entry of a batch.
+type BatchEntryError struct {
+	// Index is the position of the entry in the batch.
+	Index int
+	Err   error
+}
+
+// BatchError reports the entries of a batch that could not be persisted,
+// in batch order. The entries not listed were persisted.
+type BatchError struct {
+	Failures []BatchEntryError
+}
+
+func (e *BatchError) Error() string {
+	if len(e.Failures) == 1 {
+		return fmt.Sprintf("audit batch entry %d failed: %v", e.Failures[0].Index, e.Failures[0].Err)
+	}
+	return fmt.Sprintf("%d audit batch entries failed, first: %v", len(e.Failures), e.Failures[0].Err)
+}
+
+// Unwrap returns the errors of the failed entries, so that errors.Is and
+// errors.As match any of them.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+// Failed reports whether the entry at index i is among the failures.
+func (e *BatchError) Failed(i int) bool {
+	for _, f := range e.Failures {
+		if f.Index == i {
+			return true
+		}
+	}
+	return false
+}
+
+// createBatch applies prepare to entries and persists the prepared ones
+// through repo: with one CreateBatch call if repo is a BatchRepository,
+// with one Create call per entry otherwise. Entries that fail to prepare
+// are reported as failed in the returned *BatchError.
+func createBatch(ctx context.Context, repo AuditRepository, entries []*AuditLog, prepare func(*AuditLog) error) error {
+	var failures []BatchEntryError
+	ready := make([]*AuditLog, 0, len(entries))
+	index := make([]int, 0, len(entries))
+	for i, entry := range entries {
+		if err := prepare(entry); err != nil {
+			failures = append(failures, BatchEntryError{Index: i, Err: err})
+			continue
+		}
+		ready = append(ready, entry)
+		index = append(index, i)
+	}
+
+	if batch, ok := repo.(BatchRepository); ok && len(ready) > 0 {
+		err := batch.CreateBatch(ctx, ready)
+		var batchErr *BatchError
+		switch {
+		case err == nil:
+		case errors.As(err, &batchErr):
+			for _, f := range batchErr.Failures {
+				failures = append(failures, BatchEntryError{Index: index[f.Index], Err: f.Err})
+			}
+		case len(failures) == 0:
+			return err
+		default:
+			for _, i := range index {
+				failures = append(failures, BatchEntryError{Index: i, Err: err})
+			}
+		}
+	} else {
+		for j, entry := range ready {
+			if err := repo.Create(ctx, entry); err != nil {
+				failures = append(failures, BatchEntryError{Index: index[j], Err: err})
+			}
+		}
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+	slices.SortFunc(failures, func(a, b BatchEntryError) int { return cmp.Compare(a.Index, b.Index) })
+	return &BatchError{Failures: failures}
+}
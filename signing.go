@@ -0,0 +1,252 @@
+package audit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// ---------- Signers ----------
+
+// Signer signs the canonical form of audit entries. KeyID identifies the
+// key so verifiers can pick the matching KeyVerifier after rotation.
+type Signer interface {
+	KeyID() string
+	Sign(payload []byte) ([]byte, error)
+}
+
+// KeyVerifier checks a signature produced by the matching Signer.
+type KeyVerifier interface {
+	Verify(payload, signature []byte) bool
+}
+
+// HMACSigner signs entries with HMAC-SHA256. The same value verifies its
+// own signatures, so it can be registered with a Verifier directly.
+type HMACSigner struct {
+	keyID string
+	key   []byte
+}
+
+// NewHMACSigner creates an HMAC-SHA256 signer for the given key.
+func NewHMACSigner(keyID string, key []byte) *HMACSigner {
+	return &HMACSigner{keyID: keyID, key: key}
+}
+
+// KeyID returns the identifier of the signing key.
+func (s *HMACSigner) KeyID() string { return s.keyID }
+
+// Sign returns the HMAC-SHA256 of payload.
+func (s *HMACSigner) Sign(payload []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return mac.Sum(nil), nil
+}
+
+// Verify reports whether signature is the HMAC-SHA256 of payload.
+func (s *HMACSigner) Verify(payload, signature []byte) bool {
+	want, _ := s.Sign(payload)
+	return hmac.Equal(want, signature)
+}
+
+// Ed25519Signer signs entries with an Ed25519 private key. Third parties
+// verify with the public key only (see Ed25519Verifier), which gives
+// non-repudiation that HMAC cannot.
+type Ed25519Signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+// NewEd25519Signer creates an Ed25519 signer for the given private key.
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) *Ed25519Signer {
+	return &Ed25519Signer{keyID: keyID, key: key}
+}
+
+// KeyID returns the identifier of the signing key.
+func (s *Ed25519Signer) KeyID() string { return s.keyID }
+
+// Sign returns the Ed25519 signature of payload.
+func (s *Ed25519Signer) Sign(payload []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, payload), nil
+}
+
+// Ed25519Verifier verifies Ed25519 signatures with a public key.
+type Ed25519Verifier ed25519.PublicKey
+
+// Verify reports whether signature is a valid Ed25519 signature of payload.
+func (k Ed25519Verifier) Verify(payload, signature []byte) bool {
+	if len(k) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(ed25519.PublicKey(k), payload, signature)
+}
+
+// ---------- Entry signing ----------
+
+// SigningPayload returns the bytes covered by an entry's signature: the
+// canonical form without the hash chain and signature fields, which are
+// assigned after signing. Like the hash, it covers Details and ChangedFields
+// in their JSON round-trip form, so an entry signed before it is stored
+// verifies once read back.
+func (l *AuditLog) SigningPayload() ([]byte, error) {
+	cp := *l
+	cp.ChainSeq = 0
+	cp.PrevHash = ""
+	cp.Hash = ""
+	cp.Signature = nil
+	cp.SignatureKeyID = ""
+	return cp.CanonicalBytes()
+}
+
+// Sign signs the entry with s and records the signature and key ID.
+func (l *AuditLog) Sign(s Signer) error {
+	payload, err := l.SigningPayload()
+	if err != nil {
+		return err
+	}
+	sig, err := s.Sign(payload)
+	if err != nil {
+		return fmt.Errorf("signing audit log entry: %w", err)
+	}
+	l.Signature = sig
+	l.SignatureKeyID = s.KeyID()
+	return nil
+}
+
+// SigningRepository signs every entry before handing it to the wrapped
+// repository. Reads pass through unchanged.
+type SigningRepository struct {
+	AuditRepository
+	signer Signer
+}
+
+// NewSigningRepository wraps repo so that Create signs entries with signer.
+func NewSigningRepository(repo AuditRepository, signer Signer) *SigningRepository {
+	return &SigningRepository{AuditRepository: repo, signer: signer}
+}
+
+// Create signs entry and persists it through the wrapped repository.
+func (r *SigningRepository) Create(ctx context.Context, entry *AuditLog) error {
+	if err := entry.Sign(r.signer); err != nil {
+		return err
+	}
+	return r.AuditRepository.Create(ctx, entry)
+}
+
+// CreateBatch signs entries and persists them through the wrapped
+// repository, in one call if it is a BatchRepository and one call per
+// entry otherwise. Entries that cannot be signed are reported as failed.
+func (r *SigningRepository) CreateBatch(ctx context.Context, entries []*AuditLog) error {
+	return createBatch(ctx, r.AuditRepository, entries, func(entry *AuditLog) error {
+		return entry.Sign(r.signer)
+	})
+}
+
+// ---------- Verification ----------
+
+// SignatureStatus is the outcome of verifying an entry's signature.
+type SignatureStatus string
+
+const (
+	// SignatureValid means the signature matches and the key is active.
+	SignatureValid SignatureStatus = "valid"
+	// SignatureRetiredKey means the signature matches but the key has been
+	// retired; the entry is authentic but should be re-checked against the
+	// rotation policy.
+	SignatureRetiredKey SignatureStatus = "retired_key"
+	// SignatureInvalid means the entry or its signature was altered.
+	SignatureInvalid SignatureStatus = "invalid"
+	// SignatureUnknownKey means no key with the entry's key ID is known.
+	SignatureUnknownKey SignatureStatus = "unknown_key"
+	// SignatureMissing means the entry is not signed.
+	SignatureMissing SignatureStatus = "missing"
+)
+
+// SignatureResult is the verification result for one entry.
+type SignatureResult struct {
+	EntryID uuid.UUID
+	KeyID   string
+	Status  SignatureStatus
+}
+
+type verifierKey struct {
+	verifier KeyVerifier
+	retired  bool
+}
+
+// Verifier checks entry signatures against a set of keys. Several keys can
+// be active at once to support rotation; retired keys still verify but are
+// flagged. It is safe for concurrent use.
+type Verifier struct {
+	mu   sync.RWMutex
+	keys map[string]verifierKey
+}
+
+// NewVerifier creates an empty Verifier.
+func NewVerifier() *Verifier {
+	return &Verifier{keys: map[string]verifierKey{}}
+}
+
+// AddKey registers an active key under keyID, replacing any previous key
+// with that ID.
+func (v *Verifier) AddKey(keyID string, k KeyVerifier) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keys[keyID] = verifierKey{verifier: k}
+}
+
+// RetireKey marks keyID as retired. Entries signed with it verify as
+// SignatureRetiredKey instead of SignatureValid.
+func (v *Verifier) RetireKey(keyID string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	k, ok := v.keys[keyID]
+	if !ok {
+		return errors.New("unknown key id")
+	}
+	k.retired = true
+	v.keys[keyID] = k
+	return nil
+}
+
+// Verify checks the signature of a single entry.
+func (v *Verifier) Verify(entry *AuditLog) SignatureStatus {
+	if len(entry.Signature) == 0 {
+		return SignatureMissing
+	}
+
+	v.mu.RLock()
+	k, ok := v.keys[entry.SignatureKeyID]
+	v.mu.RUnlock()
+	if !ok {
+		return SignatureUnknownKey
+	}
+
+	payload, err := entry.SigningPayload()
+	if err != nil || !k.verifier.Verify(payload, entry.Signature) {
+		return SignatureInvalid
+	}
+	if k.retired {
+		return SignatureRetiredKey
+	}
+	return SignatureValid
+}
+
+// VerifyAll checks the signatures of entries, e.g. a page returned by
+// AuditRepository.List.
+func (v *Verifier) VerifyAll(entries []AuditLog) []SignatureResult {
+	results := make([]SignatureResult, len(entries))
+	for i := range entries {
+		results[i] = SignatureResult{
+			EntryID: entries[i].ID,
+			KeyID:   entries[i].SignatureKeyID,
+			Status:  v.Verify(&entries[i]),
+		}
+	}
+	return results
+}
@@ -0,0 +1,288 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	audit "github.com/kafeiih/go-audit"
+)
+
+type memRepo struct {
+	entries []*audit.AuditLog
+}
+
+func (m *memRepo) Create(_ context.Context, entry *audit.AuditLog) error {
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *memRepo) GetByID(_ context.Context, _ uuid.UUID) (*audit.AuditLog, error) {
+	return nil, nil
+}
+
+func (m *memRepo) List(_ context.Context, _ audit.AuditFilters) ([]audit.AuditLog, int, error) {
+	return nil, 0, nil
+}
+
+// memBatchRepo is a memRepo that records the batches passed to CreateBatch
+// and rejects the entries whose resource ID is in fail.
+type memBatchRepo struct {
+	memRepo
+	batches int
+	fail    map[string]bool
+}
+
+func (m *memBatchRepo) CreateBatch(ctx context.Context, entries []*audit.AuditLog) error {
+	m.batches++
+	var be audit.BatchError
+	for i, e := range entries {
+		if m.fail[e.ResourceID] {
+			be.Failures = append(be.Failures, audit.BatchEntryError{Index: i, Err: errors.New("rejected")})
+			continue
+		}
+		m.Create(ctx, e)
+	}
+	if len(be.Failures) > 0 {
+		return &be
+	}
+	return nil
+}
+
+// flakySigner fails to sign every payload containing its marker.
+type flakySigner struct {
+	audit.Signer
+	marker string
+}
+
+func (s flakySigner) Sign(payload []byte) ([]byte, error) {
+	if bytes.Contains(payload, []byte(s.marker)) {
+		return nil, errors.New("signing service unavailable")
+	}
+	return s.Signer.Sign(payload)
+}
+
+func newBatchEntries(t *testing.T, ids ...string) []*audit.AuditLog {
+	t.Helper()
+	var entries []*audit.AuditLog
+	for _, id := range ids {
+		entry, err := audit.New(audit.ActionCreate, "orders", audit.WithActor("u1", ""), audit.WithResourceID(id))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func newSignedEntry(t *testing.T, s audit.Signer) *audit.AuditLog {
+	t.Helper()
+	entry, err := audit.NewAuditLog("user-1", "alice", "", audit.ActionUpdate, "orders", "ord-1", "", "",
+		map[string]any{"amount": 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := entry.Sign(s); err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+	return entry
+}
+
+func TestSigningRepository_SignsBeforeCreate(t *testing.T) {
+	repo := &memRepo{}
+	signer := audit.NewHMACSigner("k1", []byte("secret"))
+
+	entry, _ := audit.NewAuditLog("user-1", "alice", "", audit.ActionCreate, "orders", "", "", "", nil)
+	if err := audit.NewSigningRepository(repo, signer).Create(context.Background(), entry); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	if len(repo.entries) != 1 {
+		t.Fatalf("expected entry to reach the wrapped repo")
+	}
+	if repo.entries[0].SignatureKeyID != "k1" || len(repo.entries[0].Signature) == 0 {
+		t.Errorf("expected entry signed with k1, got key=%q sig=%x", repo.entries[0].SignatureKeyID, repo.entries[0].Signature)
+	}
+}
+
+func TestSigningRepository_CreateBatch(t *testing.T) {
+	signer := flakySigner{Signer: audit.NewHMACSigner("k1", []byte("secret")), marker: "ord-2"}
+
+	t.Run("batching repository", func(t *testing.T) {
+		inner := &memBatchRepo{fail: map[string]bool{"ord-4": true}}
+		err := audit.NewSigningRepository(inner, signer).CreateBatch(context.Background(),
+			newBatchEntries(t, "ord-1", "ord-2", "ord-3", "ord-4"))
+
+		var be *audit.BatchError
+		if !errors.As(err, &be) || len(be.Failures) != 2 || !be.Failed(1) || !be.Failed(3) {
+			t.Fatalf("CreateBatch = %v, want entries 1 and 3 failed", err)
+		}
+		if inner.batches != 1 || len(inner.entries) != 2 {
+			t.Fatalf("expected one batch persisting 2 entries, got %d batches and %d entries", inner.batches, len(inner.entries))
+		}
+		for _, e := range inner.entries {
+			if e.SignatureKeyID != "k1" {
+				t.Errorf("entry %s not signed", e.ResourceID)
+			}
+		}
+	})
+
+	t.Run("non-batching repository", func(t *testing.T) {
+		inner := &memRepo{}
+		err := audit.NewSigningRepository(inner, signer).CreateBatch(context.Background(),
+			newBatchEntries(t, "ord-1", "ord-3"))
+		if err != nil {
+			t.Fatalf("CreateBatch returned error: %v", err)
+		}
+		if len(inner.entries) != 2 || inner.entries[1].SignatureKeyID != "k1" {
+			t.Errorf("expected both entries signed and created one by one, got %d", len(inner.entries))
+		}
+	})
+}
+
+func TestVerifier_HMAC(t *testing.T) {
+	signer := audit.NewHMACSigner("k1", []byte("secret"))
+	v := audit.NewVerifier()
+	v.AddKey("k1", signer)
+
+	entry := newSignedEntry(t, signer)
+	if got := v.Verify(entry); got != audit.SignatureValid {
+		t.Fatalf("Verify = %s, want valid", got)
+	}
+
+	// Chain fields are assigned after signing and must not invalidate it.
+	entry.ChainSeq, entry.PrevHash, entry.Hash = 3, "a", "b"
+	if got := v.Verify(entry); got != audit.SignatureValid {
+		t.Errorf("Verify after chaining = %s, want valid", got)
+	}
+
+	entry.Details["amount"] = 1000
+	if got := v.Verify(entry); got != audit.SignatureInvalid {
+		t.Errorf("Verify after tampering = %s, want invalid", got)
+	}
+}
+
+func TestVerifier_Ed25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	v := audit.NewVerifier()
+	v.AddKey("ed-1", audit.Ed25519Verifier(pub))
+
+	entry := newSignedEntry(t, audit.NewEd25519Signer("ed-1", priv))
+	if got := v.Verify(entry); got != audit.SignatureValid {
+		t.Fatalf("Verify = %s, want valid", got)
+	}
+
+	entry.UserID = "mallory"
+	if got := v.Verify(entry); got != audit.SignatureInvalid {
+		t.Errorf("Verify after tampering = %s, want invalid", got)
+	}
+}
+
+func TestVerifier_Rotation(t *testing.T) {
+	oldKey := audit.NewHMACSigner("k1", []byte("old"))
+	newKey := audit.NewHMACSigner("k2", []byte("new"))
+
+	v := audit.NewVerifier()
+	v.AddKey("k1", oldKey)
+	v.AddKey("k2", newKey)
+	if err := v.RetireKey("k1"); err != nil {
+		t.Fatalf("RetireKey returned error: %v", err)
+	}
+	if err := v.RetireKey("nope"); err == nil {
+		t.Error("expected error retiring an unknown key")
+	}
+
+	unsigned, _ := audit.NewAuditLog("user-1", "alice", "", audit.ActionRead, "orders", "", "", "", nil)
+	foreign := newSignedEntry(t, audit.NewHMACSigner("k9", []byte("x")))
+
+	entries := []audit.AuditLog{
+		*newSignedEntry(t, oldKey),
+		*newSignedEntry(t, newKey),
+		*unsigned,
+		*foreign,
+	}
+	want := []audit.SignatureStatus{
+		audit.SignatureRetiredKey,
+		audit.SignatureValid,
+		audit.SignatureMissing,
+		audit.SignatureUnknownKey,
+	}
+
+	results := v.VerifyAll(entries)
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Errorf("entry %d: status = %s, want %s", i, r.Status, want[i])
+		}
+		if r.EntryID != entries[i].ID {
+			t.Errorf("entry %d: EntryID mismatch", i)
+		}
+	}
+}
+
+// jsonRepo stores entries as JSON, so reloaded entries have their details
+// decoded the way a JSONB column returns them.
+type jsonRepo struct {
+	memRepo
+	rows map[uuid.UUID][]byte
+}
+
+func (j *jsonRepo) Create(_ context.Context, entry *audit.AuditLog) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if j.rows == nil {
+		j.rows = map[uuid.UUID][]byte{}
+	}
+	j.rows[entry.ID] = b
+	return nil
+}
+
+func (j *jsonRepo) GetByID(_ context.Context, id uuid.UUID) (*audit.AuditLog, error) {
+	var entry audit.AuditLog
+	if err := json.Unmarshal(j.rows[id], &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func TestVerifier_AfterStorageRoundTrip(t *testing.T) {
+	type card struct {
+		Number string `json:"number"`
+		Brand  string `json:"brand"`
+	}
+	repo := &jsonRepo{}
+	signer := audit.NewHMACSigner("k1", []byte("secret"))
+	v := audit.NewVerifier()
+	v.AddKey("k1", signer)
+
+	entry, err := audit.NewAuditLog("user-1", "alice", "", audit.ActionCreate, "payments", "pay-1", "", "",
+		map[string]any{
+			"card":   card{Number: "4111", Brand: "visa"},
+			"amount": int64(1234567890123456789),
+			"body":   map[string]any{"total": json.Number("10.50")},
+		})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	if err := audit.NewSigningRepository(repo, signer).Create(ctx, entry); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	reloaded, err := repo.GetByID(ctx, entry.ID)
+	if err != nil {
+		t.Fatalf("GetByID returned error: %v", err)
+	}
+	if got := v.Verify(reloaded); got != audit.SignatureValid {
+		t.Errorf("Verify after reload = %s, want valid", got)
+	}
+}